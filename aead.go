@@ -0,0 +1,106 @@
+package sodium
+
+import "encoding/binary"
+
+// AEADAdditionalData collects additional data for the AEAD functions in chunks.
+//
+// The AEAD constructions of libsodium only accept the additional data as a
+// single buffer, there is no incremental API for it. AEADAdditionalData
+// concatenates the chunks written to it, up to a maximum size, so that large
+// headers can be built from pieces or copied from an io.Reader.
+type AEADAdditionalData struct {
+	b   Bytes
+	max int
+}
+
+// NewAEADAdditionalData creates an empty AEADAdditionalData holding at most max bytes.
+func NewAEADAdditionalData(max int) *AEADAdditionalData {
+	return &AEADAdditionalData{max: max}
+}
+
+// Write appends p to the additional data.
+//
+// It returns ErrAdditionalDataTooLarge without appending anything if the
+// total size would exceed the maximum.
+func (a *AEADAdditionalData) Write(p []byte) (n int, err error) {
+	if len(p) > a.max-len(a.b) {
+		return 0, ErrAdditionalDataTooLarge
+	}
+	a.b = append(a.b, p...)
+	return len(p), nil
+}
+
+// Bytes returns the concatenated additional data.
+func (a *AEADAdditionalData) Bytes() Bytes {
+	return a.b
+}
+
+// Length returns the byte length of the additional data collected so far.
+func (a *AEADAdditionalData) Length() int {
+	return len(a.b)
+}
+
+// Reset drops the collected additional data.
+func (a *AEADAdditionalData) Reset() {
+	a.b = nil
+}
+
+const adSegmentLengthBytes = 4
+
+// ADBuilder builds a single additional data from several segments, e.g. a
+// sequence number, a timestamp and a message type, for WriteWithAD or the
+// AEAD functions.
+//
+// Each segment is prefixed by its big-endian uint32 length, so different
+// lists of segments never give the same additional data: "ab", "c" and
+// "a", "bc" are different, unlike with concatenation. ParseAD splits it back.
+type ADBuilder struct {
+	b Bytes
+}
+
+// NewADBuilder creates an ADBuilder without segments.
+func NewADBuilder() *ADBuilder {
+	return &ADBuilder{b: Bytes{}}
+}
+
+// Add appends segment to the additional data. It returns a so calls can be
+// chained.
+func (a *ADBuilder) Add(segment []byte) *ADBuilder {
+	if uint64(len(segment)) > 1<<32-1 {
+		panic("Segment too large.")
+	}
+	var l [adSegmentLengthBytes]byte
+	binary.BigEndian.PutUint32(l[:], uint32(len(segment)))
+	a.b = append(append(a.b, l[:]...), segment...)
+	return a
+}
+
+// Bytes returns the additional data built so far.
+func (a *ADBuilder) Bytes() Bytes {
+	return a.b
+}
+
+// Reset drops the segments.
+func (a *ADBuilder) Reset() {
+	a.b = Bytes{}
+}
+
+// ParseAD splits the additional data built by ADBuilder into its segments,
+// which refer to ad.
+//
+// It returns ErrInvalidEncoding if ad is not made of length-prefixed segments.
+func ParseAD(ad []byte) (segments [][]byte, err error) {
+	for len(ad) > 0 {
+		if len(ad) < adSegmentLengthBytes {
+			return nil, ErrInvalidEncoding
+		}
+		l := binary.BigEndian.Uint32(ad)
+		ad = ad[adSegmentLengthBytes:]
+		if uint64(l) > uint64(len(ad)) {
+			return nil, ErrInvalidEncoding
+		}
+		segments = append(segments, ad[:l:l])
+		ad = ad[l:]
+	}
+	return
+}
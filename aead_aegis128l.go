@@ -0,0 +1,126 @@
+//go:build sodium_aegis
+// +build sodium_aegis
+
+package sodium
+
+// AEGIS needs libsodium 1.0.19 or later, build with -tags sodium_aegis.
+
+// #cgo pkg-config: libsodium
+// #include <stdlib.h>
+// #include <sodium.h>
+import "C"
+
+var (
+	cryptoAEADAEGIS128LKeyBytes  = int(C.crypto_aead_aegis128l_keybytes())
+	cryptoAEADAEGIS128LNPubBytes = int(C.crypto_aead_aegis128l_npubbytes())
+	cryptoAEADAEGIS128LABytes    = int(C.crypto_aead_aegis128l_abytes())
+)
+
+type AEADAEGIS128LNonce struct {
+	Bytes
+}
+
+func (AEADAEGIS128LNonce) Size() int {
+	return cryptoAEADAEGIS128LNPubBytes
+}
+
+func (n *AEADAEGIS128LNonce) Next() {
+	C.sodium_increment((*C.uchar)(&n.Bytes[0]), (C.size_t)(cryptoAEADAEGIS128LNPubBytes))
+}
+
+type AEADAEGIS128LKey struct {
+	Bytes
+}
+
+func (AEADAEGIS128LKey) Size() int {
+	return cryptoAEADAEGIS128LKeyBytes
+}
+
+func (k AEADAEGIS128LKey) String() string {
+	return redacted("AEADAEGIS128LKey", k.Bytes)
+}
+
+func MakeAEADAEGIS128LKey() AEADAEGIS128LKey {
+	b := make([]byte, cryptoAEADAEGIS128LKeyBytes)
+	C.crypto_aead_aegis128l_keygen((*C.uchar)(&b[0]))
+	return AEADAEGIS128LKey{b}
+}
+
+// AEADAEGIS128LOverhead returns the number of bytes AEADAEGIS128LEncrypt adds
+// to a message.
+func AEADAEGIS128LOverhead() int {
+	return cryptoAEADAEGIS128LABytes
+}
+
+// AEADAEGIS128LEncrypt encrypts message with AEADAEGIS128LKey, and AEADAEGIS128LNonce.
+// Message then authenticated with additional data 'ad'.
+// Authentication tag is append to the encrypted data.
+func (b Bytes) AEADAEGIS128LEncrypt(ad Bytes, n AEADAEGIS128LNonce, k AEADAEGIS128LKey) (c Bytes) {
+	checkTypedSize(&n, "public nonce")
+	checkTypedSize(&k, "secret key")
+	checkStrict(n.Bytes, "public nonce")
+	checkStrict(k.Bytes, "secret key")
+
+	bp, bl := plen(b)
+	c = make([]byte, bl+cryptoAEADAEGIS128LABytes)
+	cp, _ := plen(c)
+
+	var outlen C.ulonglong
+
+	adp, adl := plen(ad)
+
+	if int(C.crypto_aead_aegis128l_encrypt(
+		(*C.uchar)(cp),
+		&outlen,
+		(*C.uchar)(bp),
+		(C.ulonglong)(bl),
+		(*C.uchar)(adp),
+		(C.ulonglong)(adl),
+		(*C.uchar)(nil),
+		(*C.uchar)(&n.Bytes[0]),
+		(*C.uchar)(&k.Bytes[0]))) != 0 {
+		panic("see libsodium")
+	}
+	c = c[:outlen]
+
+	return
+}
+
+// AEADAEGIS128LDecrypt decrypts message with AEADAEGIS128LKey, and AEADAEGIS128LNonce.
+// The appended authenticated tag is verified with additional data 'ad' before decryption.
+//
+// It returns an error if decryption failed.
+func (b Bytes) AEADAEGIS128LDecrypt(ad Bytes, n AEADAEGIS128LNonce, k AEADAEGIS128LKey) (m Bytes, err error) {
+	checkTypedSize(&n, "public nonce")
+	checkTypedSize(&k, "secret key")
+	checkStrict(k.Bytes, "secret key")
+	if b.Length() < cryptoAEADAEGIS128LABytes {
+		return nil, ErrDecryptAEAD
+	}
+	bp, bl := plen(b)
+	m = make([]byte, bl-cryptoAEADAEGIS128LABytes)
+	mp, _ := plen(m)
+	adp, adl := plen(ad)
+
+	var outlen C.ulonglong
+
+	if int(C.crypto_aead_aegis128l_decrypt(
+		(*C.uchar)(mp),
+		&outlen,
+		(*C.uchar)(nil),
+		(*C.uchar)(bp),
+		(C.ulonglong)(bl),
+		(*C.uchar)(adp),
+		(C.ulonglong)(adl),
+		(*C.uchar)(&n.Bytes[0]),
+		(*C.uchar)(&k.Bytes[0]))) != 0 {
+		err = ErrDecryptAEAD
+	}
+	m = m[:outlen]
+	return
+}
+
+func init() {
+	registerConstruction("aead_aegis128l",
+		cryptoAEADAEGIS128LKeyBytes, cryptoAEADAEGIS128LNPubBytes, cryptoAEADAEGIS128LABytes)
+}
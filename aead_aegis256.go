@@ -0,0 +1,126 @@
+//go:build sodium_aegis
+// +build sodium_aegis
+
+package sodium
+
+// AEGIS needs libsodium 1.0.19 or later, build with -tags sodium_aegis.
+
+// #cgo pkg-config: libsodium
+// #include <stdlib.h>
+// #include <sodium.h>
+import "C"
+
+var (
+	cryptoAEADAEGIS256KeyBytes  = int(C.crypto_aead_aegis256_keybytes())
+	cryptoAEADAEGIS256NPubBytes = int(C.crypto_aead_aegis256_npubbytes())
+	cryptoAEADAEGIS256ABytes    = int(C.crypto_aead_aegis256_abytes())
+)
+
+type AEADAEGIS256Nonce struct {
+	Bytes
+}
+
+func (AEADAEGIS256Nonce) Size() int {
+	return cryptoAEADAEGIS256NPubBytes
+}
+
+func (n *AEADAEGIS256Nonce) Next() {
+	C.sodium_increment((*C.uchar)(&n.Bytes[0]), (C.size_t)(cryptoAEADAEGIS256NPubBytes))
+}
+
+type AEADAEGIS256Key struct {
+	Bytes
+}
+
+func (AEADAEGIS256Key) Size() int {
+	return cryptoAEADAEGIS256KeyBytes
+}
+
+func (k AEADAEGIS256Key) String() string {
+	return redacted("AEADAEGIS256Key", k.Bytes)
+}
+
+func MakeAEADAEGIS256Key() AEADAEGIS256Key {
+	b := make([]byte, cryptoAEADAEGIS256KeyBytes)
+	C.crypto_aead_aegis256_keygen((*C.uchar)(&b[0]))
+	return AEADAEGIS256Key{b}
+}
+
+// AEADAEGIS256Overhead returns the number of bytes AEADAEGIS256Encrypt adds
+// to a message.
+func AEADAEGIS256Overhead() int {
+	return cryptoAEADAEGIS256ABytes
+}
+
+// AEADAEGIS256Encrypt encrypts message with AEADAEGIS256Key, and AEADAEGIS256Nonce.
+// Message then authenticated with additional data 'ad'.
+// Authentication tag is append to the encrypted data.
+func (b Bytes) AEADAEGIS256Encrypt(ad Bytes, n AEADAEGIS256Nonce, k AEADAEGIS256Key) (c Bytes) {
+	checkTypedSize(&n, "public nonce")
+	checkTypedSize(&k, "secret key")
+	checkStrict(n.Bytes, "public nonce")
+	checkStrict(k.Bytes, "secret key")
+
+	bp, bl := plen(b)
+	c = make([]byte, bl+cryptoAEADAEGIS256ABytes)
+	cp, _ := plen(c)
+
+	var outlen C.ulonglong
+
+	adp, adl := plen(ad)
+
+	if int(C.crypto_aead_aegis256_encrypt(
+		(*C.uchar)(cp),
+		&outlen,
+		(*C.uchar)(bp),
+		(C.ulonglong)(bl),
+		(*C.uchar)(adp),
+		(C.ulonglong)(adl),
+		(*C.uchar)(nil),
+		(*C.uchar)(&n.Bytes[0]),
+		(*C.uchar)(&k.Bytes[0]))) != 0 {
+		panic("see libsodium")
+	}
+	c = c[:outlen]
+
+	return
+}
+
+// AEADAEGIS256Decrypt decrypts message with AEADAEGIS256Key, and AEADAEGIS256Nonce.
+// The appended authenticated tag is verified with additional data 'ad' before decryption.
+//
+// It returns an error if decryption failed.
+func (b Bytes) AEADAEGIS256Decrypt(ad Bytes, n AEADAEGIS256Nonce, k AEADAEGIS256Key) (m Bytes, err error) {
+	checkTypedSize(&n, "public nonce")
+	checkTypedSize(&k, "secret key")
+	checkStrict(k.Bytes, "secret key")
+	if b.Length() < cryptoAEADAEGIS256ABytes {
+		return nil, ErrDecryptAEAD
+	}
+	bp, bl := plen(b)
+	m = make([]byte, bl-cryptoAEADAEGIS256ABytes)
+	mp, _ := plen(m)
+	adp, adl := plen(ad)
+
+	var outlen C.ulonglong
+
+	if int(C.crypto_aead_aegis256_decrypt(
+		(*C.uchar)(mp),
+		&outlen,
+		(*C.uchar)(nil),
+		(*C.uchar)(bp),
+		(C.ulonglong)(bl),
+		(*C.uchar)(adp),
+		(C.ulonglong)(adl),
+		(*C.uchar)(&n.Bytes[0]),
+		(*C.uchar)(&k.Bytes[0]))) != 0 {
+		err = ErrDecryptAEAD
+	}
+	m = m[:outlen]
+	return
+}
+
+func init() {
+	registerConstruction("aead_aegis256",
+		cryptoAEADAEGIS256KeyBytes, cryptoAEADAEGIS256NPubBytes, cryptoAEADAEGIS256ABytes)
+}
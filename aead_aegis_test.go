@@ -0,0 +1,69 @@
+//go:build sodium_aegis
+// +build sodium_aegis
+
+package sodium
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAEADAEGIS(t *testing.T) {
+	ad := Bytes("ad")
+
+	k256 := MakeAEADAEGIS256Key()
+	n256 := AEADAEGIS256Nonce{}
+	Randomize(&n256)
+	c := m.AEADAEGIS256Encrypt(ad, n256, k256)
+	if c.Length() != m.Length()+AEADAEGIS256Overhead() {
+		t.Errorf("AEGIS-256: got %d bytes of cipher text", c.Length())
+	}
+	if d, err := c.AEADAEGIS256Decrypt(ad, n256, k256); err != nil || !bytes.Equal(d, m) {
+		t.Errorf("AEGIS-256: %v", err)
+	}
+	c[0] ^= 1
+	if _, err := c.AEADAEGIS256Decrypt(ad, n256, k256); err != ErrDecryptAEAD {
+		t.Errorf("AEGIS-256 forged: got %v", err)
+	}
+
+	k128 := MakeAEADAEGIS128LKey()
+	n128 := AEADAEGIS128LNonce{}
+	Randomize(&n128)
+	c = m.AEADAEGIS128LEncrypt(ad, n128, k128)
+	if d, err := c.AEADAEGIS128LDecrypt(ad, n128, k128); err != nil || !bytes.Equal(d, m) {
+		t.Errorf("AEGIS-128L: %v", err)
+	}
+	if _, err := c[:AEADAEGIS128LOverhead()-1].AEADAEGIS128LDecrypt(ad, n128, k128); err != ErrDecryptAEAD {
+		t.Errorf("AEGIS-128L short: got %v", err)
+	}
+}
+
+func TestAEADAEGISNilAndEmptyAD(t *testing.T) {
+	k256 := MakeAEADAEGIS256Key()
+	n256 := AEADAEGIS256Nonce{}
+	Randomize(&n256)
+	if !bytes.Equal(m.AEADAEGIS256Encrypt(nil, n256, k256), m.AEADAEGIS256Encrypt(Bytes{}, n256, k256)) {
+		t.Error("AEGIS-256: nil and empty ad give different cipher texts")
+	}
+
+	k128 := MakeAEADAEGIS128LKey()
+	n128 := AEADAEGIS128LNonce{}
+	Randomize(&n128)
+	if !bytes.Equal(m.AEADAEGIS128LEncrypt(nil, n128, k128), m.AEADAEGIS128LEncrypt(Bytes{}, n128, k128)) {
+		t.Error("AEGIS-128L: nil and empty ad give different cipher texts")
+	}
+}
+
+func TestAEADAEGISConstructions(t *testing.T) {
+	if c, ok := LookupConstruction("aead_aegis256"); !ok || c.KeyBytes() != (AEADAEGIS256Key{}).Size() ||
+		c.NonceBytes() != (AEADAEGIS256Nonce{}).Size() || c.Overhead() != AEADAEGIS256Overhead() {
+		t.Errorf("AEGIS-256: got %+v, %v", c, ok)
+	}
+	if c, ok := LookupConstruction("aead_aegis128l"); !ok || c.KeyBytes() != (AEADAEGIS128LKey{}).Size() ||
+		c.NonceBytes() != (AEADAEGIS128LNonce{}).Size() || c.Overhead() != AEADAEGIS128LOverhead() {
+		t.Errorf("AEGIS-128L: got %+v, %v", c, ok)
+	}
+	if !SupportsAEGIS() {
+		t.Error("SupportsAEGIS: got false")
+	}
+}
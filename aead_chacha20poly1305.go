@@ -5,12 +5,28 @@ package sodium
 // #include <sodium.h>
 import "C"
 
+import "io"
+
 var (
 	cryptoAEADChaCha20Poly1305IETFKeyBytes  = int(C.crypto_aead_chacha20poly1305_ietf_keybytes())
 	cryptoAEADChaCha20Poly1305IETFNPubBytes = int(C.crypto_aead_chacha20poly1305_ietf_npubbytes())
 	cryptoAEADChaCha20Poly1305IETFABytes    = int(C.crypto_aead_chacha20poly1305_ietf_abytes())
 )
 
+// AEADChaCha20Poly1305Overhead returns the number of bytes AEADCPEncrypt adds
+// to a message.
+func AEADChaCha20Poly1305Overhead() int {
+	return cryptoAEADChaCha20Poly1305IETFABytes
+}
+
+// AEADCPNonce is the 96-bit nonce of the IETF ChaCha20-Poly1305 construction
+// (RFC 8439), as used by TLS and QUIC. AEADCP* interoperates with other
+// RFC 8439 implementations.
+//
+// The nonce is too short to be picked at random safely for many messages with
+// the same key. Use a counter instead: start from a fixed nonce and call
+// Next() after each message, and never repeat a nonce under the same key.
+// Prefer AEADXCP* when nonces have to be random.
 type AEADCPNonce struct {
 	Bytes
 }
@@ -31,12 +47,27 @@ func (AEADCPKey) Size() int {
 	return cryptoAEADChaCha20Poly1305IETFKeyBytes
 }
 
+func (k AEADCPKey) String() string {
+	return redacted("AEADCPKey", k.Bytes)
+}
+
 func MakeAEADCPKey() AEADCPKey {
 	b := make([]byte, cryptoAEADChaCha20Poly1305IETFKeyBytes)
 	C.crypto_aead_chacha20poly1305_ietf_keygen((*C.uchar)(&b[0]))
 	return AEADCPKey{b}
 }
 
+// MakeAEADCPKeyFrom reads the key from r instead of generating a random one.
+// A nil r is the same as MakeAEADCPKey.
+func MakeAEADCPKeyFrom(r io.Reader) (AEADCPKey, error) {
+	if r == nil {
+		return MakeAEADCPKey(), nil
+	}
+	k := AEADCPKey{}
+	err := readTyped(&k, r)
+	return k, err
+}
+
 type AEADCPMAC struct {
 	Bytes
 }
@@ -45,12 +76,20 @@ func (AEADCPMAC) Size() int {
 	return cryptoAEADChaCha20Poly1305IETFABytes
 }
 
+// Equal reports whether m and o are the same MAC, comparing them in
+// constant time with crypto_verify_16.
+func (m AEADCPMAC) Equal(o Bytes) bool {
+	return Verify16(m.Bytes, o)
+}
+
 // AEADCPEncrypt encrypts message with AEADCPKey, and AEADCPNonce.
 // Message then authenticated with additional data 'ad'.
 // Authentication tag is append to the encrypted data.
 func (b Bytes) AEADCPEncrypt(ad Bytes, n AEADCPNonce, k AEADCPKey) (c Bytes) {
 	checkTypedSize(&n, "public nonce")
 	checkTypedSize(&k, "secret key")
+	checkStrict(n.Bytes, "public nonce")
+	checkStrict(k.Bytes, "secret key")
 
 	bp, bl := plen(b)
 	c = make([]byte, bl+cryptoAEADChaCha20Poly1305IETFABytes)
@@ -84,7 +123,11 @@ func (b Bytes) AEADCPEncrypt(ad Bytes, n AEADCPNonce, k AEADCPKey) (c Bytes) {
 func (b Bytes) AEADCPDecrypt(ad Bytes, n AEADCPNonce, k AEADCPKey) (m Bytes, err error) {
 	checkTypedSize(&n, "public nonce")
 	checkTypedSize(&k, "secret key")
+	checkStrict(k.Bytes, "secret key")
 	bp, bl := plen(b)
+	if bl < cryptoAEADChaCha20Poly1305IETFABytes {
+		return nil, ErrDecryptAEAD
+	}
 	m = make([]byte, bl-cryptoAEADChaCha20Poly1305IETFABytes)
 	mp, _ := plen(m)
 	adp, adl := plen(ad)
@@ -113,6 +156,8 @@ func (b Bytes) AEADCPDecrypt(ad Bytes, n AEADCPNonce, k AEADCPKey) (m Bytes, err
 func (b Bytes) AEADCPEncryptDetached(ad Bytes, n AEADCPNonce, k AEADCPKey) (c Bytes, mac AEADCPMAC) {
 	checkTypedSize(&n, "public nonce")
 	checkTypedSize(&k, "secret key")
+	checkStrict(n.Bytes, "public nonce")
+	checkStrict(k.Bytes, "secret key")
 
 	bp, bl := plen(b)
 	adp, adl := plen(ad)
@@ -148,6 +193,7 @@ func (b Bytes) AEADCPDecryptDetached(mac AEADCPMAC, ad Bytes, n AEADCPNonce, k A
 	checkTypedSize(&mac, "public mac")
 	checkTypedSize(&n, "public nonce")
 	checkTypedSize(&k, "secret key")
+	checkStrict(k.Bytes, "secret key")
 
 	bp, bl := plen(b)
 	adp, adl := plen(ad)
@@ -175,6 +221,7 @@ func (b Bytes) AEADCPDecryptDetached(mac AEADCPMAC, ad Bytes, n AEADCPNonce, k A
 func (b Bytes) AEADCPVerify(ad Bytes, n AEADCPNonce, k AEADCPKey) (err error) {
 	checkTypedSize(&n, "public nonce")
 	checkTypedSize(&k, "secret key")
+	checkStrict(k.Bytes, "secret key")
 
 	bp, bl := plen(b)
 	adp, adl := plen(ad)
@@ -202,6 +249,7 @@ func (b Bytes) AEADCPVerifyDetached(mac AEADCPMAC, ad Bytes, n AEADCPNonce, k AE
 	checkTypedSize(&mac, "public mac")
 	checkTypedSize(&n, "public nonce")
 	checkTypedSize(&k, "secret key")
+	checkStrict(k.Bytes, "secret key")
 
 	bp, bl := plen(b)
 	adp, adl := plen(ad)
@@ -0,0 +1,117 @@
+package sodium
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// RecordMaxBytes is the largest plain text of a record written by a
+// RecordStream.
+const RecordMaxBytes = 16 * 1024 * 1024
+
+const recordHeaderBytes = 12
+
+// RecordStream writes independent XChaCha20-Poly1305 records, each one with
+// the nonce of its sequence number, as TLS does, read back by a RecordReader.
+// Unlike a secret stream, each record can be decrypted on its own given its
+// sequence number.
+//
+// A record is the big-endian uint64 sequence number, the big-endian uint32
+// length of the cipher text, then the cipher text of AEADXCPEncrypt with the
+// nonce made of 16 zero bytes followed by the sequence number. As the nonces
+// only depend on the sequence numbers, a key must only be used for a single
+// stream, e.g. a key derived for the session.
+type RecordStream struct {
+	w   io.Writer
+	key AEADXCPKey
+	seq uint64
+}
+
+// RecordReader reads the records of a RecordStream in order.
+type RecordReader struct {
+	r   io.Reader
+	key AEADXCPKey
+	seq uint64
+	err error
+}
+
+// NewRecordStream makes a RecordStream writing to w with key, starting from
+// sequence number seq.
+func NewRecordStream(w io.Writer, key AEADXCPKey, seq uint64) *RecordStream {
+	checkTypedSize(&key, "record key")
+	return &RecordStream{w: w, key: key, seq: seq}
+}
+
+func recordNonce(seq uint64) AEADXCPNonce {
+	n := AEADXCPNonce{make([]byte, cryptoAEADXChaCha20Poly1305IETFNPubBytes)}
+	binary.BigEndian.PutUint64(n.Bytes[len(n.Bytes)-8:], seq)
+	return n
+}
+
+// WriteRecord encrypts plaintext with the additional data ad as the next
+// record, and writes it to the underlying writer in a single call. It returns
+// ErrMessageTooLarge if plaintext is larger than RecordMaxBytes.
+func (s *RecordStream) WriteRecord(plaintext, ad []byte) error {
+	if len(plaintext) > RecordMaxBytes {
+		return ErrMessageTooLarge
+	}
+	c := Bytes(plaintext).AEADXCPEncrypt(ad, recordNonce(s.seq), s.key)
+	record := make([]byte, recordHeaderBytes, recordHeaderBytes+len(c))
+	binary.BigEndian.PutUint64(record, s.seq)
+	binary.BigEndian.PutUint32(record[8:], uint32(len(c)))
+	record = append(record, c...)
+	s.seq++
+	_, err := s.w.Write(record)
+	return err
+}
+
+// NewRecordReader makes a RecordReader of the records written to r by a
+// RecordStream with key, starting from sequence number seq.
+func NewRecordReader(r io.Reader, key AEADXCPKey, seq uint64) *RecordReader {
+	checkTypedSize(&key, "record key")
+	return &RecordReader{r: r, key: key, seq: seq}
+}
+
+// ReadRecord reads and decrypts the next record with the additional data ad
+// it was written with.
+//
+// It returns ErrReplay if the record isn't the next one expected, e.g. it has
+// been reordered, replayed or dropped, ErrDecryptAEAD if it has been tampered
+// with, and ErrTruncatedStream if r ends within a record. An error is returned
+// again by the following calls. It returns io.EOF if r ends after a record: the
+// records carry no end marker, so the protocol must signal the last one.
+func (r *RecordReader) ReadRecord(ad []byte) ([]byte, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	m, err := r.read(ad)
+	if err != nil {
+		r.err = err
+		return nil, err
+	}
+	r.seq++
+	return m, nil
+}
+
+func (r *RecordReader) read(ad []byte) ([]byte, error) {
+	var h [recordHeaderBytes]byte
+	if _, err := io.ReadFull(r.r, h[:]); err == io.ErrUnexpectedEOF {
+		return nil, ErrTruncatedStream
+	} else if err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint64(h[:]) != r.seq {
+		return nil, ErrReplay
+	}
+	l := int(binary.BigEndian.Uint32(h[8:]))
+	if l < cryptoAEADXChaCha20Poly1305IETFABytes || l > RecordMaxBytes+cryptoAEADXChaCha20Poly1305IETFABytes {
+		return nil, ErrDecryptAEAD
+	}
+	c := make(Bytes, l)
+	if _, err := io.ReadFull(r.r, c); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, ErrTruncatedStream
+	} else if err != nil {
+		return nil, err
+	}
+	return c.AEADXCPDecrypt(ad, recordNonce(r.seq), r.key)
+}
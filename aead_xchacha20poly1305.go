@@ -5,12 +5,20 @@ package sodium
 // #include <sodium.h>
 import "C"
 
+import "io"
+
 var (
 	cryptoAEADXChaCha20Poly1305IETFKeyBytes  = int(C.crypto_aead_xchacha20poly1305_ietf_keybytes())
 	cryptoAEADXChaCha20Poly1305IETFNPubBytes = int(C.crypto_aead_xchacha20poly1305_ietf_npubbytes())
 	cryptoAEADXChaCha20Poly1305IETFABytes    = int(C.crypto_aead_xchacha20poly1305_ietf_abytes())
 )
 
+// AEADXChaCha20Poly1305Overhead returns the number of bytes AEADXCPEncrypt
+// adds to a message.
+func AEADXChaCha20Poly1305Overhead() int {
+	return cryptoAEADXChaCha20Poly1305IETFABytes
+}
+
 type AEADXCPNonce struct {
 	Bytes
 }
@@ -33,10 +41,25 @@ func MakeAEADXCPKey() AEADXCPKey {
 	return AEADXCPKey{b}
 }
 
+// MakeAEADXCPKeyFrom reads the key from r instead of generating a random one.
+// A nil r is the same as MakeAEADXCPKey.
+func MakeAEADXCPKeyFrom(r io.Reader) (AEADXCPKey, error) {
+	if r == nil {
+		return MakeAEADXCPKey(), nil
+	}
+	k := AEADXCPKey{}
+	err := readTyped(&k, r)
+	return k, err
+}
+
 func (AEADXCPKey) Size() int {
 	return cryptoAEADXChaCha20Poly1305IETFKeyBytes
 }
 
+func (k AEADXCPKey) String() string {
+	return redacted("AEADXCPKey", k.Bytes)
+}
+
 type AEADXCPMAC struct {
 	Bytes
 }
@@ -45,12 +68,20 @@ func (AEADXCPMAC) Size() int {
 	return cryptoAEADXChaCha20Poly1305IETFABytes
 }
 
+// Equal reports whether m and o are the same MAC, comparing them in
+// constant time with crypto_verify_16.
+func (m AEADXCPMAC) Equal(o Bytes) bool {
+	return Verify16(m.Bytes, o)
+}
+
 // AEADXCPEncrypt encrypts message with AEADXCPKey, and AEADXCPNonce.
 // Message then authenticated with additional data 'ad'.
 // Authentication tag is append to the encrypted data.
 func (b Bytes) AEADXCPEncrypt(ad Bytes, n AEADXCPNonce, k AEADXCPKey) (c Bytes) {
 	checkTypedSize(&n, "public nonce")
 	checkTypedSize(&k, "secret key")
+	checkStrict(n.Bytes, "public nonce")
+	checkStrict(k.Bytes, "secret key")
 
 	bp, bl := plen(b)
 	c = make([]byte, bl+cryptoAEADXChaCha20Poly1305IETFABytes)
@@ -84,7 +115,11 @@ func (b Bytes) AEADXCPEncrypt(ad Bytes, n AEADXCPNonce, k AEADXCPKey) (c Bytes)
 func (b Bytes) AEADXCPDecrypt(ad Bytes, n AEADXCPNonce, k AEADXCPKey) (m Bytes, err error) {
 	checkTypedSize(&n, "public nonce")
 	checkTypedSize(&k, "secret key")
+	checkStrict(k.Bytes, "secret key")
 	bp, bl := plen(b)
+	if bl < cryptoAEADXChaCha20Poly1305IETFABytes {
+		return nil, ErrDecryptAEAD
+	}
 	m = make([]byte, bl-cryptoAEADXChaCha20Poly1305IETFABytes)
 	mp, _ := plen(m)
 	adp, adl := plen(ad)
@@ -113,6 +148,8 @@ func (b Bytes) AEADXCPDecrypt(ad Bytes, n AEADXCPNonce, k AEADXCPKey) (m Bytes,
 func (b Bytes) AEADXCPEncryptDetached(ad Bytes, n AEADXCPNonce, k AEADXCPKey) (c Bytes, mac AEADXCPMAC) {
 	checkTypedSize(&n, "public nonce")
 	checkTypedSize(&k, "secret key")
+	checkStrict(n.Bytes, "public nonce")
+	checkStrict(k.Bytes, "secret key")
 
 	bp, bl := plen(b)
 	adp, adl := plen(ad)
@@ -148,6 +185,7 @@ func (b Bytes) AEADXCPDecryptDetached(mac AEADXCPMAC, ad Bytes, n AEADXCPNonce,
 	checkTypedSize(&mac, "public mac")
 	checkTypedSize(&n, "public nonce")
 	checkTypedSize(&k, "secret key")
+	checkStrict(k.Bytes, "secret key")
 
 	bp, bl := plen(b)
 	adp, adl := plen(ad)
@@ -175,6 +213,7 @@ func (b Bytes) AEADXCPDecryptDetached(mac AEADXCPMAC, ad Bytes, n AEADXCPNonce,
 func (b Bytes) AEADXCPVerify(ad Bytes, n AEADXCPNonce, k AEADXCPKey) (err error) {
 	checkTypedSize(&n, "public nonce")
 	checkTypedSize(&k, "secret key")
+	checkStrict(k.Bytes, "secret key")
 
 	bp, bl := plen(b)
 	adp, adl := plen(ad)
@@ -202,6 +241,7 @@ func (b Bytes) AEADXCPVerifyDetached(mac AEADXCPMAC, ad Bytes, n AEADXCPNonce, k
 	checkTypedSize(&mac, "public mac")
 	checkTypedSize(&n, "public nonce")
 	checkTypedSize(&k, "secret key")
+	checkStrict(k.Bytes, "secret key")
 
 	bp, bl := plen(b)
 	adp, adl := plen(ad)
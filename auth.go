@@ -5,6 +5,8 @@ package sodium
 // #include <sodium.h>
 import "C"
 
+import "unsafe"
+
 var (
 	cryptoAuthBytes    = int(C.crypto_auth_bytes())
 	cryptoAuthKeyBytes = int(C.crypto_auth_keybytes())
@@ -18,6 +20,10 @@ func (b MACKey) Size() int {
 	return cryptoAuthKeyBytes
 }
 
+func (k MACKey) String() string {
+	return redacted("MACKey", k.Bytes)
+}
+
 // MAC stores Message Authentication Code produced by HMAC-SHA512256.
 type MAC struct {
 	Bytes
@@ -27,9 +33,16 @@ func (b MAC) Size() int {
 	return cryptoAuthBytes
 }
 
+// Equal reports whether b and o are the same MAC, comparing them in
+// constant time with crypto_verify_32.
+func (b MAC) Equal(o Bytes) bool {
+	return Verify32(b.Bytes, o)
+}
+
 // Auth generates a MAC for the message with the secret 'key'.
 func (b Bytes) Auth(key MACKey) (mac MAC) {
 	checkTypedSize(&key, "Secret Key")
+	checkStrict(key.Bytes, "Secret Key")
 	o := make([]byte, cryptoAuthBytes)
 
 	bp, bl := plen(b)
@@ -51,6 +64,7 @@ func (b Bytes) Auth(key MACKey) (mac MAC) {
 func (b Bytes) AuthVerify(mac MAC, key MACKey) (err error) {
 	checkTypedSize(&key, "Secret Key")
 	checkTypedSize(&mac, "MAC")
+	checkStrict(key.Bytes, "Secret Key")
 
 	bp, bl := plen(b)
 	if int(C.crypto_auth_verify(
@@ -63,3 +77,70 @@ func (b Bytes) AuthVerify(mac MAC, key MACKey) (err error) {
 
 	return
 }
+
+// AuthState computes a MAC incrementally, the same as Auth does at once, e.g.
+// to authenticate a file without reading it in memory.
+type AuthState struct {
+	state C.crypto_auth_hmacsha512256_state
+	mac   MAC
+}
+
+// MakeAuthState starts computing a MAC with the secret 'key'.
+func MakeAuthState(key MACKey) *AuthState {
+	checkTypedSize(&key, "Secret Key")
+	checkStrict(key.Bytes, "Secret Key")
+	s := &AuthState{}
+	if int(C.crypto_auth_hmacsha512256_init(
+		&s.state,
+		(*C.uchar)(&key.Bytes[0]),
+		(C.size_t)(key.Length()))) != 0 {
+		panic("see libsodium")
+	}
+	return s
+}
+
+// Write adds p to the authenticated message. It returns ErrInvalidState after
+// Finalize.
+//
+// Implements io.Writer
+func (s *AuthState) Write(p []byte) (n int, err error) {
+	if s.mac.Bytes != nil {
+		return 0, ErrInvalidState
+	}
+	pp, pl := plen(p)
+	if int(C.crypto_auth_hmacsha512256_update(
+		&s.state,
+		(*C.uchar)(pp),
+		(C.ulonglong)(pl))) != 0 {
+		panic("see libsodium")
+	}
+	return pl, nil
+}
+
+// Finalize returns the MAC of the message written. The state is wiped, and
+// the following calls return the same MAC.
+func (s *AuthState) Finalize() MAC {
+	if s.mac.Bytes != nil {
+		return s.mac
+	}
+	o := make([]byte, cryptoAuthBytes)
+	if int(C.crypto_auth_hmacsha512256_final(
+		&s.state,
+		(*C.uchar)(&o[0]))) != 0 {
+		panic("see libsodium")
+	}
+	C.sodium_memzero(unsafe.Pointer(&s.state), C.size_t(unsafe.Sizeof(s.state)))
+	s.mac = MAC{o}
+	return s.mac
+}
+
+// FinalizeVerify verifies the message written with the MAC, in constant time.
+//
+// It returns an error if verification failed.
+func (s *AuthState) FinalizeVerify(mac MAC) (err error) {
+	checkTypedSize(&mac, "MAC")
+	if !s.Finalize().Equal(mac.Bytes) {
+		err = ErrAuth
+	}
+	return
+}
@@ -0,0 +1,157 @@
+package sodium
+
+// #cgo pkg-config: libsodium
+// #include <stdlib.h>
+// #include <sodium.h>
+import "C"
+
+import "unsafe"
+
+var (
+	cryptoAuthHMACSHA256Bytes    = int(C.crypto_auth_hmacsha256_bytes())
+	cryptoAuthHMACSHA256KeyBytes = int(C.crypto_auth_hmacsha256_keybytes())
+)
+
+// HMACSHA256Key is the secret key of HMAC-SHA-256.
+type HMACSHA256Key struct {
+	Bytes
+}
+
+func (HMACSHA256Key) Size() int {
+	return cryptoAuthHMACSHA256KeyBytes
+}
+
+func (k HMACSHA256Key) String() string {
+	return redacted("HMACSHA256Key", k.Bytes)
+}
+
+// MakeHMACSHA256Key generates a random HMACSHA256Key.
+func MakeHMACSHA256Key() HMACSHA256Key {
+	k := HMACSHA256Key{make([]byte, cryptoAuthHMACSHA256KeyBytes)}
+	C.crypto_auth_hmacsha256_keygen((*C.uchar)(&k.Bytes[0]))
+	return k
+}
+
+// HMACSHA256MAC stores the 32-byte Message Authentication Code produced by
+// HMAC-SHA-256.
+type HMACSHA256MAC struct {
+	Bytes
+}
+
+func (HMACSHA256MAC) Size() int {
+	return cryptoAuthHMACSHA256Bytes
+}
+
+// Equal reports whether m and o are the same MAC, comparing them in
+// constant time with crypto_verify_32.
+func (m HMACSHA256MAC) Equal(o Bytes) bool {
+	return Verify32(m.Bytes, o)
+}
+
+// AuthHMACSHA256 generates the HMAC-SHA-256 of the message with the secret
+// 'key', e.g. for standards requiring this variant instead of the
+// HMAC-SHA-512-256 of Auth.
+func (b Bytes) AuthHMACSHA256(key HMACSHA256Key) (mac HMACSHA256MAC) {
+	checkTypedSize(&key, "Secret Key")
+	checkStrict(key.Bytes, "Secret Key")
+	o := make([]byte, cryptoAuthHMACSHA256Bytes)
+
+	bp, bl := plen(b)
+	if int(C.crypto_auth_hmacsha256(
+		(*C.uchar)(&o[0]),
+		(*C.uchar)(bp),
+		(C.ulonglong)(bl),
+		(*C.uchar)(&key.Bytes[0]))) != 0 {
+		panic("see libsodium")
+	}
+	mac = HMACSHA256MAC{o}
+
+	return
+}
+
+// AuthHMACSHA256Verify verifies a message with its HMAC-SHA-256 and the secret
+// 'key'.
+//
+// It returns an error if verification failed.
+func (b Bytes) AuthHMACSHA256Verify(mac HMACSHA256MAC, key HMACSHA256Key) (err error) {
+	checkTypedSize(&key, "Secret Key")
+	checkTypedSize(&mac, "MAC")
+	checkStrict(key.Bytes, "Secret Key")
+
+	bp, bl := plen(b)
+	if int(C.crypto_auth_hmacsha256_verify(
+		(*C.uchar)(&mac.Bytes[0]),
+		(*C.uchar)(bp),
+		(C.ulonglong)(bl),
+		(*C.uchar)(&key.Bytes[0]))) != 0 {
+		err = ErrAuth
+	}
+
+	return
+}
+
+// HMACSHA256State computes a HMAC-SHA-256 incrementally, like AuthState.
+type HMACSHA256State struct {
+	state C.crypto_auth_hmacsha256_state
+	mac   HMACSHA256MAC
+}
+
+// MakeHMACSHA256State starts computing a HMAC-SHA-256 with the secret 'key'.
+func MakeHMACSHA256State(key HMACSHA256Key) *HMACSHA256State {
+	checkTypedSize(&key, "Secret Key")
+	checkStrict(key.Bytes, "Secret Key")
+	s := &HMACSHA256State{}
+	if int(C.crypto_auth_hmacsha256_init(
+		&s.state,
+		(*C.uchar)(&key.Bytes[0]),
+		(C.size_t)(key.Length()))) != 0 {
+		panic("see libsodium")
+	}
+	return s
+}
+
+// Write adds p to the authenticated message. It returns ErrInvalidState after
+// Finalize.
+//
+// Implements io.Writer
+func (s *HMACSHA256State) Write(p []byte) (n int, err error) {
+	if s.mac.Bytes != nil {
+		return 0, ErrInvalidState
+	}
+	pp, pl := plen(p)
+	if int(C.crypto_auth_hmacsha256_update(
+		&s.state,
+		(*C.uchar)(pp),
+		(C.ulonglong)(pl))) != 0 {
+		panic("see libsodium")
+	}
+	return pl, nil
+}
+
+// Finalize returns the MAC of the message written. The state is wiped, and
+// the following calls return the same MAC.
+func (s *HMACSHA256State) Finalize() HMACSHA256MAC {
+	if s.mac.Bytes != nil {
+		return s.mac
+	}
+	o := make([]byte, cryptoAuthHMACSHA256Bytes)
+	if int(C.crypto_auth_hmacsha256_final(
+		&s.state,
+		(*C.uchar)(&o[0]))) != 0 {
+		panic("see libsodium")
+	}
+	C.sodium_memzero(unsafe.Pointer(&s.state), C.size_t(unsafe.Sizeof(s.state)))
+	s.mac = HMACSHA256MAC{o}
+	return s.mac
+}
+
+// FinalizeVerify verifies the message written with the MAC, in constant time.
+//
+// It returns an error if verification failed.
+func (s *HMACSHA256State) FinalizeVerify(mac HMACSHA256MAC) (err error) {
+	checkTypedSize(&mac, "MAC")
+	if !s.Finalize().Equal(mac.Bytes) {
+		err = ErrAuth
+	}
+	return
+}
@@ -0,0 +1,157 @@
+package sodium
+
+// #cgo pkg-config: libsodium
+// #include <stdlib.h>
+// #include <sodium.h>
+import "C"
+
+import "unsafe"
+
+var (
+	cryptoAuthHMACSHA512Bytes    = int(C.crypto_auth_hmacsha512_bytes())
+	cryptoAuthHMACSHA512KeyBytes = int(C.crypto_auth_hmacsha512_keybytes())
+)
+
+// HMACSHA512Key is the secret key of HMAC-SHA-512.
+type HMACSHA512Key struct {
+	Bytes
+}
+
+func (HMACSHA512Key) Size() int {
+	return cryptoAuthHMACSHA512KeyBytes
+}
+
+func (k HMACSHA512Key) String() string {
+	return redacted("HMACSHA512Key", k.Bytes)
+}
+
+// MakeHMACSHA512Key generates a random HMACSHA512Key.
+func MakeHMACSHA512Key() HMACSHA512Key {
+	k := HMACSHA512Key{make([]byte, cryptoAuthHMACSHA512KeyBytes)}
+	C.crypto_auth_hmacsha512_keygen((*C.uchar)(&k.Bytes[0]))
+	return k
+}
+
+// HMACSHA512MAC stores the 64-byte Message Authentication Code produced by
+// HMAC-SHA-512.
+type HMACSHA512MAC struct {
+	Bytes
+}
+
+func (HMACSHA512MAC) Size() int {
+	return cryptoAuthHMACSHA512Bytes
+}
+
+// Equal reports whether m and o are the same MAC, comparing them in
+// constant time with crypto_verify_64.
+func (m HMACSHA512MAC) Equal(o Bytes) bool {
+	return Verify64(m.Bytes, o)
+}
+
+// AuthHMACSHA512 generates the HMAC-SHA-512 of the message with the secret
+// 'key', e.g. for standards requiring this variant instead of the
+// HMAC-SHA-512-256 of Auth.
+func (b Bytes) AuthHMACSHA512(key HMACSHA512Key) (mac HMACSHA512MAC) {
+	checkTypedSize(&key, "Secret Key")
+	checkStrict(key.Bytes, "Secret Key")
+	o := make([]byte, cryptoAuthHMACSHA512Bytes)
+
+	bp, bl := plen(b)
+	if int(C.crypto_auth_hmacsha512(
+		(*C.uchar)(&o[0]),
+		(*C.uchar)(bp),
+		(C.ulonglong)(bl),
+		(*C.uchar)(&key.Bytes[0]))) != 0 {
+		panic("see libsodium")
+	}
+	mac = HMACSHA512MAC{o}
+
+	return
+}
+
+// AuthHMACSHA512Verify verifies a message with its HMAC-SHA-512 and the secret
+// 'key'.
+//
+// It returns an error if verification failed.
+func (b Bytes) AuthHMACSHA512Verify(mac HMACSHA512MAC, key HMACSHA512Key) (err error) {
+	checkTypedSize(&key, "Secret Key")
+	checkTypedSize(&mac, "MAC")
+	checkStrict(key.Bytes, "Secret Key")
+
+	bp, bl := plen(b)
+	if int(C.crypto_auth_hmacsha512_verify(
+		(*C.uchar)(&mac.Bytes[0]),
+		(*C.uchar)(bp),
+		(C.ulonglong)(bl),
+		(*C.uchar)(&key.Bytes[0]))) != 0 {
+		err = ErrAuth
+	}
+
+	return
+}
+
+// HMACSHA512State computes a HMAC-SHA-512 incrementally, like AuthState.
+type HMACSHA512State struct {
+	state C.crypto_auth_hmacsha512_state
+	mac   HMACSHA512MAC
+}
+
+// MakeHMACSHA512State starts computing a HMAC-SHA-512 with the secret 'key'.
+func MakeHMACSHA512State(key HMACSHA512Key) *HMACSHA512State {
+	checkTypedSize(&key, "Secret Key")
+	checkStrict(key.Bytes, "Secret Key")
+	s := &HMACSHA512State{}
+	if int(C.crypto_auth_hmacsha512_init(
+		&s.state,
+		(*C.uchar)(&key.Bytes[0]),
+		(C.size_t)(key.Length()))) != 0 {
+		panic("see libsodium")
+	}
+	return s
+}
+
+// Write adds p to the authenticated message. It returns ErrInvalidState after
+// Finalize.
+//
+// Implements io.Writer
+func (s *HMACSHA512State) Write(p []byte) (n int, err error) {
+	if s.mac.Bytes != nil {
+		return 0, ErrInvalidState
+	}
+	pp, pl := plen(p)
+	if int(C.crypto_auth_hmacsha512_update(
+		&s.state,
+		(*C.uchar)(pp),
+		(C.ulonglong)(pl))) != 0 {
+		panic("see libsodium")
+	}
+	return pl, nil
+}
+
+// Finalize returns the MAC of the message written. The state is wiped, and
+// the following calls return the same MAC.
+func (s *HMACSHA512State) Finalize() HMACSHA512MAC {
+	if s.mac.Bytes != nil {
+		return s.mac
+	}
+	o := make([]byte, cryptoAuthHMACSHA512Bytes)
+	if int(C.crypto_auth_hmacsha512_final(
+		&s.state,
+		(*C.uchar)(&o[0]))) != 0 {
+		panic("see libsodium")
+	}
+	C.sodium_memzero(unsafe.Pointer(&s.state), C.size_t(unsafe.Sizeof(s.state)))
+	s.mac = HMACSHA512MAC{o}
+	return s.mac
+}
+
+// FinalizeVerify verifies the message written with the MAC, in constant time.
+//
+// It returns an error if verification failed.
+func (s *HMACSHA512State) FinalizeVerify(mac HMACSHA512MAC) (err error) {
+	checkTypedSize(&mac, "MAC")
+	if !s.Finalize().Equal(mac.Bytes) {
+		err = ErrAuth
+	}
+	return
+}
@@ -0,0 +1,122 @@
+package sodium
+
+import "io"
+
+const authReadBytes = 4096
+
+type authenticatedWriter struct {
+	w      io.Writer
+	state  *AuthState
+	closed bool
+	err    error
+}
+
+type authenticatedReader struct {
+	r     io.Reader
+	state *AuthState
+	buf   []byte
+	n     int
+	ended bool
+	err   error
+}
+
+// MakeAuthenticatedWriter returns a writer passing the data through to w and
+// computing its MAC with key, as Auth does, which Close writes after it as a
+// trailer of 32 bytes. Close doesn't close w.
+//
+// With NewStreamCipherWriter it makes encrypt-then-MAC, e.g. for a wire format
+// of cipher text followed by its MAC: the MAC key must then be independent
+// from the encryption key, as the ones of DeriveEncryptAuthKeys.
+//
+// An error writing to w is returned by the current and all following calls.
+func MakeAuthenticatedWriter(key MACKey, w io.Writer) io.WriteCloser {
+	return &authenticatedWriter{w: w, state: MakeAuthState(key)}
+}
+
+func (w *authenticatedWriter) Write(b []byte) (n int, err error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.closed {
+		return 0, ErrInvalidState
+	}
+	n, err = w.w.Write(b)
+	w.state.Write(b[:n])
+	if err != nil {
+		w.err = err
+	}
+	return
+}
+
+func (w *authenticatedWriter) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+	if w.err != nil {
+		return w.err
+	}
+	_, w.err = w.w.Write(w.state.Finalize().Bytes)
+	return w.err
+}
+
+// MakeAuthenticatedReader returns a reader of the data written by
+// MakeAuthenticatedWriter to r, holding back the trailing MAC. The MAC is
+// verified when r ends: the reader returns io.EOF only if it matches, and
+// ErrAuth if the data or the MAC has been tampered with or truncated.
+//
+// The data is returned before it is verified, so it must not be used until
+// io.EOF, e.g. it should be written to a temporary file or decrypted into a
+// buffer, and dropped on any other error.
+func MakeAuthenticatedReader(key MACKey, r io.Reader) io.Reader {
+	return &authenticatedReader{
+		r:     r,
+		state: MakeAuthState(key),
+		buf:   make([]byte, cryptoAuthBytes+authReadBytes),
+	}
+}
+
+func (r *authenticatedReader) Read(b []byte) (n int, err error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	for {
+		// The last cryptoAuthBytes read may be the MAC.
+		if l := r.n - cryptoAuthBytes; l > 0 {
+			n = copy(b, r.buf[:l])
+			r.state.Write(b[:n])
+			r.n = copy(r.buf, r.buf[n:r.n])
+			return n, nil
+		}
+		// Verify once r has ended and only the MAC is left.
+		if r.ended && r.err == nil {
+			r.err = r.verify()
+		}
+		if r.err != nil {
+			return 0, r.err
+		}
+		m, err := r.r.Read(r.buf[r.n:])
+		r.n += m
+		if m == 0 && err == nil {
+			return 0, nil
+		}
+		if err == io.EOF {
+			r.ended = true
+		} else if err != nil {
+			r.err = err
+		}
+	}
+}
+
+// verify checks the buffered MAC at the end of the data.
+func (r *authenticatedReader) verify() error {
+	if r.n != cryptoAuthBytes {
+		return ErrAuth
+	}
+	mac := MAC{r.buf[:cryptoAuthBytes]}
+	r.n = 0
+	if r.state.FinalizeVerify(mac) != nil {
+		return ErrAuth
+	}
+	return io.EOF
+}
@@ -5,6 +5,8 @@ package sodium
 // #include <sodium.h>
 import "C"
 
+import "crypto/subtle"
+
 var (
 	cryptoBoxSeedBytes      = int(C.crypto_box_seedbytes())
 	cryptoBoxPublicKeyBytes = int(C.crypto_box_publickeybytes())
@@ -14,6 +16,16 @@ var (
 	cryptoBoxMacBytes       = int(C.crypto_box_macbytes())
 )
 
+// BoxOverhead returns the number of bytes Box adds to a message.
+func BoxOverhead() int {
+	return cryptoBoxMacBytes
+}
+
+// SealedBoxOverhead returns the number of bytes SealedBox adds to a message.
+func SealedBoxOverhead() int {
+	return cryptoBoxSealBytes
+}
+
 type BoxKP struct {
 	PublicKey BoxPublicKey
 	SecretKey BoxSecretKey
@@ -27,6 +39,53 @@ func (k BoxPublicKey) Size() int {
 	return cryptoBoxPublicKeyBytes
 }
 
+// boxWeakPublicKeys are the encodings of the Curve25519 points of order 1, 2,
+// 4 and 8, with the non-canonical encodings of 0 and 1 (p and p+1). X25519
+// ignores the top bit, so it is cleared before comparing.
+var boxWeakPublicKeys = [][32]byte{
+	// 0 (order 4)
+	{},
+	// 1 (order 1)
+	{0x01},
+	// order 8
+	{0xe0, 0xeb, 0x7a, 0x7c, 0x3b, 0x41, 0xb8, 0xae, 0x16, 0x56, 0xe3, 0xfa, 0xf1, 0x9f, 0xc4, 0x6a,
+		0xda, 0x09, 0x8d, 0xeb, 0x9c, 0x32, 0xb1, 0xfd, 0x86, 0x62, 0x05, 0x16, 0x5f, 0x49, 0xb8, 0x00},
+	// order 8
+	{0x5f, 0x9c, 0x95, 0xbc, 0xa3, 0x50, 0x8c, 0x24, 0xb1, 0xd0, 0xb1, 0x55, 0x9c, 0x83, 0xef, 0x5b,
+		0x04, 0x44, 0x5c, 0xc4, 0x58, 0x1c, 0x8e, 0x86, 0xd8, 0x22, 0x4e, 0xdd, 0xd0, 0x9f, 0x11, 0x57},
+	// p-1 (order 2)
+	{0xec, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f},
+	// p, i.e. 0 (order 4)
+	{0xed, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f},
+	// p+1, i.e. 1 (order 1)
+	{0xee, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f},
+}
+
+// IsWeak reports whether k is a low-order point, for which the shared secret
+// with any secret key is predictable. Such keys can only come from a peer
+// trying a small-subgroup attack, and should be rejected when received.
+//
+// The comparison is done in constant time.
+func (k BoxPublicKey) IsWeak() bool {
+	checkTypedSize(&k, "PublicKey")
+
+	var u [32]byte
+	copy(u[:], k.Bytes)
+	u[31] &= 0x7f
+	weak := 0
+	for _, w := range boxWeakPublicKeys {
+		var acc byte
+		for i := range w {
+			acc |= u[i] ^ w[i]
+		}
+		weak |= subtle.ConstantTimeByteEq(acc, 0)
+	}
+	return weak == 1
+}
+
 type BoxSecretKey struct {
 	Bytes
 }
@@ -35,6 +94,10 @@ func (k BoxSecretKey) Size() int {
 	return cryptoBoxSecretKeyBytes
 }
 
+func (k BoxSecretKey) String() string {
+	return redacted("BoxSecretKey", k.Bytes)
+}
+
 // PublicKey calculates public key from BoxSecretKey.
 func (k BoxSecretKey) PublicKey() BoxPublicKey {
 	checkTypedSize(&k, "SecretKey")
@@ -50,6 +113,10 @@ func (b BoxSeed) Size() int {
 	return cryptoBoxSeedBytes
 }
 
+func (k BoxSeed) String() string {
+	return redacted("BoxSeed", k.Bytes)
+}
+
 type BoxNonce struct {
 	Bytes
 }
@@ -70,6 +137,12 @@ func (b BoxMAC) Size() int {
 	return cryptoBoxMacBytes
 }
 
+// Equal reports whether b and o are the same MAC, comparing them in
+// constant time with crypto_verify_16.
+func (b BoxMAC) Equal(o Bytes) bool {
+	return Verify16(b.Bytes, o)
+}
+
 // MakeBoxKP generates a keypair for Box
 func MakeBoxKP() BoxKP {
 	pkb := make([]byte, cryptoBoxPublicKeyBytes)
@@ -106,6 +179,28 @@ func SeedBoxKP(seed BoxSeed) BoxKP {
 	}
 }
 
+// BoxKPFromScalar uses the scalar directly as the SecretKey, unlike SeedBoxKP
+// which hashes its seed.
+//
+// The scalar is clamped as X25519 does: the lowest 3 bits are cleared, the
+// highest bit is cleared and the second highest bit is set. The SecretKey
+// holds the clamped scalar, so any two scalars only differing in these bits
+// give the same key pair.
+func BoxKPFromScalar(s Scalar) BoxKP {
+	checkTypedSize(&s, "scalar")
+	skb := make([]byte, cryptoBoxSecretKeyBytes)
+	copy(skb, s.Bytes)
+	skb[0] &= 248
+	skb[31] &= 127
+	skb[31] |= 64
+	sk := BoxSecretKey{skb}
+
+	return BoxKP{
+		sk.PublicKey(),
+		sk,
+	}
+}
+
 // SealedBox puts message into a sealed box using receiver's PublicKey and an
 // ephemeral key pair of which the SecretKey is destroyed on sender's side
 // right after encryption, and the PublicKey is packed with the Box to the
@@ -135,6 +230,9 @@ func (b Bytes) SealedBoxOpen(kp BoxKP) (m Bytes, err error) {
 	checkTypedSize(&kp.PublicKey, "receiver's PublicKey")
 	checkTypedSize(&kp.SecretKey, "receiver's SecretKey")
 	bp, bl := plen(b)
+	if bl < cryptoBoxSealBytes {
+		return nil, ErrOpenBox
+	}
 	m = make([]byte, b.Length()-cryptoBoxSealBytes)
 	mp, _ := plen(m)
 	if int(C.crypto_box_seal_open(
@@ -156,6 +254,7 @@ func (b Bytes) Box(n BoxNonce, pk BoxPublicKey, sk BoxSecretKey) (c Bytes) {
 	checkTypedSize(&n, "nonce")
 	checkTypedSize(&pk, "receiver's public key")
 	checkTypedSize(&sk, "sender's secret key")
+	checkStrict(n.Bytes, "nonce")
 	bp, bl := plen(b)
 	c = make([]byte, b.Length()+cryptoBoxMacBytes)
 	if int(C.crypto_box_easy(
@@ -180,6 +279,9 @@ func (b Bytes) BoxOpen(n BoxNonce, pk BoxPublicKey, sk BoxSecretKey) (m Bytes, e
 	checkTypedSize(&pk, "receiver's public key")
 	checkTypedSize(&sk, "sender's secret key")
 	bp, bl := plen(b)
+	if bl < cryptoBoxMacBytes {
+		return nil, ErrOpenBox
+	}
 	m = make([]byte, b.Length()-cryptoBoxMacBytes)
 	mp, _ := plen(m)
 	if int(C.crypto_box_open_easy(
@@ -204,6 +306,7 @@ func (b Bytes) BoxDetached(n BoxNonce, pk BoxPublicKey, sk BoxSecretKey) (mac Bo
 	checkTypedSize(&n, "nonce")
 	checkTypedSize(&pk, "receiver's public key")
 	checkTypedSize(&sk, "sender's secret key")
+	checkStrict(n.Bytes, "nonce")
 	bp, bl := plen(b)
 	c = make([]byte, bl)
 	cp, _ := plen(c)
@@ -248,3 +351,117 @@ func (b Bytes) BoxOpenDetached(mac BoxMAC, n BoxNonce, pk BoxPublicKey, sk BoxSe
 
 	return
 }
+
+// BoxSealNonce puts message into an authenticated encrypted box like Box, with
+// a random nonce generated for the message and prepended to the box.
+//
+// Not to be confused with the anonymous SealedBox.
+func (b Bytes) BoxSealNonce(pk BoxPublicKey, sk BoxSecretKey) (c Bytes) {
+	n := BoxNonce{}
+	Randomize(&n)
+	bc := b.Box(n, pk, sk)
+	c = make([]byte, 0, n.Length()+bc.Length())
+	c = append(c, n.Bytes...)
+	c = append(c, bc...)
+
+	return
+}
+
+// BoxOpenSealNonce reads message from a box made by BoxSealNonce using
+// receiver's SecretKey and sender's PublicKey.
+//
+// It returns an error if opening failed.
+func (b Bytes) BoxOpenSealNonce(pk BoxPublicKey, sk BoxSecretKey) (m Bytes, err error) {
+	if b.Length() < cryptoBoxNonceBytes+cryptoBoxMacBytes {
+		return nil, ErrOpenBox
+	}
+	n := BoxNonce{b[:cryptoBoxNonceBytes]}
+
+	return b[cryptoBoxNonceBytes:].BoxOpen(n, pk, sk)
+}
+
+// SealedBoxWithKP is like SealedBox, but encrypts with the ephemeral key pair
+// given by the caller, so several messages of an anonymous session can share
+// it. The box is the ephemeral PublicKey, followed by a random nonce and the
+// Box, and is opened by SealedBoxWithKPOpen, not SealedBoxOpen.
+//
+// The sender stays anonymous, but reusing the key pair makes its messages
+// linkable: the receiver, and anyone seeing the boxes, can tell that they come
+// from the same sender. Anyone knowing the ephemeral SecretKey can open all of
+// them, so it should be used for a single session and wiped afterwards. Use
+// SealedBox for messages which must not be linked.
+func (b Bytes) SealedBoxWithKP(pk BoxPublicKey, ephemeral BoxKP) (cm Bytes) {
+	checkTypedSize(&ephemeral.PublicKey, "ephemeral PublicKey")
+	bc := b.BoxSealNonce(pk, ephemeral.SecretKey)
+	cm = make([]byte, 0, ephemeral.PublicKey.Length()+bc.Length())
+	cm = append(cm, ephemeral.PublicKey.Bytes...)
+	cm = append(cm, bc...)
+
+	return
+}
+
+// SealedBoxWithKPOpen reads message from a box made by SealedBoxWithKP using
+// the receiver's key pair. It also returns the ephemeral PublicKey of the
+// sender, the same for all messages of a session.
+//
+// It returns an error if opening failed.
+func (b Bytes) SealedBoxWithKPOpen(kp BoxKP) (m Bytes, ephemeral BoxPublicKey, err error) {
+	if b.Length() < cryptoBoxPublicKeyBytes+cryptoBoxNonceBytes+cryptoBoxMacBytes {
+		return nil, BoxPublicKey{}, ErrOpenBox
+	}
+	ephemeral = BoxPublicKey{b[:cryptoBoxPublicKeyBytes:cryptoBoxPublicKeyBytes]}
+	if m, err = b[cryptoBoxPublicKeyBytes:].BoxOpenSealNonce(ephemeral, kp.SecretKey); err != nil {
+		return nil, BoxPublicKey{}, err
+	}
+
+	return
+}
+
+var sealedBoxContextDomain = []byte("sodium sealed box context")
+
+// SealedBoxWithContext is SealedBox with the message bound to context, e.g. a
+// protocol name or the recipient's identifier, and to pk. The box is opened
+// by SealedBoxWithContextOpen with the same context, not SealedBoxOpen.
+//
+// The sealed message is the 32-byte BLAKE2b of the domain, context and pk,
+// each prefixed by its length as by ADBuilder, followed by the message. A
+// recipient re-sealing the message for another key, or a box sealed for
+// another context, is rejected on opening. The box is
+// SealedBoxOverhead()+32 bytes longer than the message.
+func (b Bytes) SealedBoxWithContext(pk BoxPublicKey, context []byte) (cm Bytes) {
+	checkTypedSize(&pk, "PublicKey")
+	inner := sealedBoxContextTag(pk, context)
+	inner = append(inner, b...)
+	cm = inner.SealedBox(pk)
+	MemZero(inner)
+
+	return
+}
+
+// SealedBoxWithContextOpen reads message from a box made by
+// SealedBoxWithContext with the receiver's key pair and the same context.
+//
+// It returns ErrOpenBox if opening failed, including when the box was sealed
+// for another context or another key.
+func (b Bytes) SealedBoxWithContextOpen(kp BoxKP, context []byte) (m Bytes, err error) {
+	if b.Length() < cryptoBoxSealBytes+cryptoGenericHashBytes {
+		return nil, ErrOpenBox
+	}
+	inner, err := b.SealedBoxOpen(kp)
+	if err != nil {
+		return nil, err
+	}
+	tag := sealedBoxContextTag(kp.PublicKey, context)
+	if MemCmp(inner[:len(tag)], tag, len(tag)) != 0 {
+		MemZero(inner)
+		return nil, ErrOpenBox
+	}
+
+	return inner[len(tag):], nil
+}
+
+func sealedBoxContextTag(pk BoxPublicKey, context []byte) Bytes {
+	h := NewGenericHash(cryptoGenericHashBytes)
+	h.Write(NewADBuilder().Add(sealedBoxContextDomain).Add(context).Add(pk.Bytes).Bytes())
+	return h.Sum(nil)
+}
@@ -0,0 +1,136 @@
+package sodium
+
+// #cgo pkg-config: libsodium
+// #include <stdlib.h>
+// #include <sodium.h>
+import "C"
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+var cryptoBoxBeforeNmBytes = int(C.crypto_box_beforenmbytes())
+
+const boxSessionCounterBytes = 8
+
+// BoxSession is a long-lived Box channel between two peers, managing the
+// nonces so they are never reused.
+//
+// The shared key is computed once. Each direction has its own counter, and
+// the nonce of a message is made of the direction and the counter. The
+// direction is given by the order of the public keys, so both peers agree on
+// it without any exchange.
+//
+// A message is the big-endian uint64 counter followed by the box. Messages
+// must be decrypted in the order they are encrypted: a replayed, reordered or
+// dropped message is rejected.
+//
+// A BoxSession is not safe for concurrent use.
+type BoxSession struct {
+	key  Bytes
+	dir  byte
+	send uint64
+	recv uint64
+}
+
+// CryptoBoxBeforeNM computes the shared key of the public key pk and the
+// secret key sk, used by BoxSession.
+//
+// It returns ErrInvalidKey if pk is a weak key. libsodium rejects the keys
+// giving an all-zero shared secret; in strict mode, every key for which
+// pk.IsWeak() is true is also rejected before calling it.
+func CryptoBoxBeforeNM(pk BoxPublicKey, sk BoxSecretKey) (Bytes, error) {
+	checkTypedSize(&pk, "peer's public key")
+	checkTypedSize(&sk, "own secret key")
+	if StrictMode() && pk.IsWeak() {
+		return nil, ErrInvalidKey
+	}
+
+	key := make([]byte, cryptoBoxBeforeNmBytes)
+	if int(C.crypto_box_beforenm(
+		(*C.uchar)(&key[0]),
+		(*C.uchar)(&pk.Bytes[0]),
+		(*C.uchar)(&sk.Bytes[0]))) != 0 {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+// NewBoxSession starts a session with the peer of public key pk, using the
+// own secret key sk.
+//
+// It returns ErrInvalidKey if pk is a weak key.
+func NewBoxSession(pk BoxPublicKey, sk BoxSecretKey) (*BoxSession, error) {
+	checkTypedSize(&pk, "peer's public key")
+	checkTypedSize(&sk, "own secret key")
+
+	key, err := CryptoBoxBeforeNM(pk, sk)
+	if err != nil {
+		return nil, err
+	}
+	s := &BoxSession{key: key}
+	if bytes.Compare(sk.PublicKey().Bytes, pk.Bytes) > 0 {
+		s.dir = 1
+	}
+	return s, nil
+}
+
+// nonce returns the nonce of message number i sent in direction dir.
+func (s *BoxSession) nonce(dir byte, i uint64) BoxNonce {
+	n := BoxNonce{make([]byte, cryptoBoxNonceBytes)}
+	n.Bytes[0] = dir
+	binary.BigEndian.PutUint64(n.Bytes[cryptoBoxNonceBytes-boxSessionCounterBytes:], i)
+	return n
+}
+
+// Encrypt boxes the next message to the peer.
+func (s *BoxSession) Encrypt(m Bytes) (c Bytes) {
+	n := s.nonce(s.dir, s.send)
+	c = make([]byte, boxSessionCounterBytes+m.Length()+cryptoBoxMacBytes)
+	binary.BigEndian.PutUint64(c, s.send)
+
+	mp, ml := plen(m)
+	if int(C.crypto_box_easy_afternm(
+		(*C.uchar)(&c[boxSessionCounterBytes]),
+		(*C.uchar)(mp),
+		(C.ulonglong)(ml),
+		(*C.uchar)(&n.Bytes[0]),
+		(*C.uchar)(&s.key[0]))) != 0 {
+		panic("see libsodium")
+	}
+	s.send++
+	return
+}
+
+// Decrypt opens the next message from the peer.
+//
+// It returns ErrReplay if the message isn't the next one expected, and
+// ErrOpenBox if it is forged. The session is left unchanged on error.
+func (s *BoxSession) Decrypt(c Bytes) (m Bytes, err error) {
+	if c.Length() < boxSessionCounterBytes+cryptoBoxMacBytes {
+		return nil, ErrOpenBox
+	}
+	if binary.BigEndian.Uint64(c) != s.recv {
+		return nil, ErrReplay
+	}
+	n := s.nonce(s.dir^1, s.recv)
+	b := c[boxSessionCounterBytes:]
+	m = make([]byte, b.Length()-cryptoBoxMacBytes)
+	mp, _ := plen(m)
+	if int(C.crypto_box_open_easy_afternm(
+		(*C.uchar)(mp),
+		(*C.uchar)(&b[0]),
+		(C.ulonglong)(b.Length()),
+		(*C.uchar)(&n.Bytes[0]),
+		(*C.uchar)(&s.key[0]))) != 0 {
+		return nil, ErrOpenBox
+	}
+	s.recv++
+	return
+}
+
+// Close wipes the shared key. The session must not be used afterwards.
+func (s *BoxSession) Close() {
+	MemZero(s.key)
+}
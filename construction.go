@@ -0,0 +1,78 @@
+package sodium
+
+import "sort"
+
+// Construction reports the parameters of an encryption construction, for
+// code sizing buffers without knowing the concrete types.
+type Construction struct {
+	name       string
+	keyBytes   int
+	nonceBytes int
+	overhead   int
+}
+
+// Name returns the libsodium name of the construction, without the crypto_
+// prefix, e.g. "aead_xchacha20poly1305_ietf".
+func (c Construction) Name() string {
+	return c.name
+}
+
+// KeyBytes returns the size of the key.
+func (c Construction) KeyBytes() int {
+	return c.keyBytes
+}
+
+// NonceBytes returns the size of the nonce, or of the header for secret
+// streams.
+func (c Construction) NonceBytes() int {
+	return c.nonceBytes
+}
+
+// Overhead returns the number of bytes added to a message, or to each chunk
+// for secret streams.
+func (c Construction) Overhead() int {
+	return c.overhead
+}
+
+// constructions is the registry of LookupConstruction. The AEGIS ones are
+// added by their files when built with -tags sodium_aegis.
+var constructions = map[string]Construction{}
+
+func registerConstruction(name string, keyBytes, nonceBytes, overhead int) {
+	constructions[name] = Construction{name, keyBytes, nonceBytes, overhead}
+}
+
+func init() {
+	registerConstruction("secretbox_xsalsa20poly1305",
+		cryptoSecretBoxKeyBytes, cryptoSecretBoxNonceBytes, cryptoSecretBoxMacBytes)
+	registerConstruction("secretbox_xchacha20poly1305",
+		cryptoSecretBoxXCPKeyBytes, cryptoSecretBoxXCPNonceBytes, cryptoSecretBoxXCPMacBytes)
+	registerConstruction("box_curve25519xsalsa20poly1305",
+		cryptoBoxSecretKeyBytes, cryptoBoxNonceBytes, cryptoBoxMacBytes)
+	registerConstruction("aead_chacha20poly1305_ietf",
+		cryptoAEADChaCha20Poly1305IETFKeyBytes, cryptoAEADChaCha20Poly1305IETFNPubBytes, cryptoAEADChaCha20Poly1305IETFABytes)
+	registerConstruction("aead_xchacha20poly1305_ietf",
+		cryptoAEADXChaCha20Poly1305IETFKeyBytes, cryptoAEADXChaCha20Poly1305IETFNPubBytes, cryptoAEADXChaCha20Poly1305IETFABytes)
+	registerConstruction("secretstream_xchacha20poly1305",
+		cryptoSecretStreamXChaCha20Poly1305KeyBytes, cryptoSecretStreamXChaCha20Poly1305HeaderBytes, cryptoSecretStreamXChaCha20Poly1305ABytes)
+	registerConstruction("stream_xchacha20",
+		cryptoStreamXChaCha20KeyBytes, cryptoStreamXChaCha20NonceBytes, 0)
+}
+
+// LookupConstruction returns the parameters of the construction of the given
+// name, as listed by Constructions.
+func LookupConstruction(name string) (c Construction, ok bool) {
+	c, ok = constructions[name]
+	return
+}
+
+// Constructions returns the parameters of every construction of the package,
+// sorted by name.
+func Constructions() []Construction {
+	cs := make([]Construction, 0, len(constructions))
+	for _, c := range constructions {
+		cs = append(cs, c)
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].name < cs[j].name })
+	return cs
+}
@@ -0,0 +1,145 @@
+package sodium
+
+import (
+	"context"
+	"sync"
+)
+
+// runContext runs f in a goroutine and waits for it to return, or for ctx to
+// be done. In the latter case ctx.Err() is returned while f keeps running in
+// the background, and its results must be ignored.
+//
+// A panic of f, e.g. on invalid arguments, is raised again in the caller if
+// it is still waiting, and dropped otherwise, so it never ends the process.
+func runContext(ctx context.Context, f func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	var p interface{}
+	go func() {
+		defer func() {
+			p = recover()
+			close(done)
+		}()
+		f()
+	}()
+	select {
+	case <-done:
+		if p != nil {
+			panic(p)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// PWHashStoreContext is PWHashStore returning ctx.Err() if ctx is done before
+// the hash is computed, e.g. to bound the time spent by a request handler.
+//
+// The computation itself can't be interrupted: it goes on in the background,
+// using the CPU and memory of the profile until it completes.
+func PWHashStoreContext(ctx context.Context, pw string) (PWHashStr, error) {
+	var s PWHashStr
+	if err := runContext(ctx, func() { s = PWHashStore(pw) }); err != nil {
+		return PWHashStr{}, err
+	}
+	return s, nil
+}
+
+// PWHashStoreSensitiveContext is PWHashStoreSensitive returning ctx.Err() if
+// ctx is done first, like PWHashStoreContext.
+func PWHashStoreSensitiveContext(ctx context.Context, pw string) (PWHashStr, error) {
+	var s PWHashStr
+	if err := runContext(ctx, func() { s = PWHashStoreSensitive(pw) }); err != nil {
+		return PWHashStr{}, err
+	}
+	return s, nil
+}
+
+// PWHashStoreInteractiveContext is PWHashStoreInteractive returning ctx.Err()
+// if ctx is done first, like PWHashStoreContext.
+func PWHashStoreInteractiveContext(ctx context.Context, pw string) (PWHashStr, error) {
+	var s PWHashStr
+	if err := runContext(ctx, func() { s = PWHashStoreInteractive(pw) }); err != nil {
+		return PWHashStr{}, err
+	}
+	return s, nil
+}
+
+// PWHashVerifyContext is PWHashVerify returning ctx.Err() if ctx is done
+// before the password is verified, like PWHashStoreContext.
+func (s PWHashStr) PWHashVerifyContext(ctx context.Context, pw string) error {
+	var verr error
+	if err := runContext(ctx, func() { verr = s.PWHashVerify(pw) }); err != nil {
+		return err
+	}
+	return verr
+}
+
+// CryptoPwHashWithTimeout is CryptoPwHash returning ctx.Err() if ctx is done
+// before the key is derived, e.g. when the user interrupts a CLI or after a
+// timeout set with context.WithTimeout. The derivation goes on in the
+// background until it completes, so a cancelled call still holds memlimit
+// bytes for a while. It works on copies of pw and salt, and the key it
+// derives after such a return is wiped.
+//
+// libsodium can't report the progress of the derivation, so a CLI can only
+// show that it is running, e.g. with a spinner ticking until the call returns:
+//
+//	done := make(chan struct{})
+//	go func() {
+//		t := time.NewTicker(100 * time.Millisecond)
+//		defer t.Stop()
+//		for i := 0; ; i++ {
+//			select {
+//			case <-done:
+//				fmt.Fprint(os.Stderr, "\r")
+//				return
+//			case <-t.C:
+//				fmt.Fprintf(os.Stderr, "\rDeriving key %c", `|/-\`[i%4])
+//			}
+//		}
+//	}()
+//	key, err := sodium.CryptoPwHashWithTimeout(ctx, pw, salt, 32,
+//		sodium.CryptoPWHashOpsLimitSensitive, sodium.CryptoPWHashMemLimitSensitive)
+//	close(done)
+func CryptoPwHashWithTimeout(ctx context.Context, pw string, salt PWHashSalt, outlen int, opslimit, memlimit int) (Bytes, error) {
+	salt = PWHashSalt{append([]byte{}, salt.Bytes...)}
+	var mu sync.Mutex
+	var key Bytes
+	var kerr error
+	abandoned := false
+	f := func() {
+		k, err := CryptoPwHash(pw, salt, outlen, opslimit, memlimit)
+		mu.Lock()
+		defer mu.Unlock()
+		if abandoned {
+			MemZero(k)
+			return
+		}
+		key, kerr = k, err
+	}
+	if err := runContext(ctx, f); err != nil {
+		mu.Lock()
+		defer mu.Unlock()
+		abandoned = true
+		// f may have returned just as ctx was done.
+		MemZero(key)
+		return nil, err
+	}
+	return key, kerr
+}
+
+// CryptoGenericHashParallelContext is CryptoGenericHashParallel returning
+// ctx.Err() if ctx is done before data is hashed. The hashing goes on in the
+// background, so data must not be modified after such a return: it is still
+// being read.
+func CryptoGenericHashParallelContext(ctx context.Context, data []byte, chunkSize int, workers int) (Bytes, error) {
+	var h Bytes
+	if err := runContext(ctx, func() { h = CryptoGenericHashParallel(data, chunkSize, workers) }); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
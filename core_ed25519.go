@@ -0,0 +1,183 @@
+package sodium
+
+// #cgo pkg-config: libsodium
+// #include <stdlib.h>
+// #include <sodium.h>
+import "C"
+
+var (
+	cryptoCoreEd25519Bytes        = int(C.crypto_core_ed25519_bytes())
+	cryptoCoreEd25519UniformBytes = int(C.crypto_core_ed25519_uniformbytes())
+	cryptoCoreEd25519ScalarBytes  = int(C.crypto_core_ed25519_scalarbytes())
+)
+
+// Ed25519Point is a compressed point of the Ed25519 group.
+type Ed25519Point struct {
+	Bytes
+}
+
+func (Ed25519Point) Size() int {
+	return cryptoCoreEd25519Bytes
+}
+
+// Ed25519Scalar is a scalar of the Ed25519 group, encoded as little-endian.
+type Ed25519Scalar struct {
+	Bytes
+}
+
+func (Ed25519Scalar) Size() int {
+	return cryptoCoreEd25519ScalarBytes
+}
+
+// Ed25519Uniform is a uniformly random string to be mapped to a point.
+type Ed25519Uniform struct {
+	Bytes
+}
+
+func (Ed25519Uniform) Size() int {
+	return cryptoCoreEd25519UniformBytes
+}
+
+// MakeEd25519Scalar generates a random non-zero scalar reduced modulo the
+// order of the group.
+func MakeEd25519Scalar() Ed25519Scalar {
+	b := make([]byte, cryptoCoreEd25519ScalarBytes)
+	C.crypto_core_ed25519_scalar_random((*C.uchar)(&b[0]))
+	return Ed25519Scalar{b}
+}
+
+// CryptoCoreEd25519IsValidPoint checks that p is the canonical encoding of a
+// point on the curve, in the main subgroup and not of small order.
+//
+// It returns false if p doesn't have the size of a point.
+func CryptoCoreEd25519IsValidPoint(p Ed25519Point) bool {
+	if p.Length() != p.Size() {
+		return false
+	}
+	return int(C.crypto_core_ed25519_is_valid_point((*C.uchar)(&p.Bytes[0]))) == 1
+}
+
+// CryptoCoreEd25519Add calculates the point p + q.
+//
+// It returns ErrInvalidPoint if p or q isn't a valid point.
+func CryptoCoreEd25519Add(p, q Ed25519Point) (r Ed25519Point, err error) {
+	checkTypedSize(&p, "point")
+	checkTypedSize(&q, "point")
+
+	rb := make([]byte, cryptoCoreEd25519Bytes)
+	if int(C.crypto_core_ed25519_add(
+		(*C.uchar)(&rb[0]),
+		(*C.uchar)(&p.Bytes[0]),
+		(*C.uchar)(&q.Bytes[0]))) != 0 {
+		return r, ErrInvalidPoint
+	}
+
+	return Ed25519Point{rb}, nil
+}
+
+// CryptoCoreEd25519Sub calculates the point p - q.
+//
+// It returns ErrInvalidPoint if p or q isn't a valid point.
+func CryptoCoreEd25519Sub(p, q Ed25519Point) (r Ed25519Point, err error) {
+	checkTypedSize(&p, "point")
+	checkTypedSize(&q, "point")
+
+	rb := make([]byte, cryptoCoreEd25519Bytes)
+	if int(C.crypto_core_ed25519_sub(
+		(*C.uchar)(&rb[0]),
+		(*C.uchar)(&p.Bytes[0]),
+		(*C.uchar)(&q.Bytes[0]))) != 0 {
+		return r, ErrInvalidPoint
+	}
+
+	return Ed25519Point{rb}, nil
+}
+
+// CryptoCoreEd25519FromUniform maps r to a point of the main subgroup with
+// the Elligator 2 map, e.g. to hash to the curve.
+func CryptoCoreEd25519FromUniform(r Ed25519Uniform) (p Ed25519Point) {
+	checkTypedSize(&r, "uniform")
+
+	pb := make([]byte, cryptoCoreEd25519Bytes)
+	if int(C.crypto_core_ed25519_from_uniform(
+		(*C.uchar)(&pb[0]),
+		(*C.uchar)(&r.Bytes[0]))) != 0 {
+		panic("see libsodium")
+	}
+
+	return Ed25519Point{pb}
+}
+
+// CryptoScalarmultEd25519 calculates the point n * p. The scalar n is clamped
+// first, like an Ed25519 secret key (see CryptoScalarmultEd25519NoClamp).
+//
+// It returns ErrInvalidPoint if p isn't a valid point or the result is the
+// identity.
+func CryptoScalarmultEd25519(n Ed25519Scalar, p Ed25519Point) (q Ed25519Point, err error) {
+	checkTypedSize(&n, "scalar")
+	checkTypedSize(&p, "point")
+
+	qb := make([]byte, cryptoCoreEd25519Bytes)
+	if int(C.crypto_scalarmult_ed25519(
+		(*C.uchar)(&qb[0]),
+		(*C.uchar)(&n.Bytes[0]),
+		(*C.uchar)(&p.Bytes[0]))) != 0 {
+		return q, ErrInvalidPoint
+	}
+
+	return Ed25519Point{qb}, nil
+}
+
+// CryptoScalarmultEd25519NoClamp calculates the point n * p with n used as is,
+// which is what most protocols built on the group operations expect.
+//
+// It returns ErrInvalidPoint if p isn't a valid point or the result is the
+// identity.
+func CryptoScalarmultEd25519NoClamp(n Ed25519Scalar, p Ed25519Point) (q Ed25519Point, err error) {
+	checkTypedSize(&n, "scalar")
+	checkTypedSize(&p, "point")
+
+	qb := make([]byte, cryptoCoreEd25519Bytes)
+	if int(C.crypto_scalarmult_ed25519_noclamp(
+		(*C.uchar)(&qb[0]),
+		(*C.uchar)(&n.Bytes[0]),
+		(*C.uchar)(&p.Bytes[0]))) != 0 {
+		return q, ErrInvalidPoint
+	}
+
+	return Ed25519Point{qb}, nil
+}
+
+// CryptoScalarmultEd25519Base calculates the point n * B, B being the base
+// point. The scalar n is clamped first.
+//
+// It returns ErrInvalidPoint if the result is the identity.
+func CryptoScalarmultEd25519Base(n Ed25519Scalar) (q Ed25519Point, err error) {
+	checkTypedSize(&n, "scalar")
+
+	qb := make([]byte, cryptoCoreEd25519Bytes)
+	if int(C.crypto_scalarmult_ed25519_base(
+		(*C.uchar)(&qb[0]),
+		(*C.uchar)(&n.Bytes[0]))) != 0 {
+		return q, ErrInvalidPoint
+	}
+
+	return Ed25519Point{qb}, nil
+}
+
+// CryptoScalarmultEd25519BaseNoClamp calculates the point n * B with n used
+// as is.
+//
+// It returns ErrInvalidPoint if the result is the identity.
+func CryptoScalarmultEd25519BaseNoClamp(n Ed25519Scalar) (q Ed25519Point, err error) {
+	checkTypedSize(&n, "scalar")
+
+	qb := make([]byte, cryptoCoreEd25519Bytes)
+	if int(C.crypto_scalarmult_ed25519_base_noclamp(
+		(*C.uchar)(&qb[0]),
+		(*C.uchar)(&n.Bytes[0]))) != 0 {
+		return q, ErrInvalidPoint
+	}
+
+	return Ed25519Point{qb}, nil
+}
@@ -0,0 +1,83 @@
+package sodium
+
+import (
+	"bytes"
+	"io"
+)
+
+const (
+	// EnvelopeVersion is the version of the format written by SealEnvelope.
+	EnvelopeVersion byte = 1
+
+	// EnvelopeAlgorithmSecretStreamXCP identifies an envelope encrypted with
+	// secret stream XChaCha20-Poly1305.
+	EnvelopeAlgorithmSecretStreamXCP byte = 1
+
+	envelopePrefixBytes = 2
+)
+
+// SealEnvelope encrypts the message with key into a self-describing envelope:
+//
+//	version (1 byte) || algorithm (1 byte) || secret stream header || cipher text
+//
+// The message is encrypted as a single final chunk, authenticated along with
+// the version and algorithm bytes.
+func (b Bytes) SealEnvelope(key SecretStreamXCPKey) (c Bytes) {
+	return b.SealEnvelopeWithAD(key, nil)
+}
+
+// SealEnvelopeWithAD is SealEnvelope also authenticating the associated data
+// ad, e.g. a file name or content type. The ad is not stored in the envelope,
+// and the same ad must be given to OpenEnvelopeWithAD.
+//
+// An empty ad gives the same envelope as SealEnvelope.
+func (b Bytes) SealEnvelopeWithAD(key SecretStreamXCPKey, ad Bytes) (c Bytes) {
+	prefix := []byte{EnvelopeVersion, EnvelopeAlgorithmSecretStreamXCP}
+	var buf bytes.Buffer
+	buf.Write(prefix)
+	encoder := MakeSecretStreamXCPEncoderWithHeader(key, &buf)
+	encoder.SetAdditionData(append(prefix, ad...))
+	if _, err := encoder.WriteAndClose(b); err != nil {
+		panic("see libsodium")
+	}
+	return buf.Bytes()
+}
+
+// OpenEnvelope decrypts an envelope made by SealEnvelope with key.
+//
+// It returns ErrUnsupportedVersion or ErrUnsupportedAlgorithm if the envelope
+// is of an unknown format, ErrInvalidHeader if it is too short, or
+// ErrDecryptSS if decryption failed.
+func (b Bytes) OpenEnvelope(key SecretStreamXCPKey) (m Bytes, err error) {
+	return b.OpenEnvelopeWithAD(key, nil)
+}
+
+// OpenEnvelopeWithAD decrypts an envelope made by SealEnvelopeWithAD with key
+// and the same ad. A different ad gives ErrDecryptSS.
+func (b Bytes) OpenEnvelopeWithAD(key SecretStreamXCPKey, ad Bytes) (m Bytes, err error) {
+	if b.Length() < envelopePrefixBytes {
+		return nil, ErrInvalidHeader
+	}
+	if b[0] != EnvelopeVersion {
+		return nil, ErrUnsupportedVersion
+	}
+	if b[1] != EnvelopeAlgorithmSecretStreamXCP {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	abytes := cryptoSecretStreamXChaCha20Poly1305ABytes
+	if b.Length() < envelopePrefixBytes+cryptoSecretStreamXChaCha20Poly1305HeaderBytes+abytes {
+		return nil, ErrInvalidHeader
+	}
+
+	r := bytes.NewReader(b[envelopePrefixBytes:])
+	decoder, err := MakeSecretStreamXCPDecoderAutoHeader(key, r)
+	if err != nil {
+		return nil, err
+	}
+	d := decoder.(*SecretStreamXCPDecoder)
+	m = make([]byte, r.Len()-abytes)
+	if _, err = d.pull(m, append(append([]byte{}, b[:envelopePrefixBytes]...), ad...)); err != io.EOF || d.Tag() != SecretStreamTag_Final {
+		return nil, ErrDecryptSS
+	}
+	return m, nil
+}
@@ -0,0 +1,57 @@
+package sodium
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// SealJSON encodes v with encoding/json and seals the encoding into an
+// envelope with key, as SealEnvelope does. It returns the error of the
+// encoding, if any.
+//
+// An envelope is a single chunk, so the encoding is held in memory, and wiped
+// once sealed. For values too large for it, encode them into the writer of
+// NewEncryptingWriter, e.g. with json.NewEncoder, which streams them.
+func SealJSON(key SecretStreamXCPKey, v interface{}) ([]byte, error) {
+	m, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	defer MemZero(m)
+	return Bytes(m).SealEnvelope(key), nil
+}
+
+// OpenJSON opens an envelope made by SealJSON with key, and decodes it into
+// v with encoding/json. It returns the errors of OpenEnvelope, or the error of
+// the decoding. The decrypted encoding is wiped.
+func OpenJSON(key SecretStreamXCPKey, blob []byte, v interface{}) error {
+	m, err := Bytes(blob).OpenEnvelope(key)
+	if err != nil {
+		return err
+	}
+	defer MemZero(m)
+	return json.Unmarshal(m, v)
+}
+
+// SealGob is SealJSON with encoding/gob, e.g. for values of Go programs only.
+func SealGob(key SecretStreamXCPKey, v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	m := buf.Bytes()
+	defer MemZero(m[:cap(m)])
+	return Bytes(m).SealEnvelope(key), nil
+}
+
+// OpenGob opens an envelope made by SealGob with key, and decodes it into v
+// with encoding/gob, like OpenJSON.
+func OpenGob(key SecretStreamXCPKey, blob []byte, v interface{}) error {
+	m, err := Bytes(blob).OpenEnvelope(key)
+	if err != nil {
+		return err
+	}
+	defer MemZero(m)
+	return gob.NewDecoder(bytes.NewReader(m)).Decode(v)
+}
@@ -103,6 +103,48 @@ func (kp KXKP) ServerSessionKeys(client_pk KXPublicKey) (*KXSessionKeys, error)
 	}, nil
 }
 
+const kxPSKContext = "sodium kx psk"
+
+// ClientSessionKeysWithPSK is ClientSessionKeys with the pre-shared key psk
+// mixed into both session keys, so they are only known to peers having psk
+// even if the key exchange is broken. The server must use
+// ServerSessionKeysWithPSK with the same psk.
+//
+// psk must be between 16 and 64 bytes. Each session key k is replaced by
+// BLAKE2b-256(key = psk, "sodium kx psk" || k).
+func (kp KXKP) ClientSessionKeysWithPSK(server_pk KXPublicKey, psk []byte) (*KXSessionKeys, error) {
+	checkSizeInRange(len(psk), cryptoGenericHashKeyBytesMin, cryptoGenericHashKeyBytesMax, "pre-shared key")
+	keys, err := kp.ClientSessionKeys(server_pk)
+	if err != nil {
+		return nil, err
+	}
+	keys.mixPSK(psk)
+	return keys, nil
+}
+
+// ServerSessionKeysWithPSK is ServerSessionKeys with the pre-shared key psk
+// mixed into both session keys, see ClientSessionKeysWithPSK.
+func (kp KXKP) ServerSessionKeysWithPSK(client_pk KXPublicKey, psk []byte) (*KXSessionKeys, error) {
+	checkSizeInRange(len(psk), cryptoGenericHashKeyBytesMin, cryptoGenericHashKeyBytesMax, "pre-shared key")
+	keys, err := kp.ServerSessionKeys(client_pk)
+	if err != nil {
+		return nil, err
+	}
+	keys.mixPSK(psk)
+	return keys, nil
+}
+
+func (keys *KXSessionKeys) mixPSK(psk []byte) {
+	for _, k := range []*KXSessionKey{&keys.Rx, &keys.Tx} {
+		h := NewGenericHashKeyed(cryptoKXSessionKeyBytes, GenericHashKey{psk})
+		h.Write([]byte(kxPSKContext))
+		h.Write(k.Bytes)
+		mixed := h.Sum(nil)
+		MemZero(k.Bytes)
+		k.Bytes = mixed
+	}
+}
+
 type KXSessionKeys struct {
 	Rx KXSessionKey
 	Tx KXSessionKey
@@ -124,6 +166,10 @@ func (k KXSecretKey) Size() int {
 	return cryptoKXSecretKeyBytes
 }
 
+func (k KXSecretKey) String() string {
+	return redacted("KXSecretKey", k.Bytes)
+}
+
 type KXSessionKey struct {
 	Bytes
 }
@@ -132,6 +178,21 @@ func (k KXSessionKey) Size() int {
 	return cryptoKXSessionKeyBytes
 }
 
+func (k KXSessionKey) String() string {
+	return redacted("KXSessionKey", k.Bytes)
+}
+
+// ToSecretStreamKey converts the session key to a SecretStreamXCPKey, to
+// encrypt a stream after the key exchange. The Tx key encrypts the stream
+// sent to the peer, and the Rx key decrypts the one received from it, whose
+// Tx key it is.
+func (k KXSessionKey) ToSecretStreamKey() SecretStreamXCPKey {
+	checkTypedSize(&k, "session key")
+	sk := SecretStreamXCPKey{append(Bytes{}, k.Bytes...)}
+	checkTypedSize(&sk, "secret stream key")
+	return sk
+}
+
 type KXSeed struct {
 	Bytes
 }
@@ -139,3 +200,7 @@ type KXSeed struct {
 func (k KXSeed) Size() int {
 	return cryptoKXSeedBytes
 }
+
+func (k KXSeed) String() string {
+	return redacted("KXSeed", k.Bytes)
+}
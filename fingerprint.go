@@ -0,0 +1,28 @@
+package sodium
+
+const fingerprintBytes = 10
+
+// Fingerprint returns a short text identifying pk, for users to compare
+// out-of-band, e.g. read over the phone, to make sure they have the right key
+// and not the one of a man in the middle.
+//
+// The fingerprint is the unpadded base32 (RFC 4648) of the first 10 bytes of
+// the BLAKE2b-256 of pk, in 4 groups of 4 characters separated by dashes, e.g.
+// "ABCD-EFGH-IJKL-MNOP". Its 80 bits make finding another key with the same
+// fingerprint impractical, but it is not meant to be used in place of the key.
+func Fingerprint(pk SignPublicKey) string {
+	checkTypedSize(&pk, "public key")
+	h := NewGenericHash(cryptoGenericHashBytes)
+	h.Write(pk.Bytes)
+	s := recoveryKeyEncoding.EncodeToString(h.Sum(nil)[:fingerprintBytes])
+	return groupString(s, recoveryKeyGroupSize)
+}
+
+// MakeSignKPWithFingerprint generates a keypair for signing and the
+// Fingerprint of its public key, e.g. to show it when registering the key.
+//
+// The error is always nil for now, as MakeSignKP panics if libsodium fails.
+func MakeSignKPWithFingerprint() (kp SignKP, fingerprint string, err error) {
+	kp = MakeSignKP()
+	return kp, Fingerprint(kp.PublicKey), nil
+}
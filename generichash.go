@@ -7,6 +7,8 @@ import "C"
 import (
 	"fmt"
 	"hash"
+	"runtime"
+	"unsafe"
 )
 
 var (
@@ -17,8 +19,14 @@ var (
 	cryptoGenericHashBytes       = int(C.crypto_generichash_bytes())
 	cryptoGenericHashKeyBytes    = int(C.crypto_generichash_keybytes())
 	cryptoGenericHashPrimitive   = C.GoString(C.crypto_generichash_primitive())
+	cryptoGenericHashStateBytes  = int(C.crypto_generichash_statebytes())
 )
 
+// GenericHashStateBytes returns the size of the state of a GenericHash.
+func GenericHashStateBytes() int {
+	return cryptoGenericHashStateBytes
+}
+
 // GenericHash provides a BLAKE2b (RFC7693) hash, in interface of hash.Hash.
 //
 // The Hash's and key's size can be any between 16 bytes (128 bits) to
@@ -28,7 +36,8 @@ type GenericHash struct {
 	blocksize int
 	key       *GenericHashKey
 	sum       []byte
-	state     C.struct_crypto_generichash_blake2b_state
+	state     *C.struct_crypto_generichash_blake2b_state
+	secure    bool
 }
 
 type GenericHashKey struct {
@@ -39,6 +48,10 @@ func (GenericHashKey) Size() int {
 	return cryptoGenericHashKeyBytes
 }
 
+func (k GenericHashKey) String() string {
+	return redacted("GenericHashKey", k.Bytes)
+}
+
 // Unkeyed version with default output length.
 func NewGenericHashDefault() hash.Hash {
 	return NewGenericHash(cryptoGenericHashBytes)
@@ -57,8 +70,8 @@ func NewGenericHash(outlen int) hash.Hash {
 		blocksize: 128,
 		key:       nil,
 		sum:       nil,
-		state:     C.struct_crypto_generichash_blake2b_state{},
 	}
+	hash.allocState(false)
 	hash.Reset()
 	return &hash
 }
@@ -72,12 +85,100 @@ func NewGenericHashKeyed(outlen int, key GenericHashKey) hash.Hash {
 		blocksize: 128,
 		key:       &key,
 		sum:       nil,
-		state:     C.struct_crypto_generichash_blake2b_state{},
 	}
+	hash.allocState(false)
 	hash.Reset()
 	return &hash
 }
 
+// NewGenericHashSecure is NewGenericHash with the state allocated by
+// sodium_malloc, i.e. in guarded memory locked out of swap.
+//
+// The memory is released by Free, or when the hash is garbage collected.
+func NewGenericHashSecure(outlen int) *GenericHash {
+	checkSizeInRange(outlen, cryptoGenericHashBytesMin, cryptoGenericHashBytesMax, "out")
+	hash := &GenericHash{
+		size:      outlen,
+		blocksize: 128,
+	}
+	hash.allocState(true)
+	hash.Reset()
+	return hash
+}
+
+// NewGenericHashKeyedSecure is NewGenericHashKeyed with the state allocated
+// by sodium_malloc, as the state is derived from the key.
+//
+// The memory is released by Free, or when the hash is garbage collected.
+func NewGenericHashKeyedSecure(outlen int, key GenericHashKey) *GenericHash {
+	checkSizeInRange(outlen, cryptoGenericHashBytesMin, cryptoGenericHashBytesMax, "out")
+	checkTypedSize(&key, "generic hash key")
+	hash := &GenericHash{
+		size:      outlen,
+		blocksize: 128,
+		key:       &key,
+	}
+	hash.allocState(true)
+	hash.Reset()
+	return hash
+}
+
+func (g *GenericHash) allocState(secure bool) {
+	g.secure = secure
+	if !secure {
+		g.state = new(C.struct_crypto_generichash_blake2b_state)
+		return
+	}
+	p := C.sodium_malloc(C.size_t(cryptoGenericHashStateBytes))
+	if p == nil {
+		panic("see libsodium")
+	}
+	g.state = (*C.struct_crypto_generichash_blake2b_state)(p)
+	// The finalizer frees the state, so the methods using it keep g alive
+	// with runtime.KeepAlive until they are done with it.
+	runtime.SetFinalizer(g, (*GenericHash).Free)
+}
+
+func (g *GenericHash) checkState() {
+	if g.state == nil {
+		panic("GenericHash used after Free")
+	}
+}
+
+// Free wipes the state and releases the memory allocated by
+// NewGenericHashSecure and NewGenericHashKeyedSecure. The hash must not be
+// used after calling Free.
+func (g *GenericHash) Free() {
+	if g.state == nil {
+		return
+	}
+	if g.secure {
+		C.sodium_free(unsafe.Pointer(g.state))
+		runtime.SetFinalizer(g, nil)
+	} else {
+		*g.state = C.struct_crypto_generichash_blake2b_state{}
+	}
+	g.state = nil
+}
+
+// Clone returns a copy of the hash in its current state. Both can then be fed
+// independently, e.g. to get several digests of messages sharing a prefix
+// while hashing the prefix only once.
+//
+// The state of the copy is allocated as the one of g.
+func (g *GenericHash) Clone() *GenericHash {
+	g.checkState()
+	c := new(GenericHash)
+	*c = *g
+	c.allocState(g.secure)
+	*c.state = *g.state
+	runtime.KeepAlive(g)
+	if g.sum != nil {
+		c.sum = append([]byte{}, g.sum...)
+	}
+	return c
+}
+
 // Output length in bytes.
 //
 // Implements hash.Hash
@@ -92,12 +193,13 @@ func (g GenericHash) BlockSize() int {
 
 // Implements hash.Hash
 func (g *GenericHash) Reset() {
+	g.checkState()
 	if g.sum != nil {
 		g.sum = nil
 	}
 	if g.key != nil {
 		if int(C.crypto_generichash_init(
-			&g.state,
+			g.state,
 			(*C.uchar)(&g.key.Bytes[0]),
 			(C.size_t)(g.key.Length()),
 			(C.size_t)(g.size))) != 0 {
@@ -105,19 +207,21 @@ func (g *GenericHash) Reset() {
 		}
 	} else {
 		if int(C.crypto_generichash_init(
-			&g.state,
+			g.state,
 			(*C.uchar)(nil),
 			(C.size_t)(0),
 			(C.size_t)(g.size))) != 0 {
 			panic("see libsodium")
 		}
 	}
+	runtime.KeepAlive(g)
 }
 
 // Use GenericHash.Write([]byte) to hash chunks of message.
 //
 // Implements hash.Hash
 func (g *GenericHash) Write(p []byte) (n int, err error) {
+	g.checkState()
 	if g.sum != nil {
 		return 0, fmt.Errorf("hash finalized")
 	}
@@ -127,7 +231,7 @@ func (g *GenericHash) Write(p []byte) (n int, err error) {
 		c := i[:g.blocksize]
 		i = i[g.blocksize:]
 		if int(C.crypto_generichash_update(
-			&g.state,
+			g.state,
 			(*C.uchar)(&c[0]),
 			(C.ulonglong)(g.blocksize))) != 0 {
 			panic("see libsodium")
@@ -135,12 +239,13 @@ func (g *GenericHash) Write(p []byte) (n int, err error) {
 	}
 	if len(i) > 0 {
 		if int(C.crypto_generichash_update(
-			&g.state,
+			g.state,
 			(*C.uchar)(&i[0]),
 			(C.ulonglong)(len(i)))) != 0 {
 			panic("see libsodium")
 		}
 	}
+	runtime.KeepAlive(g)
 	return len(p), nil
 }
 
@@ -155,13 +260,53 @@ func (g *GenericHash) Sum(b []byte) []byte {
 	if g.sum != nil {
 		return append(b, g.sum...)
 	}
+	g.checkState()
 	g.sum = make([]byte, g.size)
 	if int(C.crypto_generichash_final(
-		&g.state,
+		g.state,
 		(*C.uchar)(&g.sum[0]),
 		(C.size_t)(g.size))) != 0 {
 		panic("see libsodium")
 	}
-	g.state = C.struct_crypto_generichash_blake2b_state{}
+	C.sodium_memzero(unsafe.Pointer(g.state), C.size_t(unsafe.Sizeof(*g.state)))
+	runtime.KeepAlive(g)
 	return append(b, g.sum...)
 }
+
+// DeterministicID returns a short identifier of input, e.g. to address
+// content or to deduplicate it: the unpadded URL-safe base64 of the first
+// length bytes of its 64-byte BLAKE2b. The same input always gives the same ID.
+//
+// length must be between 1 and 64; the ID has about 4*length/3 characters.
+// Among n IDs, the probability of a collision is about n*n / 2^(8*length+1):
+// with 16 bytes (22 characters), it stays below one in a billion up to 2^49
+// IDs.
+func DeterministicID(input []byte, length int) string {
+	return deterministicID(NewGenericHash(cryptoGenericHashBytesMax), input, length)
+}
+
+// DeterministicIDKeyed is DeterministicID with a keyed BLAKE2b, so only the
+// holders of key can compute or check the IDs.
+func DeterministicIDKeyed(input []byte, length int, key GenericHashKey) string {
+	return deterministicID(NewGenericHashKeyed(cryptoGenericHashBytesMax, key), input, length)
+}
+
+func deterministicID(h hash.Hash, input []byte, length int) string {
+	checkSizeInRange(length, 1, cryptoGenericHashBytesMax, "ID")
+	h.Write(input)
+	return Bytes(h.Sum(nil)[:length]).Base64(Base64Variant_URLSafeNoPadding)
+}
+
+// CryptoGenericHash512 returns the full 64-byte BLAKE2b of message, keyed with
+// key unless it is empty, e.g. for interoperability with systems using
+// BLAKE2b-512. A non-empty key must be between 16 and 64 bytes.
+func CryptoGenericHash512(message, key []byte) Bytes {
+	var h hash.Hash
+	if len(key) == 0 {
+		h = NewGenericHash(cryptoGenericHashBytesMax)
+	} else {
+		h = NewGenericHashKeyed(cryptoGenericHashBytesMax, GenericHashKey{key})
+	}
+	h.Write(message)
+	return h.Sum(nil)
+}
@@ -0,0 +1,61 @@
+package sodium
+
+// #cgo pkg-config: libsodium
+// #include <stdlib.h>
+// #include <sodium.h>
+import "C"
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const bloomHasherBytes = 16
+
+// BloomHasher computes the k positions of an input in a Bloom filter with a
+// keyed BLAKE2b, so that without the key an attacker can't choose inputs
+// colliding on the same bits to fill the filter.
+//
+// Hash i is the first 8 bytes, as a little-endian uint64, of the 16-byte
+// BLAKE2b of the input keyed with the key and personalized with
+// "sodium bloom" || LE32(i). The hashes are independent, and are usually
+// reduced modulo the size of the filter.
+type BloomHasher struct {
+	key GenericHashKey
+	k   int
+}
+
+// NewBloomHasher makes a BloomHasher returning k hashes per input. k must be
+// positive.
+func NewBloomHasher(key GenericHashKey, k int) *BloomHasher {
+	checkTypedSize(&key, "bloom hasher key")
+	if k <= 0 {
+		panic(fmt.Sprintf("Incorrect number of hashes, got (%d).", k))
+	}
+	return &BloomHasher{key: key, k: k}
+}
+
+// Hashes returns the k hashes of input.
+func (h *BloomHasher) Hashes(input []byte) []uint64 {
+	hashes := make([]uint64, h.k)
+	var personal [16]byte
+	copy(personal[:], "sodium bloom")
+	var out [bloomHasherBytes]byte
+	ip, il := plen(input)
+	for i := range hashes {
+		binary.LittleEndian.PutUint32(personal[12:], uint32(i))
+		if int(C.crypto_generichash_blake2b_salt_personal(
+			(*C.uchar)(&out[0]),
+			(C.size_t)(len(out)),
+			(*C.uchar)(ip),
+			(C.ulonglong)(il),
+			(*C.uchar)(&h.key.Bytes[0]),
+			(C.size_t)(h.key.Length()),
+			(*C.uchar)(nil),
+			(*C.uchar)(&personal[0]))) != 0 {
+			panic("see libsodium")
+		}
+		hashes[i] = binary.LittleEndian.Uint64(out[:])
+	}
+	return hashes
+}
@@ -0,0 +1,145 @@
+package sodium
+
+// #cgo pkg-config: libsodium
+// #include <stdlib.h>
+// #include <sodium.h>
+import "C"
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+var (
+	chunkerGearPersonal = [16]byte{'s', 'o', 'd', 'i', 'u', 'm', ' ', 'c', 'd', 'c', ' ', 'g', 'e', 'a', 'r'}
+	chunkerIDPersonal   = [16]byte{'s', 'o', 'd', 'i', 'u', 'm', ' ', 'c', 'd', 'c', ' ', 'i', 'd'}
+)
+
+// Chunk is a piece of the data split by a Chunker.
+type Chunk struct {
+	// Offset is the position of the chunk in the data.
+	Offset int64
+	// Data is the content of the chunk.
+	Data []byte
+	// ID is the 32-byte BLAKE2b of Data keyed with the key of the Chunker,
+	// the same for chunks of the same content, e.g. to store them only once.
+	ID Bytes
+}
+
+// Chunker splits data into chunks at boundaries defined by their content
+// (content-defined chunking), e.g. for backups deduplicating the chunks of
+// files: inserting or removing bytes only changes the chunks around them, as
+// the following boundaries are found again.
+//
+// A boundary is where a rolling gear hash of the last 64 bytes is below a
+// threshold, as in FastCDC. The gear table is derived from the key with
+// BLAKE2b, so without the key the boundaries can't be predicted, nor be forced
+// by choosing data. The IDs of the chunks are keyed with it too, so they don't
+// tell whether some known data has been stored. The same key must be used for
+// all the data to be deduplicated together.
+//
+// A Chunker is not safe for concurrent use.
+type Chunker struct {
+	r         io.Reader
+	key       GenericHashKey
+	gear      [256]uint64
+	min       int
+	threshold uint64
+	buf       []byte
+	n         int
+	offset    int64
+	err       error
+}
+
+// NewChunker makes a Chunker of the data read from r, with chunks of at least
+// minSize and at most maxSize bytes but the last one. Past minSize, each byte
+// ends a chunk with a probability of 1/(avgSize-minSize), so the chunks are of
+// about avgSize bytes on average.
+//
+// It panics unless 0 < minSize < avgSize < maxSize.
+func NewChunker(r io.Reader, key GenericHashKey, minSize, avgSize, maxSize int) *Chunker {
+	checkTypedSize(&key, "chunker key")
+	if minSize <= 0 || avgSize <= minSize || maxSize <= avgSize {
+		panic(fmt.Sprintf("Incorrect chunk sizes, expected 0 < min < avg < max, got (%d, %d, %d).", minSize, avgSize, maxSize))
+	}
+	c := &Chunker{
+		r:         r,
+		key:       key,
+		min:       minSize,
+		threshold: math.MaxUint64 / uint64(avgSize-minSize),
+		buf:       make([]byte, maxSize),
+	}
+
+	// The table is 32 keyed hashes of 64 bytes, of LE32(0) to LE32(31).
+	var in [4]byte
+	var out [64]byte
+	for i := 0; i < len(c.gear)/8; i++ {
+		binary.LittleEndian.PutUint32(in[:], uint32(i))
+		c.hash(out[:], in[:], &chunkerGearPersonal)
+		for j := 0; j < 8; j++ {
+			c.gear[i*8+j] = binary.LittleEndian.Uint64(out[j*8:])
+		}
+	}
+	MemZero(out[:])
+	return c
+}
+
+func (c *Chunker) hash(out, in []byte, personal *[16]byte) {
+	ip, il := plen(in)
+	if int(C.crypto_generichash_blake2b_salt_personal(
+		(*C.uchar)(&out[0]),
+		(C.size_t)(len(out)),
+		(*C.uchar)(ip),
+		(C.ulonglong)(il),
+		(*C.uchar)(&c.key.Bytes[0]),
+		(C.size_t)(c.key.Length()),
+		(*C.uchar)(nil),
+		(*C.uchar)(&personal[0]))) != 0 {
+		panic("see libsodium")
+	}
+}
+
+// Next returns the next chunk, or io.EOF once all the data has been returned.
+// Errors of the underlying reader are returned as is.
+func (c *Chunker) Next() (Chunk, error) {
+	if c.n < len(c.buf) && c.err == nil {
+		m, err := io.ReadFull(c.r, c.buf[c.n:])
+		c.n += m
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		c.err = err
+	}
+	if c.n == 0 || (c.err != nil && c.err != io.EOF) {
+		return Chunk{}, c.err
+	}
+
+	l := c.cut(c.buf[:c.n])
+	chunk := Chunk{
+		Offset: c.offset,
+		Data:   append([]byte{}, c.buf[:l]...),
+		ID:     make([]byte, cryptoGenericHashBytes),
+	}
+	c.hash(chunk.ID, chunk.Data, &chunkerIDPersonal)
+	c.n = copy(c.buf, c.buf[l:c.n])
+	c.offset += int64(l)
+	return chunk, nil
+}
+
+// cut returns the length of the chunk at the start of b, which is only
+// shorter than the maximum chunk size at the end of the data.
+func (c *Chunker) cut(b []byte) int {
+	if len(b) <= c.min {
+		return len(b)
+	}
+	var h uint64
+	for i := c.min; i < len(b); i++ {
+		h = h<<1 + c.gear[b[i]]
+		if h < c.threshold {
+			return i + 1
+		}
+	}
+	return len(b)
+}
@@ -0,0 +1,85 @@
+package sodium
+
+// #cgo pkg-config: libsodium
+// #include <stdlib.h>
+// #include <sodium.h>
+import "C"
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+const (
+	genericHashStateMagic = "SODH"
+
+	// GenericHashStateVersion is the version of the format written by
+	// GenericHash.Save.
+	GenericHashStateVersion = 1
+)
+
+// genericHashStateEnv identifies the libsodium and architecture the raw state
+// is only valid for.
+func genericHashStateEnv() string {
+	return C.GoString(C.sodium_version_string()) + "/" + runtime.GOARCH
+}
+
+// Save serializes the current state of g, e.g. to checkpoint the hash of a
+// large file and resume it with RestoreGenericHashState after a restart.
+//
+// The state is the raw libsodium state, which is NOT portable: it can only be
+// restored with the same libsodium version on the same architecture, which
+// RestoreGenericHashState checks. It is as sensitive as the key of a keyed
+// hash, since it allows to carry on hashing with it.
+//
+// It returns ErrInvalidState if Sum has been called.
+func (g *GenericHash) Save() ([]byte, error) {
+	g.checkState()
+	if g.sum != nil {
+		return nil, ErrInvalidState
+	}
+	env := genericHashStateEnv()
+	b := make([]byte, 0, len(genericHashStateMagic)+3+len(env)+cryptoGenericHashStateBytes)
+	b = append(b, genericHashStateMagic...)
+	b = append(b, GenericHashStateVersion, byte(g.size), byte(len(env)))
+	b = append(b, env...)
+	b = append(b, unsafe.Slice((*byte)(unsafe.Pointer(g.state)), cryptoGenericHashStateBytes)...)
+	runtime.KeepAlive(g)
+	return b, nil
+}
+
+// RestoreGenericHashState restores a hash of outLen bytes saved by
+// GenericHash.Save, so Write carries on from where it was saved.
+//
+// It returns ErrUnsupportedVersion if data was saved by another format
+// version, libsodium version or architecture, and ErrInvalidEncoding if it is
+// malformed or not of a hash of outLen bytes. Reset on the restored hash
+// starts an unkeyed hash.
+func RestoreGenericHashState(data []byte, outLen int) (*GenericHash, error) {
+	checkSizeInRange(outLen, cryptoGenericHashBytesMin, cryptoGenericHashBytesMax, "out")
+	h := len(genericHashStateMagic) + 3
+	if len(data) < h || string(data[:len(genericHashStateMagic)]) != genericHashStateMagic {
+		return nil, ErrInvalidEncoding
+	}
+	if data[len(genericHashStateMagic)] != GenericHashStateVersion {
+		return nil, ErrUnsupportedVersion
+	}
+	envl := int(data[h-1])
+	if len(data) < h+envl {
+		return nil, ErrInvalidEncoding
+	}
+	if string(data[h:h+envl]) != genericHashStateEnv() {
+		return nil, ErrUnsupportedVersion
+	}
+	if int(data[h-2]) != outLen || len(data) != h+envl+cryptoGenericHashStateBytes {
+		return nil, ErrInvalidEncoding
+	}
+
+	g := &GenericHash{
+		size:      outLen,
+		blocksize: 128,
+	}
+	g.allocState(false)
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(g.state)), cryptoGenericHashStateBytes), data[h+envl:])
+	return g, nil
+}
@@ -0,0 +1,70 @@
+package sodium
+
+import (
+	"encoding/binary"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// CryptoGenericHashParallel hashes data as a two-level BLAKE2b tree, spreading
+// the leaves over workers goroutines. workers <= 0 uses runtime.NumCPU().
+//
+// This is NOT the same as hashing data with GenericHash. The scheme is:
+//
+//	leaf[i] = BLAKE2b-256(0x00 || LE64(i) || data[i*chunkSize:(i+1)*chunkSize])
+//	root    = BLAKE2b-256(0x01 || LE64(chunkSize) || LE64(len(data)) || leaf[0] || ... || leaf[n-1])
+//
+// where the last chunk may be shorter and empty data has no leaves.
+// The 32-byte root is returned. It does not depend on workers, but it does
+// depend on chunkSize, so both sides must agree on the same chunkSize.
+func CryptoGenericHashParallel(data []byte, chunkSize int, workers int) Bytes {
+	if chunkSize <= 0 {
+		panic(fmt.Sprintf("Incorrect chunk size, expected (> 0), got (%d).", chunkSize))
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	n := (len(data) + chunkSize - 1) / chunkSize
+	if workers > n {
+		workers = n
+	}
+	leaves := make([]byte, n*cryptoGenericHashBytes)
+
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				end := (i + 1) * chunkSize
+				if end > len(data) {
+					end = len(data)
+				}
+				h := NewGenericHash(cryptoGenericHashBytes)
+				var prefix [9]byte
+				binary.LittleEndian.PutUint64(prefix[1:], uint64(i))
+				h.Write(prefix[:])
+				h.Write(data[i*chunkSize : end])
+				h.Sum(leaves[i*cryptoGenericHashBytes : i*cryptoGenericHashBytes])
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	h := NewGenericHash(cryptoGenericHashBytes)
+	var prefix [17]byte
+	prefix[0] = 0x01
+	binary.LittleEndian.PutUint64(prefix[1:], uint64(chunkSize))
+	binary.LittleEndian.PutUint64(prefix[9:], uint64(len(data)))
+	h.Write(prefix[:])
+	h.Write(leaves)
+
+	return Bytes(h.Sum(nil))
+}
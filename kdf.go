@@ -4,7 +4,11 @@ package sodium
 // #include <stdlib.h>
 // #include <sodium.h>
 import "C"
-import "unsafe"
+import (
+	"encoding/binary"
+	"io"
+	"unsafe"
+)
 
 var (
 	cryptoKDFKeyBytes     = int(C.crypto_kdf_keybytes())
@@ -22,6 +26,10 @@ func (MasterKey) Size() int {
 	return cryptoKDFKeyBytes
 }
 
+func (k MasterKey) String() string {
+	return redacted("MasterKey", k.Bytes)
+}
+
 func (m MasterKey) Length() int {
 	return len(m.Bytes)
 }
@@ -33,6 +41,22 @@ func MakeMasterKey() MasterKey {
 	return MasterKey{mk}
 }
 
+// MakeMasterKeyFrom reads the MasterKey from r instead of generating a random one.
+// A nil r is the same as MakeMasterKey.
+func MakeMasterKeyFrom(r io.Reader) (MasterKey, error) {
+	if r == nil {
+		return MakeMasterKey(), nil
+	}
+	k := MasterKey{}
+	err := readTyped(&k, r)
+	return k, err
+}
+
+// MakeKDFKey generates a new MasterKey, same as MakeMasterKey.
+func MakeKDFKey() MasterKey {
+	return MakeMasterKey()
+}
+
 // SubKey derived from a MasterKey
 type SubKey struct {
 	Bytes
@@ -42,6 +66,10 @@ func (SubKey) Size() int {
 	return CryptoKDFBytesMax
 }
 
+func (k SubKey) String() string {
+	return redacted("SubKey", k.Bytes)
+}
+
 // KeyContext is a CryptoKDFContextBytes length string indicating
 // the context for the key. e.g. "username"
 type KeyContext string
@@ -60,12 +88,25 @@ func (k *KeyContext) setBytes(b Bytes) {
 	*k = KeyContext(s)
 }
 
+// MakeKeyContext pads s to CryptoKDFContextBytes. Only the first
+// CryptoKDFContextBytes of s is used.
 func MakeKeyContext(s string) KeyContext {
 	c := new(KeyContext)
 	c.setBytes(Bytes(s))
 	return *c
 }
 
+// KDFContext pads s to CryptoKDFContextBytes like MakeKeyContext.
+//
+// It returns an error if s is longer than CryptoKDFContextBytes, instead of
+// truncating it.
+func KDFContext(s string) (KeyContext, error) {
+	if len(s) > CryptoKDFContextBytes {
+		return "", ErrInvalidKeyContext
+	}
+	return MakeKeyContext(s), nil
+}
+
 // Derive SubKey from the MasterKey
 // length should be between CryptoKDFBytesMin and CryptoKDFBytesMax
 func (m MasterKey) Derive(length int, id uint64, context KeyContext) SubKey {
@@ -86,3 +127,64 @@ func (m MasterKey) Derive(length int, id uint64, context KeyContext) SubKey {
 
 	return SubKey{sk}
 }
+
+var (
+	kdfEncryptContext = MakeKeyContext("encrypt")
+	kdfAuthContext    = MakeKeyContext("auth")
+)
+
+const (
+	kdfEncryptID = 1
+	kdfAuthID    = 2
+)
+
+// DeriveEncryptAuthKeys derives from master a SecretBoxKey and a MACKey,
+// e.g. to encrypt with one and authenticate with the other. Each key has its
+// own id and context, so they are independent: knowing one doesn't tell
+// anything about the other or about master.
+//
+// The same master always gives the same keys.
+func DeriveEncryptAuthKeys(master MasterKey) (encKey SecretBoxKey, authKey MACKey) {
+	checkTypedSize(&master, "master key")
+
+	encKey = SecretBoxKey(master.Derive(encKey.Size(), kdfEncryptID, kdfEncryptContext))
+	authKey = MACKey(master.Derive(authKey.Size(), kdfAuthID, kdfAuthContext))
+	return
+}
+
+var deriveNoncePersonal = [16]byte{'s', 'o', 'd', 'i', 'u', 'm', ' ', 'n', 'o', 'n', 'c', 'e'}
+
+// DeriveNonce returns a nonce of nonceLen bytes for counter, the first
+// nonceLen bytes of the 64-byte BLAKE2b of LE64(counter) keyed with key and
+// personalized with "sodium nonce", e.g. for stateless systems which
+// reconstruct the nonce of a message from its sequence number.
+//
+// The same key and counter always give the same nonce, and distinct counters
+// give unrelated nonces, unique up to the birthday bound: about 2^(4*nonceLen)
+// counters for a collision, so 12-byte nonces are only safe for far fewer
+// messages than 24-byte ones. The nonces are only unpredictable as long as key
+// is secret, and key should be used for nothing else, e.g. derived with
+// MasterKey.Derive. A counter must still never be used twice with the same
+// encryption key.
+//
+// It panics unless 0 < nonceLen <= 64.
+func DeriveNonce(key GenericHashKey, counter uint64, nonceLen int) Bytes {
+	checkTypedSize(&key, "nonce key")
+	checkSizeInRange(nonceLen, 1, cryptoGenericHashBytesMax, "nonce")
+
+	var in [8]byte
+	binary.LittleEndian.PutUint64(in[:], counter)
+	out := make([]byte, cryptoGenericHashBytesMax)
+	if int(C.crypto_generichash_blake2b_salt_personal(
+		(*C.uchar)(&out[0]),
+		(C.size_t)(len(out)),
+		(*C.uchar)(&in[0]),
+		(C.ulonglong)(len(in)),
+		(*C.uchar)(&key.Bytes[0]),
+		(C.size_t)(key.Length()),
+		(*C.uchar)(nil),
+		(*C.uchar)(&deriveNoncePersonal[0]))) != 0 {
+		panic("see libsodium")
+	}
+	return out[:nonceLen]
+}
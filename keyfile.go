@@ -0,0 +1,220 @@
+package sodium
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"reflect"
+)
+
+// KeyFileVersion is the version of the format written by WriteKeyFile.
+const KeyFileVersion byte = 1
+
+const (
+	keyFileMagic       = "SODK"
+	keyFileHeaderBytes = len(keyFileMagic) + 4
+	keyFileKeyBytesMax = 64
+)
+
+// keyFileTypes maps the type identifiers of key files to their key types.
+// Identifiers must never be reused.
+var keyFileTypes = map[byte]func() Typed{
+	1:  func() Typed { return &AEADCPKey{} },
+	2:  func() Typed { return &AEADXCPKey{} },
+	3:  func() Typed { return &MACKey{} },
+	4:  func() Typed { return &BoxPublicKey{} },
+	5:  func() Typed { return &BoxSecretKey{} },
+	6:  func() Typed { return &BoxSeed{} },
+	7:  func() Typed { return &KXPublicKey{} },
+	8:  func() Typed { return &KXSecretKey{} },
+	9:  func() Typed { return &KXSessionKey{} },
+	10: func() Typed { return &KXSeed{} },
+	11: func() Typed { return &GenericHashKey{} },
+	12: func() Typed { return &MasterKey{} },
+	13: func() Typed { return &SubKey{} },
+	14: func() Typed { return &SecretBoxKey{} },
+	15: func() Typed { return &SecretStreamXCPKey{} },
+	16: func() Typed { return &ShortHashKey{} },
+	17: func() Typed { return &SignSeed{} },
+	18: func() Typed { return &SignSecretKey{} },
+	19: func() Typed { return &SignPublicKey{} },
+	20: func() Typed { return &HMACSHA256Key{} },
+	21: func() Typed { return &HMACSHA512Key{} },
+	22: func() Typed { return &SecretBoxXCPKey{} },
+}
+
+// typedBytes is implemented by the types embedding Bytes.
+type typedBytes interface {
+	bytes() Bytes
+}
+
+func keyFileType(key Typed) (byte, bool) {
+	for t, newKey := range keyFileTypes {
+		if reflect.TypeOf(newKey()) == reflect.TypeOf(key) {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+// WriteKeyFile writes key to w in a self-describing format:
+//
+//	"SODK" || version (1 byte) || type (1 byte) || length (2 bytes, big-endian) || key || checksum
+//
+// where the checksum is the 32-byte BLAKE2b of everything before it. key must
+// be a pointer to one of the key, seed or public key types of the package,
+// e.g. *SecretBoxKey; the AEGIS keys are not supported.
+//
+// It returns ErrUnsupportedAlgorithm if the type of key is not supported.
+func WriteKeyFile(w io.Writer, key Typed) error {
+	t, ok := keyFileType(key)
+	if !ok {
+		return ErrUnsupportedAlgorithm
+	}
+	checkTypedSize(key, "key")
+	k := key.(typedBytes).bytes()
+
+	var buf bytes.Buffer
+	buf.WriteString(keyFileMagic)
+	buf.WriteByte(KeyFileVersion)
+	buf.WriteByte(t)
+	var lb [2]byte
+	binary.BigEndian.PutUint16(lb[:], uint16(len(k)))
+	buf.Write(lb[:])
+	buf.Write(k)
+	buf.Write(keyFileChecksum(buf.Bytes()))
+
+	_, err := w.Write(buf.Bytes())
+	MemZero(buf.Bytes())
+	return err
+}
+
+// ReadKeyFile reads a key written by WriteKeyFile. The key is returned with its
+// concrete type, e.g. *SecretBoxKey.
+//
+// It returns ErrInvalidEncoding if r doesn't hold a key file,
+// ErrUnsupportedVersion or ErrUnsupportedAlgorithm if the file is of an
+// unknown version or key type, ErrInvalidChecksum if it is corrupted, and
+// io.ErrUnexpectedEOF if it is truncated.
+func ReadKeyFile(r io.Reader) (Typed, error) {
+	b := make([]byte, keyFileHeaderBytes, keyFileHeaderBytes+keyFileKeyBytesMax+cryptoGenericHashBytes)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	if string(b[:len(keyFileMagic)]) != keyFileMagic {
+		return nil, ErrInvalidEncoding
+	}
+	if b[len(keyFileMagic)] != KeyFileVersion {
+		return nil, ErrUnsupportedVersion
+	}
+	newKey, ok := keyFileTypes[b[len(keyFileMagic)+1]]
+	if !ok {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	l := int(binary.BigEndian.Uint16(b[len(keyFileMagic)+2:]))
+	if l > keyFileKeyBytesMax {
+		return nil, ErrInvalidEncoding
+	}
+
+	b = b[:keyFileHeaderBytes+l+cryptoGenericHashBytes]
+	if _, err := io.ReadFull(r, b[keyFileHeaderBytes:]); err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return nil, err
+	}
+	body := b[:keyFileHeaderBytes+l]
+	if !keyFileChecksum(body).Equal(b[len(body):]) {
+		MemZero(b)
+		return nil, ErrInvalidChecksum
+	}
+
+	key := newKey()
+	if !keyFileSizeValid(key, l) {
+		MemZero(b)
+		return nil, ErrInvalidEncoding
+	}
+	key.setBytes(Bytes(append([]byte{}, b[keyFileHeaderBytes:len(body)]...)))
+	MemZero(b)
+	return key, nil
+}
+
+// keyFileSizeValid reports whether l is a valid length for key, as
+// checkTypedSize checks without panicking.
+func keyFileSizeValid(key Typed, l int) bool {
+	switch key.(type) {
+	case *GenericHashKey:
+		return l >= cryptoGenericHashKeyBytesMin && l <= cryptoGenericHashKeyBytesMax
+	case *SubKey:
+		return l >= CryptoKDFBytesMin && l <= CryptoKDFBytesMax
+	}
+	return l == key.Size()
+}
+
+func keyFileChecksum(b []byte) Bytes {
+	h := NewGenericHash(cryptoGenericHashBytes)
+	h.Write(b)
+	return h.Sum(nil)
+}
+
+const secureDeleteBufBytes = 32 * 1024
+
+// SecureDeleteFile overwrites the contents of the file at path with zeros,
+// syncs it to the disk, then removes it, e.g. to delete a key file after a
+// rotation.
+//
+// This is best effort only. The zeros are written in place, but journaling
+// and copy-on-write filesystems (ext4 with data journaling, btrfs, ZFS, APFS)
+// may keep older copies of the blocks, SSDs and flash storage remap writes
+// to other cells by wear leveling, and backups, snapshots and swap are out of
+// reach. Other hard links to the file see the zeros. Full-disk encryption is
+// the only reliable protection of keys at rest.
+//
+// Symbolic links are not followed: path must be a regular file, or an
+// *os.PathError of os.ErrInvalid is returned and nothing is written.
+func SecureDeleteFile(path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return &os.PathError{Op: "securedelete", Path: path, Err: os.ErrInvalid}
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	// path may have been replaced, e.g. by a link, since Lstat
+	if ofi, err := f.Stat(); err != nil || !os.SameFile(fi, ofi) {
+		f.Close()
+		return &os.PathError{Op: "securedelete", Path: path, Err: os.ErrInvalid}
+	}
+	err = overwriteFile(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func overwriteFile(f *os.File) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, secureDeleteBufBytes)
+	MemZero(buf)
+	for remain := fi.Size(); remain > 0; {
+		n := int64(len(buf))
+		if remain < n {
+			n = remain
+		}
+		if _, err := f.Write(buf[:n]); err != nil {
+			return err
+		}
+		remain -= n
+	}
+	return f.Sync()
+}
@@ -0,0 +1,87 @@
+package sodium
+
+import "encoding/binary"
+
+const (
+	// MultiRecipientVersion is the version of the format written by
+	// MultiRecipientSeal.
+	MultiRecipientVersion byte = 1
+
+	// MultiRecipientMax is the largest number of recipients of a blob.
+	MultiRecipientMax = 1<<16 - 1
+
+	multiRecipientPrefixBytes = 3
+)
+
+// MultiRecipientSeal encrypts message once for all the recipients:
+//
+//	version (1 byte) || count (2 bytes, big-endian) || count sealed keys || envelope
+//
+// The message is sealed by SealEnvelopeWithAD with a random SecretStreamXCPKey,
+// authenticating everything before the envelope, and the key is sealed by
+// SealedBox for each recipient, in the order given. Each recipient adds
+// SealedBoxOverhead()+32 bytes.
+//
+// The recipients can tell how many they are, but not who the others are. They
+// are not authenticated to each other: each of them learns the key of the
+// envelope, so can seal another message that the others open as if it came
+// from the sender. Sign the blob, e.g. with SignDetached, if the recipients
+// must know who wrote it.
+//
+// It returns ErrInvalidRecipients if there are no recipients or more than
+// MultiRecipientMax, and ErrInvalidKey if a public key is weak.
+func MultiRecipientSeal(message []byte, recipients []BoxPublicKey) (blob []byte, err error) {
+	if len(recipients) == 0 || len(recipients) > MultiRecipientMax {
+		return nil, ErrInvalidRecipients
+	}
+	for i := range recipients {
+		if recipients[i].IsWeak() {
+			return nil, ErrInvalidKey
+		}
+	}
+
+	key := MakeSecretStreamXCPKey()
+	defer MemZero(key.Bytes)
+	wrappedBytes := key.Length() + cryptoBoxSealBytes
+	blob = make([]byte, multiRecipientPrefixBytes, multiRecipientPrefixBytes+len(recipients)*wrappedBytes)
+	blob[0] = MultiRecipientVersion
+	binary.BigEndian.PutUint16(blob[1:], uint16(len(recipients)))
+	for _, pk := range recipients {
+		blob = append(blob, key.Bytes.SealedBox(pk)...)
+	}
+	return append(blob, Bytes(message).SealEnvelopeWithAD(key, blob)...), nil
+}
+
+// MultiRecipientOpen decrypts a blob made by MultiRecipientSeal with the key
+// pair of one of its recipients.
+//
+// It returns ErrUnsupportedVersion if the blob is of an unknown format,
+// ErrInvalidHeader if it is too short, ErrOpenBox if the key pair is not one
+// of the recipients, and ErrDecryptSS if the message has been tampered with.
+func MultiRecipientOpen(blob []byte, pk BoxPublicKey, sk BoxSecretKey) ([]byte, error) {
+	b := Bytes(blob)
+	if b.Length() < multiRecipientPrefixBytes {
+		return nil, ErrInvalidHeader
+	}
+	if b[0] != MultiRecipientVersion {
+		return nil, ErrUnsupportedVersion
+	}
+	n := int(binary.BigEndian.Uint16(b[1:]))
+	wrappedBytes := cryptoSecretStreamXChaCha20Poly1305KeyBytes + cryptoBoxSealBytes
+	end := multiRecipientPrefixBytes + n*wrappedBytes
+	if n == 0 || b.Length() < end {
+		return nil, ErrInvalidHeader
+	}
+
+	kp := BoxKP{pk, sk}
+	for i := multiRecipientPrefixBytes; i < end; i += wrappedBytes {
+		k, err := b[i : i+wrappedBytes].SealedBoxOpen(kp)
+		if err != nil {
+			continue
+		}
+		m, err := b[end:].OpenEnvelopeWithAD(SecretStreamXCPKey{k}, b[:end])
+		MemZero(k)
+		return m, err
+	}
+	return nil, ErrOpenBox
+}
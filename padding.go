@@ -0,0 +1,139 @@
+package sodium
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// PaddingStrategy returns the padded length of n bytes of plain text, which
+// must be greater than n. Plain texts of lengths padded to the same length
+// can't be told apart by the length of their cipher text.
+type PaddingStrategy func(n int) int
+
+// PadToMultiple pads to the next multiple of blockSize.
+func PadToMultiple(blockSize int) PaddingStrategy {
+	if blockSize <= 0 {
+		panic(fmt.Sprintf("Incorrect padding block size, got (%d).", blockSize))
+	}
+	return func(n int) int {
+		return (n/blockSize + 1) * blockSize
+	}
+}
+
+// PadToPowerOfTwo pads to the next power of two, so that at most about half
+// of the cipher text is padding but only the magnitude of the length leaks.
+func PadToPowerOfTwo() PaddingStrategy {
+	return func(n int) int {
+		p := 1
+		for p <= n {
+			p <<= 1
+		}
+		return p
+	}
+}
+
+type paddingWriter struct {
+	w        io.WriteCloser
+	strategy PaddingStrategy
+	n        int
+	closed   bool
+}
+
+type unpaddingReader struct {
+	r    io.Reader
+	buf  []byte
+	held bytes.Buffer
+	out  []byte
+	err  error
+}
+
+// NewPaddingWriter returns a writer passing the plain text to w, e.g. made by
+// NewEncryptingWriter, and appending the padding of Pad on Close, before
+// closing w. The total length is given by strategy.
+//
+// The padding is removed by NewUnpaddingReader.
+func NewPaddingWriter(w io.WriteCloser, strategy PaddingStrategy) io.WriteCloser {
+	return &paddingWriter{w: w, strategy: strategy}
+}
+
+func (w *paddingWriter) Write(b []byte) (n int, err error) {
+	if w.closed {
+		return 0, ErrInvalidState
+	}
+	n, err = w.w.Write(b)
+	w.n += n
+	return
+}
+
+func (w *paddingWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	p := w.strategy(w.n)
+	if p <= w.n {
+		panic(fmt.Sprintf("Incorrect padded length, expected more than (%d), got (%d).", w.n, p))
+	}
+	if _, err := w.w.Write(Bytes(nil).Pad(p - w.n)); err != nil {
+		return err
+	}
+	return w.w.Close()
+}
+
+// NewUnpaddingReader returns a reader of the plain text read from r, e.g.
+// made by NewDecryptingReader, without the padding added by NewPaddingWriter.
+//
+// Data which may be the padding is held back until r ends. The reader returns
+// ErrInvalidPadding if the stream doesn't end with a valid padding.
+func NewUnpaddingReader(r io.Reader) io.Reader {
+	return &unpaddingReader{r: r, buf: make([]byte, SecretStreamChunkBytes)}
+}
+
+func (r *unpaddingReader) Read(b []byte) (n int, err error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.fill()
+	}
+	n = copy(b, r.out)
+	r.out = r.out[n:]
+	return
+}
+
+// fill reads from r and releases the data which can't be the padding, i.e.
+// everything before the last 0x80 followed by zeros only.
+func (r *unpaddingReader) fill() {
+	n, err := r.r.Read(r.buf)
+	r.held.Write(r.buf[:n])
+	h := r.held.Bytes()
+
+	if err != nil {
+		if err == io.EOF {
+			i := bytes.LastIndexByte(h, 0x80)
+			if i < 0 {
+				err = ErrInvalidPadding
+			} else if u, perr := Bytes(h).Unpad(len(h) - i); perr != nil {
+				err = ErrInvalidPadding
+			} else {
+				r.out = append(r.out[:0], u...)
+			}
+		}
+		r.held.Reset()
+		r.err = err
+		return
+	}
+
+	keep := len(h)
+	for keep > 0 && h[keep-1] == 0 {
+		keep--
+	}
+	if keep > 0 && h[keep-1] == 0x80 {
+		keep--
+	} else {
+		keep = len(h)
+	}
+	r.out = append(r.out[:0], h[:keep]...)
+	r.held.Next(keep)
+}
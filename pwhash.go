@@ -4,11 +4,16 @@ package sodium
 // #include <stdlib.h>
 // #include <sodium.h>
 import "C"
-import "unsafe"
+import (
+	"fmt"
+	"unsafe"
+)
 
 var (
 	cryptoPWHashSaltBytes           = int(C.crypto_pwhash_saltbytes())
 	cryptoPWHashStrBytes            = int(C.crypto_pwhash_strbytes())
+	cryptoPWHashBytesMin            = int(C.crypto_pwhash_bytes_min())
+	cryptoPWHashBytesMax            = uint64(C.crypto_pwhash_bytes_max())
 	CryptoPWHashOpsLimitInteractive = int(C.crypto_pwhash_opslimit_interactive())
 	CryptoPWHashMemLimitInteractive = int(C.crypto_pwhash_memlimit_interactive())
 	CryptoPWHashOpsLimitModerate    = int(C.crypto_pwhash_opslimit_moderate())
@@ -60,7 +65,7 @@ func (s *PWHashStr) setBytes(b Bytes) {
 func PWHashStore(pw string) PWHashStr {
 	s := make([]C.char, cryptoPWHashStrBytes)
 	pwc := C.CString(pw)
-	defer C.free(unsafe.Pointer(pwc))
+	defer freeWiped(pwc, len(pw))
 
 	if int(C.crypto_pwhash_str(
 		&s[0],
@@ -77,7 +82,7 @@ func PWHashStore(pw string) PWHashStr {
 func PWHashStoreSensitive(pw string) PWHashStr {
 	s := make([]C.char, cryptoPWHashStrBytes)
 	pwc := C.CString(pw)
-	defer C.free(unsafe.Pointer(pwc))
+	defer freeWiped(pwc, len(pw))
 
 	if int(C.crypto_pwhash_str(
 		&s[0],
@@ -94,7 +99,7 @@ func PWHashStoreSensitive(pw string) PWHashStr {
 func PWHashStoreInteractive(pw string) PWHashStr {
 	s := make([]C.char, cryptoPWHashStrBytes)
 	pwc := C.CString(pw)
-	defer C.free(unsafe.Pointer(pwc))
+	defer freeWiped(pwc, len(pw))
 
 	if int(C.crypto_pwhash_str(
 		&s[0],
@@ -107,12 +112,24 @@ func PWHashStoreInteractive(pw string) PWHashStr {
 	return PWHashStr{C.GoString(&s[0])}
 }
 
+// freeWiped wipes the C copy of a password before freeing it.
+func freeWiped(p *C.char, n int) {
+	C.sodium_memzero(unsafe.Pointer(p), C.size_t(n))
+	C.free(unsafe.Pointer(p))
+}
+
 // PWHashVerify verifies password.
+//
+// The verification is constant time: crypto_pwhash_str_verify hashes pw with
+// the parameters of s and compares the hashes with sodium_memcmp, and the
+// wrapper doesn't branch on pw or s. The time only depends on the parameters
+// and the length of pw, not on how much of the hash matches. Every failure
+// returns ErrPassword. The C copy of pw is wiped.
 func (s PWHashStr) PWHashVerify(pw string) (err error) {
 	sc := C.CString(s.string)
 	defer C.free(unsafe.Pointer(sc))
 	pwc := C.CString(pw)
-	defer C.free(unsafe.Pointer(pwc))
+	defer freeWiped(pwc, len(pw))
 	if int(C.crypto_pwhash_str_verify(
 		sc,
 		pwc,
@@ -121,3 +138,34 @@ func (s PWHashStr) PWHashVerify(pw string) (err error) {
 	}
 	return
 }
+
+// CryptoPwHash derives a key of length outlen from the password and salt with
+// the default algorithm, Argon2id. opslimit and memlimit should be the ones of
+// a profile, e.g. CryptoPWHashOpsLimitSensitive and
+// CryptoPWHashMemLimitSensitive, and must be the same to derive the key again.
+//
+// It returns an error if the derivation failed, e.g. running out of memory.
+// The C copy of pw is wiped. See CryptoPwHashWithTimeout to bound the time
+// spent, or show progress, with the sensitive profile.
+func CryptoPwHash(pw string, salt PWHashSalt, outlen int, opslimit, memlimit int) (key Bytes, err error) {
+	checkTypedSize(&salt, "salt")
+	if outlen < cryptoPWHashBytesMin || uint64(outlen) > cryptoPWHashBytesMax {
+		panic(fmt.Sprintf("Incorrect pwhash output length, expected (%d - %d), got (%d).",
+			cryptoPWHashBytesMin, cryptoPWHashBytesMax, outlen))
+	}
+	pwc := C.CString(pw)
+	defer freeWiped(pwc, len(pw))
+	key = make([]byte, outlen)
+	if rc := int(C.crypto_pwhash(
+		(*C.uchar)(&key[0]),
+		(C.ulonglong)(outlen),
+		pwc,
+		(C.ulonglong)(len(pw)),
+		(*C.uchar)(&salt.Bytes[0]),
+		(C.ulonglong)(opslimit),
+		(C.size_t)(memlimit),
+		C.crypto_pwhash_alg_default())); rc != 0 {
+		return nil, &SodiumError{"crypto_pwhash", rc}
+	}
+	return
+}
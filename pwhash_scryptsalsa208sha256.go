@@ -0,0 +1,135 @@
+package sodium
+
+// #cgo pkg-config: libsodium
+// #include <stdlib.h>
+// #include <sodium.h>
+import "C"
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+var (
+	cryptoPWHashScryptSaltBytes           = int(C.crypto_pwhash_scryptsalsa208sha256_saltbytes())
+	cryptoPWHashScryptStrBytes            = int(C.crypto_pwhash_scryptsalsa208sha256_strbytes())
+	cryptoPWHashScryptBytesMin            = int(C.crypto_pwhash_scryptsalsa208sha256_bytes_min())
+	cryptoPWHashScryptBytesMax            = uint64(C.crypto_pwhash_scryptsalsa208sha256_bytes_max())
+	CryptoPWHashScryptOpsLimitMin         = int(C.crypto_pwhash_scryptsalsa208sha256_opslimit_min())
+	CryptoPWHashScryptOpsLimitMax         = int(C.crypto_pwhash_scryptsalsa208sha256_opslimit_max())
+	CryptoPWHashScryptMemLimitMin         = int(C.crypto_pwhash_scryptsalsa208sha256_memlimit_min())
+	CryptoPWHashScryptMemLimitMax         = uint64(C.crypto_pwhash_scryptsalsa208sha256_memlimit_max())
+	CryptoPWHashScryptOpsLimitInteractive = int(C.crypto_pwhash_scryptsalsa208sha256_opslimit_interactive())
+	CryptoPWHashScryptMemLimitInteractive = int(C.crypto_pwhash_scryptsalsa208sha256_memlimit_interactive())
+	CryptoPWHashScryptOpsLimitSensitive   = int(C.crypto_pwhash_scryptsalsa208sha256_opslimit_sensitive())
+	CryptoPWHashScryptMemLimitSensitive   = int(C.crypto_pwhash_scryptsalsa208sha256_memlimit_sensitive())
+)
+
+// PWHashScryptSalt implements the Typed interface
+type PWHashScryptSalt struct {
+	Bytes
+}
+
+func (s PWHashScryptSalt) Size() int {
+	return cryptoPWHashScryptSaltBytes
+}
+
+// PWHashScryptStr is a scrypt password hash in the "$7$" format.
+// It is meant for verifying legacy hashes before rehashing with PWHashStore.
+type PWHashScryptStr struct {
+	string
+}
+
+// LoadPWHashScryptStr loads a stored hash. Trailing NUL bytes are ignored.
+func LoadPWHashScryptStr(b Bytes) PWHashScryptStr {
+	t := new(PWHashScryptStr)
+	t.setBytes(b)
+	return *t
+}
+
+// Value returns the underlying bytes for PWHashScryptStr
+func (s PWHashScryptStr) Value() Bytes {
+	return Bytes(s.string)
+}
+
+// Size returns the maximum size of the hash including the terminating NUL.
+func (s PWHashScryptStr) Size() int {
+	return cryptoPWHashScryptStrBytes
+}
+
+func (s PWHashScryptStr) Length() int {
+	return len(s.string)
+}
+
+func (s *PWHashScryptStr) setBytes(b Bytes) {
+	t := PWHashScryptStr{strings.TrimRight(string(b), "\x00")}
+	checkSizeInRange(t.Length(), 1, t.Size()-1, "PWHashScryptStr")
+	*s = t
+}
+
+func pwHashScryptStore(pw string, opslimit, memlimit int) PWHashScryptStr {
+	s := make([]C.char, cryptoPWHashScryptStrBytes)
+	pwc := C.CString(pw)
+	defer freeWiped(pwc, len(pw))
+
+	if int(C.crypto_pwhash_scryptsalsa208sha256_str(
+		&s[0],
+		pwc,
+		(C.ulonglong)(len(pw)),
+		(C.ulonglong)(opslimit),
+		(C.size_t)(memlimit))) != 0 {
+		panic("see libsodium")
+	}
+	return PWHashScryptStr{C.GoString(&s[0])}
+}
+
+// PWHashScryptStoreInteractive use scrypt interactive profile to pack hashed password into PWHashScryptStr.
+func PWHashScryptStoreInteractive(pw string) PWHashScryptStr {
+	return pwHashScryptStore(pw, CryptoPWHashScryptOpsLimitInteractive, CryptoPWHashScryptMemLimitInteractive)
+}
+
+// PWHashScryptStoreSensitive use scrypt sensitive profile to pack hashed password into PWHashScryptStr.
+func PWHashScryptStoreSensitive(pw string) PWHashScryptStr {
+	return pwHashScryptStore(pw, CryptoPWHashScryptOpsLimitSensitive, CryptoPWHashScryptMemLimitSensitive)
+}
+
+// PWHashVerify verifies password, in constant time as PWHashStr.PWHashVerify.
+func (s PWHashScryptStr) PWHashVerify(pw string) (err error) {
+	sc := C.CString(s.string)
+	defer C.free(unsafe.Pointer(sc))
+	pwc := C.CString(pw)
+	defer freeWiped(pwc, len(pw))
+	if int(C.crypto_pwhash_scryptsalsa208sha256_str_verify(
+		sc,
+		pwc,
+		(C.ulonglong)(len(pw)))) != 0 {
+		err = ErrPassword
+	}
+	return
+}
+
+// PWHashScrypt derives a key of length outlen from the password and salt with scrypt.
+// opslimit and memlimit should be between their min and max, e.g. the
+// interactive or sensitive profile.
+//
+// It returns an error if the derivation failed, e.g. running out of memory.
+func PWHashScrypt(pw string, salt PWHashScryptSalt, outlen int, opslimit, memlimit int) (key Bytes, err error) {
+	checkTypedSize(&salt, "salt")
+	if outlen < cryptoPWHashScryptBytesMin || uint64(outlen) > cryptoPWHashScryptBytesMax {
+		panic(fmt.Sprintf("Incorrect scrypt output length, expected (%d - %d), got (%d).",
+			cryptoPWHashScryptBytesMin, cryptoPWHashScryptBytesMax, outlen))
+	}
+	pwp, pwl := plen([]byte(pw))
+	key = make([]byte, outlen)
+	if rc := int(C.crypto_pwhash_scryptsalsa208sha256(
+		(*C.uchar)(&key[0]),
+		(C.ulonglong)(outlen),
+		(*C.char)(pwp),
+		(C.ulonglong)(pwl),
+		(*C.uchar)(&salt.Bytes[0]),
+		(C.ulonglong)(opslimit),
+		(C.size_t)(memlimit))); rc != 0 {
+		return nil, &SodiumError{"crypto_pwhash_scryptsalsa208sha256", rc}
+	}
+	return
+}
@@ -0,0 +1,23 @@
+package sodium
+
+// #cgo pkg-config: libsodium
+// #include <stdlib.h>
+// #include <sodium.h>
+import "C"
+
+// RandomBytesClose releases the resources of the random number generator of
+// libsodium, which the Make* functions use to generate keys, e.g. the file
+// descriptor of /dev/urandom on systems without getrandom.
+//
+// Programs forking a child process which keeps using libsodium, e.g. through
+// cgo, should call it before forking, so the child doesn't share the state of
+// the parent. The generator is initialized again on the next use, in both
+// processes. Go's own fork and exec, as done by os/exec, doesn't need it.
+//
+// It returns a *SodiumError if there was nothing to release.
+func RandomBytesClose() error {
+	if rc := int(C.randombytes_close()); rc != 0 {
+		return &SodiumError{"randombytes_close", rc}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package sodium
+
+import (
+	"encoding/base32"
+	"strings"
+)
+
+const (
+	recoveryKeyChecksumBytes = 4
+	recoveryKeyGroupSize     = 4
+)
+
+var recoveryKeyEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateRecoveryKey generates a random SecretStreamXCPKey and its mnemonic,
+// a text for users to write down and type back with ParseRecoveryKey.
+//
+// The mnemonic is the unpadded base32 (RFC 4648) of the key followed by a
+// checksum, the first 4 bytes of its 16-byte BLAKE2b, in groups of 4
+// characters separated by dashes.
+func GenerateRecoveryKey() (key SecretStreamXCPKey, mnemonic string) {
+	key = MakeSecretStreamXCPKey()
+	b := append(append(Bytes{}, key.Bytes...), recoveryKeyChecksum(key.Bytes)...)
+	s := recoveryKeyEncoding.EncodeToString(b)
+	MemZero(b)
+
+	return key, groupString(s, recoveryKeyGroupSize)
+}
+
+// groupString splits s in groups of size characters separated by dashes, to
+// be read and typed by users.
+func groupString(s string, size int) string {
+	groups := make([]string, 0, (len(s)+size-1)/size)
+	for len(s) > size {
+		groups = append(groups, s[:size])
+		s = s[size:]
+	}
+	groups = append(groups, s)
+	return strings.Join(groups, "-")
+}
+
+// ParseRecoveryKey reads back the key from a mnemonic made by
+// GenerateRecoveryKey. Case, spaces and dashes are ignored.
+//
+// It returns ErrInvalidEncoding if the mnemonic is malformed, and
+// ErrInvalidChecksum if it has been mistyped.
+func ParseRecoveryKey(mnemonic string) (SecretStreamXCPKey, error) {
+	s := strings.Map(func(r rune) rune {
+		switch r {
+		case '-', ' ', '\t', '\n', '\r':
+			return -1
+		}
+		return r
+	}, strings.ToUpper(mnemonic))
+
+	b, err := recoveryKeyEncoding.DecodeString(s)
+	if err != nil || len(b) != cryptoSecretStreamXChaCha20Poly1305KeyBytes+recoveryKeyChecksumBytes {
+		return SecretStreamXCPKey{}, ErrInvalidEncoding
+	}
+	k := Bytes(b[:cryptoSecretStreamXChaCha20Poly1305KeyBytes])
+	if !recoveryKeyChecksum(k).Equal(b[len(k):]) {
+		MemZero(b)
+		return SecretStreamXCPKey{}, ErrInvalidChecksum
+	}
+	return SecretStreamXCPKey{k}, nil
+}
+
+func recoveryKeyChecksum(k Bytes) Bytes {
+	h := NewGenericHash(cryptoGenericHashBytesMin)
+	h.Write(k)
+	return Bytes(h.Sum(nil)[:recoveryKeyChecksumBytes])
+}
@@ -3,6 +3,18 @@ package sodium
 // #cgo pkg-config: libsodium
 // #include <stdlib.h>
 // #include <sodium.h>
+//
+// static int scalarmult_base_batch(unsigned char *q, const unsigned char *n, size_t count)
+// {
+//     size_t i;
+//     for (i = 0; i < count; i++) {
+//         if (crypto_scalarmult_base(q + i * crypto_scalarmult_BYTES,
+//                                    n + i * crypto_scalarmult_SCALARBYTES) != 0) {
+//             return -1;
+//         }
+//     }
+//     return 0;
+// }
 import "C"
 
 var (
@@ -58,3 +70,33 @@ func CryptoScalarmult(n, p Scalar) (q ScalarMult) {
 
 	return ScalarMult{qb}
 }
+
+// CryptoScalarmultBaseBatch is CryptoScalarmultBase for each of ns, in a
+// single call into libsodium. The results share one allocation. It saves the
+// overhead of the calls, e.g. when making many ephemeral public keys.
+func CryptoScalarmultBaseBatch(ns []Scalar) (qs []Scalar) {
+	if len(ns) == 0 {
+		return nil
+	}
+	nb := make([]byte, 0, len(ns)*cryptoScalarmultScalarBytes)
+	for i := range ns {
+		checkTypedSize(&ns[i], "SecretKey")
+		nb = append(nb, ns[i].Bytes...)
+	}
+	qb := make([]byte, len(ns)*cryptoScalarmultBytes)
+
+	ret := int(C.scalarmult_base_batch(
+		(*C.uchar)(&qb[0]),
+		(*C.uchar)(&nb[0]),
+		(C.size_t)(len(ns))))
+	MemZero(nb)
+	if ret != 0 {
+		panic("see libsodium")
+	}
+
+	qs = make([]Scalar, len(ns))
+	for i := range qs {
+		qs[i] = Scalar{qb[i*cryptoScalarmultBytes : (i+1)*cryptoScalarmultBytes : (i+1)*cryptoScalarmultBytes]}
+	}
+	return
+}
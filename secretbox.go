@@ -11,6 +11,11 @@ var (
 	cryptoSecretBoxMacBytes   = int(C.crypto_secretbox_macbytes())
 )
 
+// SecretBoxOverhead returns the number of bytes SecretBox adds to a message.
+func SecretBoxOverhead() int {
+	return cryptoSecretBoxMacBytes
+}
+
 type SecretBoxKey struct {
 	Bytes
 }
@@ -19,6 +24,10 @@ func (s SecretBoxKey) Size() int {
 	return cryptoSecretBoxKeyBytes
 }
 
+func (k SecretBoxKey) String() string {
+	return redacted("SecretBoxKey", k.Bytes)
+}
+
 type SecretBoxNonce struct {
 	Bytes
 }
@@ -39,10 +48,18 @@ func (s SecretBoxMAC) Size() int {
 	return cryptoSecretBoxMacBytes
 }
 
+// Equal reports whether s and o are the same MAC, comparing them in
+// constant time with crypto_verify_16.
+func (s SecretBoxMAC) Equal(o Bytes) bool {
+	return Verify16(s.Bytes, o)
+}
+
 // SecretBox use a SecretBoxNonce and a SecretBoxKey to encrypt a message.
 func (b Bytes) SecretBox(n SecretBoxNonce, k SecretBoxKey) (c Bytes) {
-	checkTypedSize(&n, "nonce")
-	checkTypedSize(&k, "secret key")
+	checkSize(n.Bytes, cryptoSecretBoxNonceBytes, "nonce")
+	checkSize(k.Bytes, cryptoSecretBoxKeyBytes, "secret key")
+	checkStrict(n.Bytes, "nonce")
+	checkStrict(k.Bytes, "secret key")
 
 	bp, bl := plen(b)
 	c = make([]byte, bl+cryptoSecretBoxMacBytes)
@@ -58,13 +75,41 @@ func (b Bytes) SecretBox(n SecretBoxNonce, k SecretBoxKey) (c Bytes) {
 	return
 }
 
+// SecretBoxInto is SecretBox writing the box into dst, which is only
+// allocated if its capacity is less than b.Length()+SecretBoxOverhead(), e.g.
+// to reuse a buffer across messages. It returns dst resliced to the box.
+// dst must not overlap b.
+func (b Bytes) SecretBoxInto(dst Bytes, n SecretBoxNonce, k SecretBoxKey) (c Bytes) {
+	checkSize(n.Bytes, cryptoSecretBoxNonceBytes, "nonce")
+	checkSize(k.Bytes, cryptoSecretBoxKeyBytes, "secret key")
+	checkStrict(n.Bytes, "nonce")
+	checkStrict(k.Bytes, "secret key")
+
+	bp, bl := plen(b)
+	c = into(dst, bl+cryptoSecretBoxMacBytes)
+	if int(C.crypto_secretbox_easy(
+		(*C.uchar)(&c[0]),
+		(*C.uchar)(bp),
+		(C.ulonglong)(bl),
+		(*C.uchar)(&n.Bytes[0]),
+		(*C.uchar)(&k.Bytes[0]))) != 0 {
+		panic("see libsodium")
+	}
+
+	return
+}
+
 // SecretBoxOpen opens a SecretBox using SecretBoxKey and SecretBoxNonce.
 //
 // It returns an error if opening failed.
 func (b Bytes) SecretBoxOpen(n SecretBoxNonce, k SecretBoxKey) (m Bytes, err error) {
-	checkTypedSize(&n, "nonce")
-	checkTypedSize(&k, "secret key")
+	checkSize(n.Bytes, cryptoSecretBoxNonceBytes, "nonce")
+	checkSize(k.Bytes, cryptoSecretBoxKeyBytes, "secret key")
+	checkStrict(k.Bytes, "secret key")
 	bp, bl := plen(b)
+	if bl < cryptoSecretBoxMacBytes {
+		return nil, ErrOpenBox
+	}
 	m = make([]byte, bl-cryptoSecretBoxMacBytes)
 	mp, _ := plen(m)
 	if int(C.crypto_secretbox_open_easy(
@@ -79,11 +124,39 @@ func (b Bytes) SecretBoxOpen(n SecretBoxNonce, k SecretBoxKey) (m Bytes, err err
 	return
 }
 
+// SecretBoxOpenInto is SecretBoxOpen writing the message into dst, which is
+// only allocated if its capacity is too small, like SecretBoxInto.
+//
+// It returns an error if opening failed.
+func (b Bytes) SecretBoxOpenInto(dst Bytes, n SecretBoxNonce, k SecretBoxKey) (m Bytes, err error) {
+	checkSize(n.Bytes, cryptoSecretBoxNonceBytes, "nonce")
+	checkSize(k.Bytes, cryptoSecretBoxKeyBytes, "secret key")
+	checkStrict(k.Bytes, "secret key")
+	bp, bl := plen(b)
+	if bl < cryptoSecretBoxMacBytes {
+		return nil, ErrOpenBox
+	}
+	m = into(dst, bl-cryptoSecretBoxMacBytes)
+	mp, _ := plen(m)
+	if int(C.crypto_secretbox_open_easy(
+		(*C.uchar)(mp),
+		(*C.uchar)(bp),
+		(C.ulonglong)(bl),
+		(*C.uchar)(&n.Bytes[0]),
+		(*C.uchar)(&k.Bytes[0]))) != 0 {
+		return nil, ErrOpenBox
+	}
+
+	return
+}
+
 // SecretBoxDetached use a SecretBoxNonce and a SecretBoxKey to encrypt a message.
 // A separate MAC is returned.
 func (b Bytes) SecretBoxDetached(n SecretBoxNonce, k SecretBoxKey) (c Bytes, mac SecretBoxMAC) {
 	checkTypedSize(&n, "nonce")
 	checkTypedSize(&k, "secret key")
+	checkStrict(n.Bytes, "nonce")
+	checkStrict(k.Bytes, "secret key")
 	bp, bl := plen(b)
 	c = make([]byte, bl)
 	cp, _ := plen(c)
@@ -110,6 +183,7 @@ func (b Bytes) SecretBoxOpenDetached(mac SecretBoxMAC, n SecretBoxNonce, k Secre
 	checkTypedSize(&mac, "mac")
 	checkTypedSize(&n, "nonce")
 	checkTypedSize(&k, "key")
+	checkStrict(k.Bytes, "key")
 
 	bp, bl := plen(b)
 	m = make([]byte, bl)
@@ -0,0 +1,156 @@
+package sodium
+
+// #cgo pkg-config: libsodium
+// #include <stdlib.h>
+// #include <sodium.h>
+import "C"
+
+var (
+	cryptoSecretBoxXCPKeyBytes   = int(C.crypto_secretbox_xchacha20poly1305_keybytes())
+	cryptoSecretBoxXCPNonceBytes = int(C.crypto_secretbox_xchacha20poly1305_noncebytes())
+	cryptoSecretBoxXCPMacBytes   = int(C.crypto_secretbox_xchacha20poly1305_macbytes())
+)
+
+// SecretBoxXCPOverhead returns the number of bytes SecretBoxXCP adds to a message.
+func SecretBoxXCPOverhead() int {
+	return cryptoSecretBoxXCPMacBytes
+}
+
+// SecretBoxXCPKey is the key of SecretBoxXCP, the variant of SecretBox using
+// XChaCha20-Poly1305 instead of XSalsa20-Poly1305, as secret streams do. Keys,
+// nonces and MACs are of the same sizes as the ones of SecretBox, but the
+// boxes are not compatible.
+type SecretBoxXCPKey struct {
+	Bytes
+}
+
+func (s SecretBoxXCPKey) Size() int {
+	return cryptoSecretBoxXCPKeyBytes
+}
+
+func (k SecretBoxXCPKey) String() string {
+	return redacted("SecretBoxXCPKey", k.Bytes)
+}
+
+type SecretBoxXCPNonce struct {
+	Bytes
+}
+
+func (n SecretBoxXCPNonce) Size() int {
+	return cryptoSecretBoxXCPNonceBytes
+}
+
+func (n *SecretBoxXCPNonce) Next() {
+	C.sodium_increment((*C.uchar)(&n.Bytes[0]), (C.size_t)(cryptoSecretBoxXCPNonceBytes))
+}
+
+type SecretBoxXCPMAC struct {
+	Bytes
+}
+
+func (s SecretBoxXCPMAC) Size() int {
+	return cryptoSecretBoxXCPMacBytes
+}
+
+// Equal reports whether s and o are the same MAC, comparing them in
+// constant time with crypto_verify_16.
+func (s SecretBoxXCPMAC) Equal(o Bytes) bool {
+	return Verify16(s.Bytes, o)
+}
+
+// SecretBoxXCP use a SecretBoxXCPNonce and a SecretBoxXCPKey to encrypt a message.
+func (b Bytes) SecretBoxXCP(n SecretBoxXCPNonce, k SecretBoxXCPKey) (c Bytes) {
+	checkTypedSize(&n, "nonce")
+	checkTypedSize(&k, "secret key")
+	checkStrict(n.Bytes, "nonce")
+	checkStrict(k.Bytes, "secret key")
+
+	bp, bl := plen(b)
+	c = make([]byte, bl+cryptoSecretBoxXCPMacBytes)
+	if int(C.crypto_secretbox_xchacha20poly1305_easy(
+		(*C.uchar)(&c[0]),
+		(*C.uchar)(bp),
+		(C.ulonglong)(bl),
+		(*C.uchar)(&n.Bytes[0]),
+		(*C.uchar)(&k.Bytes[0]))) != 0 {
+		panic("see libsodium")
+	}
+
+	return
+}
+
+// SecretBoxXCPOpen opens a SecretBoxXCP using SecretBoxXCPKey and SecretBoxXCPNonce.
+//
+// It returns an error if opening failed.
+func (b Bytes) SecretBoxXCPOpen(n SecretBoxXCPNonce, k SecretBoxXCPKey) (m Bytes, err error) {
+	checkTypedSize(&n, "nonce")
+	checkTypedSize(&k, "secret key")
+	checkStrict(k.Bytes, "secret key")
+	bp, bl := plen(b)
+	if bl < cryptoSecretBoxXCPMacBytes {
+		return nil, ErrOpenBox
+	}
+	m = make([]byte, bl-cryptoSecretBoxXCPMacBytes)
+	mp, _ := plen(m)
+	if int(C.crypto_secretbox_xchacha20poly1305_open_easy(
+		(*C.uchar)(mp),
+		(*C.uchar)(bp),
+		(C.ulonglong)(bl),
+		(*C.uchar)(&n.Bytes[0]),
+		(*C.uchar)(&k.Bytes[0]))) != 0 {
+		err = ErrOpenBox
+	}
+
+	return
+}
+
+// SecretBoxXCPDetached use a SecretBoxXCPNonce and a SecretBoxXCPKey to encrypt a message.
+// A separate MAC is returned.
+func (b Bytes) SecretBoxXCPDetached(n SecretBoxXCPNonce, k SecretBoxXCPKey) (c Bytes, mac SecretBoxXCPMAC) {
+	checkTypedSize(&n, "nonce")
+	checkTypedSize(&k, "secret key")
+	checkStrict(n.Bytes, "nonce")
+	checkStrict(k.Bytes, "secret key")
+	bp, bl := plen(b)
+	c = make([]byte, bl)
+	cp, _ := plen(c)
+	macb := make([]byte, cryptoSecretBoxXCPMacBytes)
+	if int(C.crypto_secretbox_xchacha20poly1305_detached(
+		(*C.uchar)(cp),
+		(*C.uchar)(&macb[0]),
+		(*C.uchar)(bp),
+		(C.ulonglong)(bl),
+		(*C.uchar)(&n.Bytes[0]),
+		(*C.uchar)(&k.Bytes[0]))) != 0 {
+		panic("see libsodium")
+	}
+	mac = SecretBoxXCPMAC{macb}
+
+	return
+}
+
+// SecretBoxXCPOpenDetached opens a SecretBoxXCP using SecretBoxXCPKey and SecretBoxXCPNonce.
+// with a separate MAC.
+//
+// It returns an error if opening failed.
+func (b Bytes) SecretBoxXCPOpenDetached(mac SecretBoxXCPMAC, n SecretBoxXCPNonce, k SecretBoxXCPKey) (m Bytes, err error) {
+	checkTypedSize(&mac, "mac")
+	checkTypedSize(&n, "nonce")
+	checkTypedSize(&k, "key")
+	checkStrict(k.Bytes, "key")
+
+	bp, bl := plen(b)
+	m = make([]byte, bl)
+	mp, _ := plen(m)
+	if int(C.crypto_secretbox_xchacha20poly1305_open_detached(
+		(*C.uchar)(mp),
+		(*C.uchar)(bp),
+		(*C.uchar)(&mac.Bytes[0]),
+		(C.ulonglong)(bl),
+		(*C.uchar)(&n.Bytes[0]),
+		(*C.uchar)(&k.Bytes[0]))) != 0 {
+		err = ErrOpenBox
+	}
+
+	return
+}
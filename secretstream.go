@@ -6,14 +6,30 @@ package sodium
 import "C"
 
 import (
+	"fmt"
 	"io"
+	"unsafe"
 )
 
 var (
 	cryptoSecretStreamXChaCha20Poly1305KeyBytes    = int(C.crypto_secretstream_xchacha20poly1305_keybytes())
 	cryptoSecretStreamXChaCha20Poly1305HeaderBytes = int(C.crypto_secretstream_xchacha20poly1305_headerbytes())
+	cryptoSecretStreamXChaCha20Poly1305ABytes      = int(C.crypto_secretstream_xchacha20poly1305_abytes())
+	cryptoSecretStreamXChaCha20Poly1305MsgBytesMax = uint64(C.crypto_secretstream_xchacha20poly1305_messagebytes_max())
 )
 
+// SecretStreamMessageBytesMax returns the maximum length of a message chunk
+// accepted by the encoder.
+func SecretStreamMessageBytesMax() uint64 {
+	return cryptoSecretStreamXChaCha20Poly1305MsgBytesMax
+}
+
+// SecretStreamOverhead returns the number of bytes the encoder adds to each
+// message chunk. The header is not included.
+func SecretStreamOverhead() int {
+	return cryptoSecretStreamXChaCha20Poly1305ABytes
+}
+
 // SecretStreamTag can be set to encoder for modify stream state or can be get from decoder
 type SecretStreamTag uint8
 
@@ -69,6 +85,10 @@ func (SecretStreamXCPKey) Size() int {
 	return cryptoSecretStreamXChaCha20Poly1305KeyBytes
 }
 
+func (k SecretStreamXCPKey) String() string {
+	return redacted("SecretStreamXCPKey", k.Bytes)
+}
+
 // MakeSecretStreamXCPKey initilize the key
 func MakeSecretStreamXCPKey() SecretStreamXCPKey {
 	b := make([]byte, cryptoSecretStreamXChaCha20Poly1305KeyBytes)
@@ -76,6 +96,51 @@ func MakeSecretStreamXCPKey() SecretStreamXCPKey {
 	return SecretStreamXCPKey{b}
 }
 
+// MakeSecretStreamXCPKeyFrom reads the key from r instead of generating a random one.
+// A nil r is the same as MakeSecretStreamXCPKey.
+//
+// It is meant for injecting deterministic keys in tests.
+func MakeSecretStreamXCPKeyFrom(r io.Reader) (SecretStreamXCPKey, error) {
+	if r == nil {
+		return MakeSecretStreamXCPKey(), nil
+	}
+	k := SecretStreamXCPKey{}
+	err := readTyped(&k, r)
+	return k, err
+}
+
+// ParseSecretStreamXCPKeyHex loads a key encoded by Hex.
+//
+// It returns ErrInvalidEncoding if s is not hexadecimal, or ErrInvalidKey if
+// the key is of wrong size.
+func ParseSecretStreamXCPKeyHex(s string) (SecretStreamXCPKey, error) {
+	b, err := ParseHex(s)
+	if err != nil {
+		return SecretStreamXCPKey{}, err
+	}
+	return loadSecretStreamXCPKey(b)
+}
+
+// ParseSecretStreamXCPKeyBase64 loads a key encoded by Base64 with the same variant.
+//
+// It returns ErrInvalidEncoding if s is not base64 of the variant, or
+// ErrInvalidKey if the key is of wrong size.
+func ParseSecretStreamXCPKeyBase64(s string, v Base64Variant) (SecretStreamXCPKey, error) {
+	b, err := ParseBase64(s, v)
+	if err != nil {
+		return SecretStreamXCPKey{}, err
+	}
+	return loadSecretStreamXCPKey(b)
+}
+
+func loadSecretStreamXCPKey(b Bytes) (SecretStreamXCPKey, error) {
+	k := SecretStreamXCPKey{b}
+	if k.Length() != k.Size() {
+		return SecretStreamXCPKey{}, ErrInvalidKey
+	}
+	return k, nil
+}
+
 // SecretStreamXCPHeader generated by encoder and can be transferred in plain text. It must set to decoder before decoding
 type SecretStreamXCPHeader struct {
 	Bytes
@@ -85,6 +150,9 @@ func (SecretStreamXCPHeader) Size() int {
 	return cryptoSecretStreamXChaCha20Poly1305HeaderBytes
 }
 
+// SecretStreamEncoder is implemented by *SecretStreamXCPEncoder, the type of
+// the encoders made by the package, which also has Rekey, SetRekeyInterval
+// and WriteWithAD.
 type SecretStreamEncoder interface {
 	io.WriteCloser
 	Header() SecretStreamXCPHeader
@@ -93,6 +161,9 @@ type SecretStreamEncoder interface {
 	WriteAndClose(b []byte) (n int, err error)
 }
 
+// SecretStreamDecoder is implemented by *SecretStreamXCPDecoder, the type of
+// the decoders made by the package, which also has ReadWithAD, PeekTag, Next
+// and ReadEmptyChunk.
 type SecretStreamDecoder interface {
 	io.Reader
 	SetAdditionData(ad []byte)
@@ -106,14 +177,115 @@ type SecretStreamXCPEncoder struct {
 	ad     Bytes
 	tag    SecretStreamTag
 	final  bool
+	buf    []byte
+
+	writesHeader  bool
+	headerPending bool
+	salt          Bytes
+
+	rekeyPending bool
+	rekeyEvery   int
+	chunks       int
 }
 
 type SecretStreamXCPDecoder struct {
-	in    io.Reader
-	state C.crypto_secretstream_xchacha20poly1305_state
-	ad    Bytes
-	tag   SecretStreamTag
-	final bool
+	in      io.Reader
+	key     SecretStreamXCPKey
+	state   C.crypto_secretstream_xchacha20poly1305_state
+	ad      Bytes
+	tag     SecretStreamTag
+	final   bool
+	bufSize int
+	cbuf    []byte
+	mbuf    []byte
+	pending []byte
+	peeked  bool
+	ended   bool // the reader ended before the last chunk read
+
+	maxBytes int64
+	total    int64
+
+	nonBlocking bool
+	partial     int
+}
+
+// SecretStreamDecoderOption configures a SecretStreamXCPDecoder when it is made.
+type SecretStreamDecoderOption func(*SecretStreamXCPDecoder)
+
+// ReadBufferSize makes the decoder read chunks of n bytes of plain text (n +
+// abytes of cipher text) from the underlying reader, regardless of the size of
+// the buffer passed to Read. Decrypted data not fitting into the caller's buffer
+// is kept and returned by the following calls to Read.
+//
+// The stream carries no length framing, so n must match the size of the chunks
+// written by the encoder: every chunk except the last one must be exactly n
+// bytes. A shorter chunk is only accepted at the end of the stream, i.e. by
+// WriteAndClose or Close.
+//
+// Without this option, each Read consumes one chunk of len(b) bytes.
+func ReadBufferSize(n int) SecretStreamDecoderOption {
+	if n <= 0 {
+		panic(fmt.Sprintf("Incorrect read buffer size, got (%d).", n))
+	}
+	return func(d *SecretStreamXCPDecoder) {
+		d.bufSize = n
+	}
+}
+
+// MaxPlaintextBytes limits the plain text decrypted by the decoder to n bytes
+// in total, e.g. to bound the resources spent on an untrusted stream. Reading
+// the chunk going over it returns ErrPlaintextTooLarge, without its plain text,
+// and so do all the following reads.
+func MaxPlaintextBytes(n int64) SecretStreamDecoderOption {
+	if n <= 0 {
+		panic(fmt.Sprintf("Incorrect max plain text size, got (%d).", n))
+	}
+	return func(d *SecretStreamXCPDecoder) {
+		d.maxBytes = n
+	}
+}
+
+// NonBlocking makes the decoder return the errors of the underlying reader
+// other than io.EOF as they come, instead of retrying until a whole chunk is
+// read, e.g. for non-blocking readers or readers with deadlines in event loops.
+// A read of no bytes without error returns io.ErrNoProgress.
+//
+// The cipher text of the chunk read so far is kept, and the next Read carries
+// on with it once the caller knows more data is there, so no data is lost
+// whatever the error. Since the stream carries no length framing, the chunk
+// must be read again with the same size: without ReadBufferSize, Read must be
+// given a buffer of the same length until the chunk is complete, or it returns
+// ErrInvalidState. The decoders reading the header themselves, e.g.
+// MakeSecretStreamXCPDecoderAutoHeader, still read it in one go.
+func NonBlocking() SecretStreamDecoderOption {
+	return func(d *SecretStreamXCPDecoder) {
+		d.nonBlocking = true
+	}
+}
+
+// countPlaintext adds n bytes to the plain text decrypted, and returns
+// ErrPlaintextTooLarge if it goes over MaxPlaintextBytes.
+func (e *SecretStreamXCPDecoder) countPlaintext(n int) error {
+	e.total += int64(n)
+	return e.checkPlaintext()
+}
+
+// checkPlaintext returns ErrPlaintextTooLarge once the plain text decrypted
+// has gone over MaxPlaintextBytes, so no more chunks are read then.
+func (e *SecretStreamXCPDecoder) checkPlaintext() error {
+	if e.maxBytes > 0 && e.total > e.maxBytes {
+		return ErrPlaintextTooLarge
+	}
+	return nil
+}
+
+// cipherBuf returns a buffer of length n for the cipher text, reused across
+// writes since io.Writer must not retain it.
+func (e *SecretStreamXCPEncoder) cipherBuf(n int) []byte {
+	if cap(e.buf) < n {
+		e.buf = make([]byte, n)
+	}
+	return e.buf[:n]
 }
 
 // Header get the header from encoder
@@ -125,51 +297,127 @@ func (e *SecretStreamXCPEncoder) SetAdditionData(ad []byte) {
 	e.ad = ad[:]
 }
 
+// SetTag sets the tag of the chunks written by Write. With
+// SecretStreamTag_Final, the next Write ends the stream like WriteAndClose,
+// and the following writes return ErrInvalidState.
 func (e *SecretStreamXCPEncoder) SetTag(t SecretStreamTag) {
 	e.tag = t
 }
 
+// Rekey makes the next chunk carry SecretStreamTag_Rekey. The tag is
+// authenticated with the chunk, and the decoder rekeys when pulling it, so
+// both sides switch keys at the same point of the stream without the
+// application tracking it.
+//
+// Tags can't be combined, so the rekey waits for a chunk with the
+// SecretStreamTag_Message tag.
+func (e *SecretStreamXCPEncoder) Rekey() {
+	e.rekeyPending = true
+}
+
+// SetRekeyInterval makes every n-th chunk written carry SecretStreamTag_Rekey,
+// as Rekey does. n <= 0 disables it.
+func (e *SecretStreamXCPEncoder) SetRekeyInterval(n int) {
+	e.rekeyEvery = n
+}
+
+// pushTag returns the tag of the next chunk written by Write.
+func (e *SecretStreamXCPEncoder) pushTag() SecretStreamTag {
+	if e.rekeyEvery > 0 && (e.chunks+1)%e.rekeyEvery == 0 {
+		e.rekeyPending = true
+	}
+	if e.tag != SecretStreamTag_Message {
+		return e.tag
+	}
+	if e.rekeyPending {
+		return SecretStreamTag_Rekey
+	}
+	return e.tag
+}
+
+// checkMessageLen returns ErrMessageTooLarge if a chunk of n bytes is longer
+// than SecretStreamMessageBytesMax.
+func checkMessageLen(n int) error {
+	if uint64(n) > cryptoSecretStreamXChaCha20Poly1305MsgBytesMax {
+		return ErrMessageTooLarge
+	}
+	return nil
+}
+
 // Write encrypts the b as a message and write to the wrapped io.Writer
+//
+// An empty b is encrypted as a chunk carrying only the MAC, e.g. a keep-alive.
 func (e *SecretStreamXCPEncoder) Write(b []byte) (n int, err error) {
 	if e.final {
 		return n, ErrInvalidState
 	}
+	if err = checkMessageLen(len(b)); err != nil {
+		return
+	}
 	mp, ml := plen(b)
-	c := make([]byte, ml+int(C.crypto_secretstream_xchacha20poly1305_abytes()))
+	c := e.cipherBuf(ml + int(C.crypto_secretstream_xchacha20poly1305_abytes()))
 	cp, _ := plen(c)
 	adp, adl := plen(e.ad)
-	if int(C.crypto_secretstream_xchacha20poly1305_push(&e.state,
+	tag := e.pushTag()
+	if rc := int(C.crypto_secretstream_xchacha20poly1305_push(&e.state,
 		(*C.uchar)(cp),
 		(*C.ulonglong)(nil),
 		(*C.uchar)(mp),
 		(C.ulonglong)(ml),
 		(*C.uchar)(adp),
 		(C.ulonglong)(adl),
-		e.tag.toCtag())) != 0 {
-		return 0, ErrUnknown
+		tag.toCtag())); rc != 0 {
+		return 0, &SodiumError{"crypto_secretstream_xchacha20poly1305_push", rc}
+	}
+	e.chunks++
+	switch tag {
+	case SecretStreamTag_Rekey:
+		e.rekeyPending = false
+	case SecretStreamTag_Final:
+		e.final = true
+	}
+	if err = e.writeHeader(); err != nil {
+		return
 	}
 	n, err = e.out.Write(c)
 	return
 }
 
+// WriteWithAD is Write with ad as the additional data of this chunk only,
+// instead of the one set by SetAdditionData, e.g. to bind each chunk to its
+// sequence number. The decoder must read it with ReadWithAD and the same ad.
+func (e *SecretStreamXCPEncoder) WriteWithAD(b, ad []byte) (n int, err error) {
+	saved := e.ad
+	e.ad = ad
+	n, err = e.Write(b)
+	e.ad = saved
+	return
+}
+
 // Write encrypts the b as a message and write to the wrapped io.Writer and then write the closing signal
 func (e *SecretStreamXCPEncoder) WriteAndClose(b []byte) (n int, err error) {
 	if e.final {
 		return n, ErrInvalidState
 	}
+	if err = checkMessageLen(len(b)); err != nil {
+		return
+	}
 	mp, ml := plen(b)
-	c := make([]byte, ml+int(C.crypto_secretstream_xchacha20poly1305_abytes()))
+	c := e.cipherBuf(ml + int(C.crypto_secretstream_xchacha20poly1305_abytes()))
 	cp, _ := plen(c)
 	adp, adl := plen(e.ad)
-	if int(C.crypto_secretstream_xchacha20poly1305_push(&e.state,
+	if rc := int(C.crypto_secretstream_xchacha20poly1305_push(&e.state,
 		(*C.uchar)(cp),
 		(*C.ulonglong)(nil),
 		(*C.uchar)(mp),
 		(C.ulonglong)(ml),
 		(*C.uchar)(adp),
 		(C.ulonglong)(adl),
-		C.crypto_secretstream_xchacha20poly1305_tag_final())) != 0 {
-		return 0, ErrUnknown
+		C.crypto_secretstream_xchacha20poly1305_tag_final())); rc != 0 {
+		return 0, &SodiumError{"crypto_secretstream_xchacha20poly1305_push", rc}
+	}
+	if err = e.writeHeader(); err != nil {
+		return
 	}
 	n, err = e.out.Write(c)
 	e.final = true
@@ -178,92 +426,439 @@ func (e *SecretStreamXCPEncoder) WriteAndClose(b []byte) (n int, err error) {
 
 // Write encrypts the closing signal and write to the wrapped io.Writer and then close it
 func (e *SecretStreamXCPEncoder) Close() error {
-	mac := make([]byte, int(C.crypto_secretstream_xchacha20poly1305_abytes()))
+	mac := e.cipherBuf(int(C.crypto_secretstream_xchacha20poly1305_abytes()))
 	ap, _ := plen(mac)
 	adp, adl := plen(e.ad)
-	if int(C.crypto_secretstream_xchacha20poly1305_push(&e.state,
+	if rc := int(C.crypto_secretstream_xchacha20poly1305_push(&e.state,
 		(*C.uchar)(ap),
 		(*C.ulonglong)(nil),
 		(*C.uchar)(nil),
 		0,
 		(*C.uchar)(adp),
 		(C.ulonglong)(adl),
-		C.crypto_secretstream_xchacha20poly1305_tag_final())) != 0 {
-		return ErrUnknown
+		C.crypto_secretstream_xchacha20poly1305_tag_final())); rc != 0 {
+		return &SodiumError{"crypto_secretstream_xchacha20poly1305_push", rc}
+	}
+	if err := e.writeHeader(); err != nil {
+		return err
 	}
 	_, err := e.out.Write(mac)
 	e.final = true
 	return err
 }
 
+// MakeSecretStreamXCPEncoder makes an encoder writing the raw libsodium
+// format to out, without the header: each Write is one
+// crypto_secretstream_xchacha20poly1305_push of the whole buffer, and its
+// cipher text is written as is without framing. Given the same key, header,
+// chunks, additional data and tags, the stream is byte for byte the one of
+// other bindings of libsodium, e.g. libsodium-wrappers or PyNaCl.
+//
+// The salted, rotating and framed encoders of the package add their own data
+// around the chunks and only interoperate with this package.
 func MakeSecretStreamXCPEncoder(key SecretStreamXCPKey, out io.Writer) SecretStreamEncoder {
-	checkTypedSize(&key, "secret stream key")
-	encoder := SecretStreamXCPEncoder{
-		out:    out,
-		header: SecretStreamXCPHeader{make([]byte, cryptoSecretStreamXChaCha20Poly1305HeaderBytes)},
+	encoder := SecretStreamXCPEncoder{}
+	encoder.reset(key, out)
+	return &encoder
+}
+
+// MakeSecretStreamXCPEncoderWithHeader makes an encoder which writes its
+// header to out before the first chunk of cipher text, so the stream can be
+// decoded by MakeSecretStreamXCPDecoderAutoHeader without passing the header
+// separately.
+func MakeSecretStreamXCPEncoderWithHeader(key SecretStreamXCPKey, out io.Writer) SecretStreamEncoder {
+	encoder := SecretStreamXCPEncoder{}
+	encoder.reset(key, out)
+	encoder.writesHeader = true
+	encoder.headerPending = true
+	return &encoder
+}
+
+// writeHeader writes the header to out if it is still pending.
+func (e *SecretStreamXCPEncoder) writeHeader() error {
+	if !e.headerPending {
+		return nil
+	}
+	h := e.header.Bytes
+	if e.salt != nil {
+		h = append(append(Bytes{}, e.salt...), h...)
+	}
+	if _, err := e.out.Write(h); err != nil {
+		return err
+	}
+	e.headerPending = false
+	return nil
+}
+
+// Reset wipes the state of the encoder and starts a new stream with key on
+// out, generating a new header, so the encoder can be reused instead of
+// making a new one. The additional data, tag and rekey interval are cleared.
+// An encoder made by MakeSecretStreamXCPEncoderWithHeader writes the new
+// header before the first chunk again, and one made by
+// MakeSecretStreamXCPEncoderSalted also derives a new subkey from a new salt.
+//
+// It returns ErrInvalidKey if key has the wrong size.
+func (e *SecretStreamXCPEncoder) Reset(key SecretStreamXCPKey, out io.Writer) error {
+	if key.Length() != key.Size() {
+		return ErrInvalidKey
+	}
+	if e.salt != nil {
+		e.resetSalted(key, out)
+		return nil
 	}
+	writesHeader := e.writesHeader
+	e.reset(key, out)
+	e.writesHeader = writesHeader
+	e.headerPending = writesHeader
+	return nil
+}
+
+// wipe zeroes the state of the encoder.
+func (e *SecretStreamXCPEncoder) wipe() {
+	C.sodium_memzero(unsafe.Pointer(&e.state), C.size_t(unsafe.Sizeof(e.state)))
+	MemZero(e.buf)
+}
+
+// reset starts a new stream with key on out, generating a new header.
+func (e *SecretStreamXCPEncoder) reset(key SecretStreamXCPKey, out io.Writer) {
+	checkTypedSize(&key, "secret stream key")
+	checkStrict(key.Bytes, "secret stream key")
+	e.wipe()
+	e.out = out
+	e.header = SecretStreamXCPHeader{make([]byte, cryptoSecretStreamXChaCha20Poly1305HeaderBytes)}
+	e.ad = nil
+	e.tag = SecretStreamTag_Message
+	e.final = false
+	e.writesHeader = false
+	e.headerPending = false
+	e.salt = nil
+	e.rekeyPending = false
+	e.rekeyEvery = 0
+	e.chunks = 0
 	if int(C.crypto_secretstream_xchacha20poly1305_init_push(
-		&encoder.state,
-		(*C.uchar)(&encoder.header.Bytes[0]),
+		&e.state,
+		(*C.uchar)(&e.header.Bytes[0]),
 		(*C.uchar)(&key.Bytes[0]))) != 0 {
 		panic("see libsodium")
 	}
-	return &encoder
 }
 
 // Read decrypts the message with length len(b) and save in b. It returns io.EOF when receiving a closing signal
+//
+// Each call consumes one chunk of len(b) bytes. A chunk shorter than len(b) is
+// only accepted at the end of the stream. An empty b returns 0, nil without
+// reading anything, as for any io.Reader: chunks without plain text, e.g.
+// keep-alives, are read with ReadEmptyChunk.
+//
+// If the decoder is made with ReadBufferSize, chunks of that size are read instead.
+//
+// In both cases n is exactly the number of bytes of plain text written to b,
+// never more than len(b), so the decoder can be used with io.Copy.
 func (e *SecretStreamXCPDecoder) Read(b []byte) (n int, err error) {
+	if err = e.checkPlaintext(); err != nil {
+		return
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if e.bufSize > 0 {
+		return e.readBuffered(b)
+	}
+	return e.pull(b, e.ad)
+}
+
+// ReadEmptyChunk reads a chunk carrying no plain text, e.g. a keep-alive
+// written by Write(nil), or the final chunk written by Close. It returns
+// io.EOF if the chunk has the final tag, and ErrDecryptSS if it doesn't
+// authenticate or isn't empty.
+//
+// It returns ErrInvalidState with ReadBufferSize, which reads them as part of
+// Read.
+func (e *SecretStreamXCPDecoder) ReadEmptyChunk() error {
+	if e.bufSize > 0 {
+		return ErrInvalidState
+	}
+	_, err := e.pull(nil, e.ad)
+	return err
+}
+
+// pull reads and decrypts one chunk of len(b) bytes of plain text into b,
+// with the additional data ad. It is Read without ReadBufferSize, b being
+// allowed to be empty, for the framed formats knowing the length of each
+// chunk.
+func (e *SecretStreamXCPDecoder) pull(b, ad []byte) (n int, err error) {
+	if err = e.checkPlaintext(); err != nil {
+		return
+	}
 	if e.final {
 		return n, ErrInvalidState
 	}
 	bp, bl := plen(b)
-	c := make([]byte, bl+int(C.crypto_secretstream_xchacha20poly1305_abytes()))
+	c, err := e.chunkBuf(bl + cryptoSecretStreamXChaCha20Poly1305ABytes)
+	if err != nil {
+		return 0, err
+	}
 
-	var l int
-	l, err = e.in.Read(c)
-	for l < int(C.crypto_secretstream_xchacha20poly1305_abytes()) {
-		if err != nil {
+	l, err := e.readChunk(c)
+	if err != nil {
+		return 0, err
+	}
+	adp, adl := plen(ad)
+	var tag C.uchar
+	if int(C.crypto_secretstream_xchacha20poly1305_pull(
+		&e.state,
+		(*C.uchar)(bp),
+		(*C.ulonglong)(nil),
+		&tag,
+		(*C.uchar)(&c[0]),
+		(C.ulonglong)(l),
+		(*C.uchar)(adp),
+		(C.ulonglong)(adl))) != 0 {
+		return 0, ErrDecryptSS
+	}
+	n = l - cryptoSecretStreamXChaCha20Poly1305ABytes
+	if err = e.countPlaintext(n); err != nil {
+		MemZero(b[:n])
+		return 0, err
+	}
+	e.tag.fromCtag(tag)
+	if tag == C.crypto_secretstream_xchacha20poly1305_tag_final() {
+		err = io.EOF
+		e.final = true
+	}
+	return
+}
+
+// chunkBuf returns a buffer of length n for the cipher text of a chunk read
+// without ReadBufferSize. With NonBlocking, it is kept with the partial chunk
+// it holds, which must be read with the same length.
+func (e *SecretStreamXCPDecoder) chunkBuf(n int) ([]byte, error) {
+	if !e.nonBlocking {
+		return make([]byte, n), nil
+	}
+	if e.partial > 0 && len(e.cbuf) != n {
+		return nil, ErrInvalidState
+	}
+	if len(e.cbuf) != n {
+		e.cbuf = make([]byte, n)
+	}
+	return e.cbuf, nil
+}
+
+// readChunk fills c from the underlying reader until it is full or the reader
+// ends, and returns the length read. Errors of the reader other than io.EOF
+// are returned as is, the chunk read so far being lost. A chunk shorter than
+// abytes can't be decrypted.
+func (e *SecretStreamXCPDecoder) readChunk(c []byte) (l int, err error) {
+	if e.nonBlocking {
+		return e.readChunkNonBlocking(c)
+	}
+	for empty := 0; l < len(c); {
+		var more int
+		more, err = e.in.Read(c[l:])
+		if more < 0 || more > len(c)-l {
 			return 0, ErrDecryptSS
 		}
+		l += more
+		if err == io.EOF {
+			e.ended = l == 0
+			break
+		} else if err != nil {
+			return 0, err
+		}
+		if more > 0 {
+			empty = 0
+		} else if empty++; empty >= 100 {
+			return 0, io.ErrNoProgress
+		}
+	}
+	if l < cryptoSecretStreamXChaCha20Poly1305ABytes {
+		return 0, ErrDecryptSS
+	}
+	return l, nil
+}
+
+// readChunkNonBlocking is readChunk for NonBlocking, carrying on from the
+// partial chunk already in c and returning as soon as the reader fails.
+func (e *SecretStreamXCPDecoder) readChunkNonBlocking(c []byte) (l int, err error) {
+	for l = e.partial; l < len(c); {
 		var more int
-		more, err = e.in.Read(c[:l])
+		more, err = e.in.Read(c[l:])
+		if more < 0 || more > len(c)-l {
+			return 0, ErrDecryptSS
+		}
 		l += more
+		if err == io.EOF {
+			e.ended = l == 0
+			break
+		}
+		if err == nil && more == 0 {
+			err = io.ErrNoProgress
+		}
+		if err != nil {
+			e.partial = l
+			return 0, err
+		}
+	}
+	e.partial = 0
+	if l < cryptoSecretStreamXChaCha20Poly1305ABytes {
+		return 0, ErrDecryptSS
+	}
+	return l, nil
+}
+
+// readBuffered serves b from the pending plain text, pulling one chunk of
+// bufSize bytes from the underlying reader when it is used up.
+func (e *SecretStreamXCPDecoder) readBuffered(b []byte) (n int, err error) {
+	if len(e.pending) == 0 && !e.peeked {
+		if e.final {
+			return n, ErrInvalidState
+		}
+		if err = e.pullChunk(); err != nil {
+			return
+		}
+	}
+	e.peeked = false
+	n = copy(b, e.pending)
+	e.pending = e.pending[n:]
+	if e.final && len(e.pending) == 0 {
+		err = io.EOF
+	}
+	return
+}
+
+// pullChunk reads and decrypts a whole chunk into pending.
+func (e *SecretStreamXCPDecoder) pullChunk() error {
+	if err := e.checkPlaintext(); err != nil {
+		return err
+	}
+	abytes := int(C.crypto_secretstream_xchacha20poly1305_abytes())
+	if e.cbuf == nil {
+		e.cbuf = make([]byte, e.bufSize+abytes)
+		e.mbuf = make([]byte, e.bufSize)
+	}
+
+	l, err := e.readChunk(e.cbuf)
+	if err != nil {
+		return err
 	}
 	adp, adl := plen(e.ad)
 	var tag C.uchar
 	if int(C.crypto_secretstream_xchacha20poly1305_pull(
 		&e.state,
-		(*C.uchar)(bp),
+		(*C.uchar)(&e.mbuf[0]),
 		(*C.ulonglong)(nil),
 		&tag,
-		(*C.uchar)(&c[0]),
+		(*C.uchar)(&e.cbuf[0]),
 		(C.ulonglong)(l),
 		(*C.uchar)(adp),
 		(C.ulonglong)(adl))) != 0 {
-		err = ErrDecryptSS
+		return ErrDecryptSS
+	}
+	if err := e.countPlaintext(l - abytes); err != nil {
+		MemZero(e.mbuf[:l-abytes])
+		return err
 	}
-	n = l - int(C.crypto_secretstream_xchacha20poly1305_abytes())
+	e.pending = e.mbuf[:l-abytes]
 	e.tag.fromCtag(tag)
 	if tag == C.crypto_secretstream_xchacha20poly1305_tag_final() {
-		err = io.EOF
 		e.final = true
 	}
-	return
+	return nil
 }
 
 func (e *SecretStreamXCPDecoder) SetAdditionData(ad []byte) {
 	e.ad = ad[:]
 }
 
+// ReadWithAD is Read with ad as the additional data of this chunk only,
+// instead of the one set by SetAdditionData. It pairs with WriteWithAD.
+//
+// With ReadBufferSize, ad is only used if a chunk is pulled by this call,
+// i.e. when no decrypted data is left from the previous chunk.
+func (e *SecretStreamXCPDecoder) ReadWithAD(b, ad []byte) (n int, err error) {
+	saved := e.ad
+	e.ad = ad
+	n, err = e.Read(b)
+	e.ad = saved
+	return
+}
+
 func (e SecretStreamXCPDecoder) Tag() SecretStreamTag {
 	return e.tag
 }
 
-func MakeSecretStreamXCPDecoder(key SecretStreamXCPKey, in io.Reader, header SecretStreamXCPHeader) (SecretStreamDecoder, error) {
+// Next starts decoding the next stream from the underlying reader, reading
+// its header first, once the current stream has hit the final tag. This reads
+// streams written one after the other to the same file, each made by
+// MakeSecretStreamXCPEncoderWithHeader with the key of the decoder.
+//
+// It returns io.EOF if the reader ends right after the current stream,
+// ErrInvalidHeader if it ends within the header, and ErrInvalidState if the
+// current stream isn't over. The additional data is cleared.
+//
+// The decoder mustn't read past the end of the stream: the final chunk must be
+// read with a buffer of its size, or be a full chunk with ReadBufferSize.
+func (e *SecretStreamXCPDecoder) Next() error {
+	if !e.final || len(e.pending) > 0 {
+		return ErrInvalidState
+	}
+	header := SecretStreamXCPHeader{make([]byte, cryptoSecretStreamXChaCha20Poly1305HeaderBytes)}
+	if _, err := io.ReadFull(e.in, header.Bytes); err == io.ErrUnexpectedEOF {
+		return ErrInvalidHeader
+	} else if err != nil {
+		return err
+	}
+	if int(C.crypto_secretstream_xchacha20poly1305_init_pull(
+		&e.state,
+		(*C.uchar)(&header.Bytes[0]),
+		(*C.uchar)(&e.key.Bytes[0]))) != 0 {
+		return ErrInvalidHeader
+	}
+	e.ad = nil
+	e.tag = SecretStreamTag_Message
+	e.final = false
+	e.peeked = false
+	return nil
+}
+
+// PeekTag returns the tag of the chunk the next Read returns data from,
+// decrypting it ahead if needed, e.g. to dispatch on the tag before reading.
+// After the final chunk is read, it returns SecretStreamTag_Final and io.EOF.
+//
+// The decoder must be made with ReadBufferSize, as the length of the next
+// chunk is unknown otherwise. It returns ErrInvalidState if not.
+func (e *SecretStreamXCPDecoder) PeekTag() (SecretStreamTag, error) {
+	if e.bufSize == 0 {
+		return e.tag, ErrInvalidState
+	}
+	if len(e.pending) == 0 && !e.peeked {
+		if e.final {
+			return e.tag, io.EOF
+		}
+		if err := e.pullChunk(); err != nil {
+			return e.tag, err
+		}
+		e.peeked = true
+	}
+	return e.tag, nil
+}
+
+// MakeSecretStreamXCPDecoder makes a decoder of the raw libsodium format, as
+// written by MakeSecretStreamXCPEncoder or any other binding of libsodium,
+// reading the chunks from in after header. Since the format has no framing,
+// the chunk boundaries come from the size of the buffers given to Read, or
+// from ReadBufferSize.
+func MakeSecretStreamXCPDecoder(key SecretStreamXCPKey, in io.Reader, header SecretStreamXCPHeader, opts ...SecretStreamDecoderOption) (SecretStreamDecoder, error) {
 	checkTypedSize(&key, "secret stream key")
 	checkTypedSize(&header, "secret stream header")
+	checkStrict(key.Bytes, "secret stream key")
 	decoder := SecretStreamXCPDecoder{
-		in: in,
+		in:  in,
+		key: key,
+	}
+	for _, opt := range opts {
+		opt(&decoder)
 	}
 	if int(C.crypto_secretstream_xchacha20poly1305_init_pull(
 		&decoder.state,
@@ -273,3 +868,20 @@ func MakeSecretStreamXCPDecoder(key SecretStreamXCPKey, in io.Reader, header Sec
 	}
 	return &decoder, nil
 }
+
+// MakeSecretStreamXCPDecoderAutoHeader reads the header from in, then makes a
+// decoder for the rest of the stream. It pairs with
+// MakeSecretStreamXCPEncoderWithHeader.
+//
+// It returns ErrInvalidHeader if in ends before a whole header is read. Other
+// errors of in are returned as is.
+func MakeSecretStreamXCPDecoderAutoHeader(key SecretStreamXCPKey, in io.Reader, opts ...SecretStreamDecoderOption) (SecretStreamDecoder, error) {
+	header := SecretStreamXCPHeader{make([]byte, cryptoSecretStreamXChaCha20Poly1305HeaderBytes)}
+	if _, err := io.ReadFull(in, header.Bytes); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrInvalidHeader
+		}
+		return nil, err
+	}
+	return MakeSecretStreamXCPDecoder(key, in, header, opts...)
+}
@@ -0,0 +1,187 @@
+package sodium
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+)
+
+// SecretStreamConnChunkBytes is the largest chunk of plain text sent in one
+// frame by SecretStreamConn. Larger writes are split.
+const SecretStreamConnChunkBytes = 16 * 1024
+
+const secretStreamConnLengthBytes = 4
+
+// SecretStreamConn is an encrypted net.Conn with a secret stream in each
+// direction.
+//
+// The header of the outgoing stream is sent before the first frame, then each
+// chunk is framed by its big-endian uint32 length as the underlying connection
+// doesn't preserve message boundaries. Close sends the final tag before
+// closing the underlying connection, and the peer gets io.EOF.
+//
+// Deadlines and addresses are those of the underlying connection. A read
+// which times out keeps the partially received frame, and the next Read
+// continues from it. A write which times out keeps the unsent part of the
+// frames, and the next Write or Close sends it first. The count returned by a
+// Write includes the plain text already encrypted, which must not be written
+// again.
+type SecretStreamConn struct {
+	net.Conn
+
+	encoder SecretStreamEncoder
+	wbuf    bytes.Buffer
+	closed  bool
+
+	rx      SecretStreamXCPKey
+	decoder *SecretStreamXCPDecoder
+	frame   bytes.Reader
+	rbuf    []byte
+	pending []byte
+	rerr    error
+}
+
+// NewSecretStreamConn wraps conn, encrypting what is written with tx and
+// decrypting what is read with rx. The peer must use the same keys swapped,
+// e.g. the KXSessionKeys of each side.
+func NewSecretStreamConn(conn net.Conn, tx, rx SecretStreamXCPKey) *SecretStreamConn {
+	checkTypedSize(&rx, "secret stream key")
+	c := &SecretStreamConn{
+		Conn: conn,
+		rx:   rx,
+	}
+	c.encoder = MakeSecretStreamXCPEncoder(tx, &c.wbuf)
+	c.wbuf.Write(c.encoder.Header().Bytes)
+	return c
+}
+
+// flush writes the pending cipher text to the underlying connection.
+func (c *SecretStreamConn) flush() error {
+	for c.wbuf.Len() > 0 {
+		n, err := c.Conn.Write(c.wbuf.Bytes())
+		c.wbuf.Next(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushLength frames the next chunk of l bytes of plain text.
+func (c *SecretStreamConn) pushLength(l int) {
+	var lb [secretStreamConnLengthBytes]byte
+	binary.BigEndian.PutUint32(lb[:], uint32(l+cryptoSecretStreamXChaCha20Poly1305ABytes))
+	c.wbuf.Write(lb[:])
+}
+
+// Write encrypts b in chunks of at most SecretStreamConnChunkBytes and sends
+// them to the underlying connection.
+func (c *SecretStreamConn) Write(b []byte) (n int, err error) {
+	if err = c.flush(); err != nil {
+		return
+	}
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > SecretStreamConnChunkBytes {
+			chunk = chunk[:SecretStreamConnChunkBytes]
+		}
+		c.pushLength(len(chunk))
+		if _, err = c.encoder.Write(chunk); err != nil {
+			return
+		}
+		n += len(chunk)
+		b = b[len(chunk):]
+		if err = c.flush(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Close sends the final tag to the peer and closes the underlying connection.
+//
+// If sending times out, the underlying connection is left open and Close can
+// be called again to send the rest.
+func (c *SecretStreamConn) Close() error {
+	if !c.closed {
+		c.closed = true
+		c.pushLength(0)
+		if err := c.encoder.Close(); err != nil {
+			return err
+		}
+	}
+	if err := c.flush(); err != nil {
+		return err
+	}
+	return c.Conn.Close()
+}
+
+// Read decrypts data from the underlying connection into b. It returns io.EOF
+// once the final tag of the peer is received, or io.ErrUnexpectedEOF if the
+// connection ends before it.
+func (c *SecretStreamConn) Read(b []byte) (n int, err error) {
+	for len(c.pending) == 0 {
+		if c.rerr != nil {
+			return 0, c.rerr
+		}
+		if err = c.readChunk(); err != nil {
+			return
+		}
+	}
+	n = copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return
+}
+
+// readChunk receives the header or the next frame and decrypts it into pending.
+func (c *SecretStreamConn) readChunk() error {
+	abytes := cryptoSecretStreamXChaCha20Poly1305ABytes
+	for {
+		if c.decoder == nil {
+			if len(c.rbuf) >= cryptoSecretStreamXChaCha20Poly1305HeaderBytes {
+				header := SecretStreamXCPHeader{make([]byte, cryptoSecretStreamXChaCha20Poly1305HeaderBytes)}
+				copy(header.Bytes, c.rbuf)
+				c.rbuf = c.rbuf[header.Length():]
+				decoder, err := MakeSecretStreamXCPDecoder(c.rx, &c.frame, header)
+				if err != nil {
+					c.rerr = err
+					return err
+				}
+				c.decoder = decoder.(*SecretStreamXCPDecoder)
+				continue
+			}
+		} else if len(c.rbuf) >= secretStreamConnLengthBytes {
+			l := int(binary.BigEndian.Uint32(c.rbuf))
+			if l < abytes || l > SecretStreamConnChunkBytes+abytes {
+				c.rerr = ErrDecryptSS
+				return c.rerr
+			}
+			if len(c.rbuf) >= secretStreamConnLengthBytes+l {
+				c.frame.Reset(c.rbuf[secretStreamConnLengthBytes : secretStreamConnLengthBytes+l])
+				c.rbuf = c.rbuf[secretStreamConnLengthBytes+l:]
+				m := make([]byte, l-abytes)
+				if _, err := c.decoder.pull(m, nil); err == io.EOF {
+					c.rerr = io.EOF
+				} else if err != nil {
+					c.rerr = ErrDecryptSS
+					return c.rerr
+				}
+				c.pending = m
+				return nil
+			}
+		}
+
+		var b [4096]byte
+		n, err := c.Conn.Read(b[:])
+		c.rbuf = append(c.rbuf, b[:n]...)
+		if err == io.EOF && n > 0 {
+			continue
+		} else if err == io.EOF {
+			c.rerr = io.ErrUnexpectedEOF
+			return c.rerr
+		} else if err != nil {
+			return err
+		}
+	}
+}
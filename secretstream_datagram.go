@@ -0,0 +1,219 @@
+package sodium
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// SecretStreamDatagramBytes is the largest datagram written by a
+// ReplayProtectedEncoder and read by MakeReplayProtectedDecoder, e.g. to fit
+// in a UDP datagram.
+const SecretStreamDatagramBytes = 65507
+
+const secretStreamSeqBytes = 8
+
+// replayCandidatesMax is the number of distinct datagrams held for a sequence
+// number ahead of the next chunk, so a forged one can't push the genuine one
+// out.
+const replayCandidatesMax = 4
+
+// ReplayProtectedEncoder writes a secret stream as datagrams for unreliable
+// transports, e.g. UDP, read back by MakeReplayProtectedDecoder.
+//
+// Each Write sends a single datagram to the underlying writer: the big-endian
+// uint64 sequence number of the chunk, starting at 0, followed by its cipher
+// text. The sequence number is authenticated as the additional data of the
+// chunk. The header must be sent to the peer separately, e.g. in a handshake.
+type ReplayProtectedEncoder struct {
+	out     io.Writer
+	encoder *SecretStreamXCPEncoder
+	frame   bytes.Buffer
+	seq     uint64
+	closed  bool
+}
+
+type replayProtectedDecoder struct {
+	in      io.Reader
+	decoder *SecretStreamXCPDecoder
+	frame   bytes.Reader
+	next    uint64
+	window  uint64
+	held    map[uint64][][]byte
+	buf     []byte
+	pending []byte
+	done    bool
+}
+
+// MakeReplayProtectedEncoder makes an encoder of a new secret stream with key,
+// writing its chunks as datagrams to out.
+func MakeReplayProtectedEncoder(key SecretStreamXCPKey, out io.Writer) *ReplayProtectedEncoder {
+	e := &ReplayProtectedEncoder{out: out}
+	e.encoder = MakeSecretStreamXCPEncoder(key, &e.frame).(*SecretStreamXCPEncoder)
+	return e
+}
+
+// Header returns the header of the stream, for the decoder.
+func (e *ReplayProtectedEncoder) Header() SecretStreamXCPHeader {
+	return e.encoder.Header()
+}
+
+// Write sends b as the next chunk, in a single datagram. It returns
+// ErrMessageTooLarge if the datagram would be larger than
+// SecretStreamDatagramBytes, and ErrInvalidState after Close.
+//
+// The chunk is used up even if writing the datagram fails: the peer can't go
+// past a chunk it doesn't receive, so the datagram must be sent again as is,
+// e.g. by the transport, or the stream is over.
+func (e *ReplayProtectedEncoder) Write(b []byte) (n int, err error) {
+	return e.push(b, false)
+}
+
+// Close sends an empty chunk with the final tag, after which the decoder
+// returns io.EOF. It doesn't close the underlying writer.
+func (e *ReplayProtectedEncoder) Close() error {
+	if e.closed {
+		return nil
+	}
+	_, err := e.push(nil, true)
+	return err
+}
+
+func (e *ReplayProtectedEncoder) push(b []byte, final bool) (n int, err error) {
+	if e.closed {
+		return 0, ErrInvalidState
+	}
+	if secretStreamSeqBytes+len(b)+cryptoSecretStreamXChaCha20Poly1305ABytes > SecretStreamDatagramBytes {
+		return 0, ErrMessageTooLarge
+	}
+	var seq [secretStreamSeqBytes]byte
+	binary.BigEndian.PutUint64(seq[:], e.seq)
+	e.seq++
+
+	e.frame.Reset()
+	e.frame.Write(seq[:])
+	if final {
+		e.closed = true
+		e.encoder.SetTag(SecretStreamTag_Final)
+	}
+	if _, err = e.encoder.WriteWithAD(b, seq[:]); err != nil {
+		return
+	}
+	if _, err = e.out.Write(e.frame.Bytes()); err != nil {
+		return
+	}
+	return len(b), nil
+}
+
+// MakeReplayProtectedDecoder returns a reader of the plain text of the
+// datagrams written by a ReplayProtectedEncoder with key and header, reading
+// one datagram per Read of in, as from a UDP connection.
+//
+// A secret stream can only be decrypted in order, so datagrams arriving ahead
+// of the next chunk are held, up to windowSize chunks ahead, until their turn
+// comes. The Read receiving a datagram which is a duplicate, one already
+// decrypted or held, or too far ahead returns ErrReplay, and one which doesn't
+// decrypt returns ErrDecryptSS; the datagram is dropped and the stream carries
+// on with the next Read. Read blocks until the next chunk arrives, so a lost
+// datagram stalls the stream: deadlines of in are the way out.
+//
+// Held datagrams are not authenticated until their turn, so up to 4 distinct
+// ones are held for each sequence number, and tried in the order they
+// arrived: a forged datagram arriving first doesn't get the genuine one
+// rejected, but costs a Read returning ErrDecryptSS. At most 4*windowSize
+// datagrams are held. Read returns io.EOF after the final chunk, and
+// ErrTruncatedStream if in ends before it.
+func MakeReplayProtectedDecoder(key SecretStreamXCPKey, in io.Reader, header SecretStreamXCPHeader, windowSize int) (io.Reader, error) {
+	if windowSize <= 0 {
+		panic(fmt.Sprintf("Incorrect replay window size, got (%d).", windowSize))
+	}
+	d := &replayProtectedDecoder{
+		in:     in,
+		window: uint64(windowSize),
+		held:   make(map[uint64][][]byte),
+		buf:    make([]byte, SecretStreamDatagramBytes),
+	}
+	decoder, err := MakeSecretStreamXCPDecoder(key, &d.frame, header)
+	if err != nil {
+		return nil, err
+	}
+	d.decoder = decoder.(*SecretStreamXCPDecoder)
+	return d, nil
+}
+
+func (d *replayProtectedDecoder) Read(b []byte) (n int, err error) {
+	for len(d.pending) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if cs, ok := d.held[d.next]; ok {
+			if len(cs) == 1 {
+				delete(d.held, d.next)
+			} else {
+				d.held[d.next] = cs[1:]
+			}
+			if err := d.open(cs[0]); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		l, err := d.in.Read(d.buf)
+		if l > 0 {
+			if err := d.receive(d.buf[:l]); err != nil {
+				return 0, err
+			}
+		}
+		if err == io.EOF {
+			return 0, ErrTruncatedStream
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	n = copy(b, d.pending)
+	d.pending = d.pending[n:]
+	return
+}
+
+// receive decrypts the datagram if it is the next one, or holds it if it is
+// within the window, along with the other candidates for its sequence number.
+func (d *replayProtectedDecoder) receive(datagram []byte) error {
+	if len(datagram) < secretStreamSeqBytes+cryptoSecretStreamXChaCha20Poly1305ABytes {
+		return ErrDecryptSS
+	}
+	seq := binary.BigEndian.Uint64(datagram)
+	if seq < d.next || seq-d.next >= d.window {
+		return ErrReplay
+	}
+	if seq == d.next {
+		return d.open(datagram)
+	}
+	cs := d.held[seq]
+	for _, c := range cs {
+		if bytes.Equal(c, datagram) {
+			return ErrReplay
+		}
+	}
+	if len(cs) == replayCandidatesMax {
+		return ErrReplay
+	}
+	d.held[seq] = append(cs, append([]byte{}, datagram...))
+	return nil
+}
+
+// open decrypts the datagram of the next chunk into pending. A datagram which
+// doesn't decrypt leaves the state of the stream as it was.
+func (d *replayProtectedDecoder) open(datagram []byte) error {
+	c := datagram[secretStreamSeqBytes:]
+	d.frame.Reset(c)
+	m := make([]byte, len(c)-cryptoSecretStreamXChaCha20Poly1305ABytes)
+	_, err := d.decoder.pull(m, datagram[:secretStreamSeqBytes])
+	if err != nil && err != io.EOF {
+		return ErrDecryptSS
+	}
+	delete(d.held, d.next)
+	d.next++
+	d.pending = m
+	d.done = err == io.EOF
+	return nil
+}
@@ -0,0 +1,174 @@
+package sodium
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// EncryptedFS is a tree of files encrypted at rest under a root directory,
+// each one a stream of its own written by NewEncryptingWriter, with its header
+// at the start. It implements fs.FS, so the files read through it are
+// decrypted transparently, e.g. with fs.ReadFile or fs.WalkDir.
+//
+// Only the content of the files is encrypted: their names, the tree, the
+// modification times and roughly the sizes are not. A file which has been
+// tampered with or truncated gives ErrDecryptSS when read; the plain text read
+// before the error must be discarded.
+//
+// Only the content of each file is authenticated, not which file it is: the
+// path is bound to nothing, so files under the same key can be swapped,
+// renamed, copied, deleted or rolled back to an older version without any
+// error when read. Callers needing that must authenticate the tree
+// themselves, e.g. with a signed list of the paths and hashes of the files.
+type EncryptedFS struct {
+	root string
+	key  SecretStreamXCPKey
+}
+
+// MakeEncryptedFS returns the EncryptedFS of the files under root, encrypted
+// with key.
+func MakeEncryptedFS(root string, key SecretStreamXCPKey) *EncryptedFS {
+	checkTypedSize(&key, "secret stream key")
+	return &EncryptedFS{root: root, key: key}
+}
+
+func (f *EncryptedFS) path(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(f.root, filepath.FromSlash(name)), nil
+}
+
+// Open opens the file name, a slash-separated path as for fs.FS. Reading a
+// regular file returns its plain text, and Stat gives its size. Directories
+// are listed as is.
+func (f *EncryptedFS) Open(name string) (fs.File, error) {
+	path, err := f.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		return &encryptedDir{File: file}, nil
+	}
+	return &encryptedFile{f: file, key: f.key}, nil
+}
+
+// Create creates or truncates the file name, and returns a writer encrypting
+// to it. Its parent directory must exist. Close writes the final chunk, then
+// closes the file.
+func (f *EncryptedFS) Create(name string) (io.WriteCloser, error) {
+	path, err := f.path("create", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewEncryptingWriter(f.key, file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &encryptedFileWriter{WriteCloser: w, f: file}, nil
+}
+
+type encryptedFileWriter struct {
+	io.WriteCloser
+	f *os.File
+}
+
+func (w *encryptedFileWriter) Close() error {
+	err := w.WriteCloser.Close()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+type encryptedFile struct {
+	f   *os.File
+	key SecretStreamXCPKey
+	r   io.Reader
+}
+
+func (e *encryptedFile) Read(b []byte) (int, error) {
+	if e.r == nil {
+		r, err := NewDecryptingReader(e.key, e.f)
+		if err != nil {
+			return 0, err
+		}
+		e.r = r
+	}
+	return e.r.Read(b)
+}
+
+func (e *encryptedFile) Stat() (fs.FileInfo, error) {
+	info, err := e.f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return encryptedFileInfo{info}, nil
+}
+
+func (e *encryptedFile) Close() error {
+	return e.f.Close()
+}
+
+type encryptedDir struct {
+	*os.File
+}
+
+func (d *encryptedDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries, err := d.File.ReadDir(n)
+	for i, e := range entries {
+		if e.Type().IsRegular() {
+			entries[i] = encryptedDirEntry{e}
+		}
+	}
+	return entries, err
+}
+
+type encryptedDirEntry struct {
+	fs.DirEntry
+}
+
+func (e encryptedDirEntry) Info() (fs.FileInfo, error) {
+	info, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return encryptedFileInfo{info}, nil
+}
+
+// encryptedFileInfo gives the size of the plain text of an encrypted file.
+type encryptedFileInfo struct {
+	fs.FileInfo
+}
+
+// Size returns the size of the plain text, computed from the size of the file
+// as written by NewEncryptingWriter.
+func (i encryptedFileInfo) Size() int64 {
+	abytes := int64(cryptoSecretStreamXChaCha20Poly1305ABytes)
+	chunk := int64(SecretStreamChunkBytes) + abytes
+	body := i.FileInfo.Size() - int64(cryptoSecretStreamXChaCha20Poly1305HeaderBytes)
+	full, rest := body/chunk, body%chunk
+	if rest == 0 && full > 0 {
+		return full * SecretStreamChunkBytes
+	}
+	if body < 0 || rest < abytes {
+		return 0
+	}
+	return full*SecretStreamChunkBytes + rest - abytes
+}
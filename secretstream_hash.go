@@ -0,0 +1,72 @@
+package sodium
+
+import "hash"
+
+// PlaintextHashingEncoder wraps a SecretStreamEncoder to also hash the plain
+// text written to it with BLAKE2b, e.g. to deduplicate files as they are
+// encrypted, without a second pass over the data.
+type PlaintextHashingEncoder struct {
+	SecretStreamEncoder
+	hash hash.Hash
+	sum  Bytes
+}
+
+// NewPlaintextHashingEncoder returns an encoder writing to encoder and hashing
+// the plain text given to Write, WriteWithAD and WriteAndClose. The hash is
+// the one of NewGenericHashDefault.
+func NewPlaintextHashingEncoder(encoder SecretStreamEncoder) *PlaintextHashingEncoder {
+	return &PlaintextHashingEncoder{
+		SecretStreamEncoder: encoder,
+		hash:                NewGenericHashDefault(),
+	}
+}
+
+// PlaintextHash returns the hash of the plain text successfully encrypted,
+// once the stream is closed by Close or WriteAndClose. It returns nil before.
+func (e *PlaintextHashingEncoder) PlaintextHash() Bytes {
+	return e.sum
+}
+
+func (e *PlaintextHashingEncoder) Write(b []byte) (n int, err error) {
+	n, err = e.SecretStreamEncoder.Write(b)
+	e.update(b, err)
+	return
+}
+
+// WriteWithAD is WriteWithAD of the wrapped encoder, e.g. a
+// *SecretStreamXCPEncoder. It returns ErrInvalidState if the wrapped encoder
+// doesn't have one.
+func (e *PlaintextHashingEncoder) WriteWithAD(b, ad []byte) (n int, err error) {
+	w, ok := e.SecretStreamEncoder.(interface {
+		WriteWithAD(b, ad []byte) (n int, err error)
+	})
+	if !ok {
+		return 0, ErrInvalidState
+	}
+	n, err = w.WriteWithAD(b, ad)
+	e.update(b, err)
+	return
+}
+
+func (e *PlaintextHashingEncoder) WriteAndClose(b []byte) (n int, err error) {
+	n, err = e.SecretStreamEncoder.WriteAndClose(b)
+	e.update(b, err)
+	if err == nil {
+		e.sum = e.hash.Sum(nil)
+	}
+	return
+}
+
+func (e *PlaintextHashingEncoder) Close() error {
+	err := e.SecretStreamEncoder.Close()
+	if err == nil {
+		e.sum = e.hash.Sum(nil)
+	}
+	return err
+}
+
+func (e *PlaintextHashingEncoder) update(b []byte, err error) {
+	if err == nil && e.sum == nil {
+		e.hash.Write(b)
+	}
+}
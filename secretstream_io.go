@@ -0,0 +1,260 @@
+package sodium
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// SecretStreamChunkBytes is the size of the chunks of plain text written by
+// NewEncryptingWriter and read by NewDecryptingReader. Every chunk of the
+// stream but the last one must be of this size.
+const SecretStreamChunkBytes = 64 * 1024
+
+// RecommendedChunkSize returns a default size for the chunks of plain text
+// given to a SecretStreamEncoder, the same as SecretStreamChunkBytes.
+//
+// Each chunk costs 17 bytes and one call into libsodium. With
+// BenchmarkSecretStreamChunkSize on amd64, throughput is about 20% of the
+// peak with 256-byte chunks and 60% with 1 KiB chunks, reaches the peak from
+// 16 KiB, and drops again with chunks of 1 MiB which don't fit the CPU caches.
+// 64 KiB keeps the overhead under 0.03% with a bounded buffer size.
+func RecommendedChunkSize() int {
+	return SecretStreamChunkBytes
+}
+
+type encryptingWriter struct {
+	encoder SecretStreamEncoder
+	buf     []byte
+	closed  bool
+	err     error
+}
+
+type decryptingReader struct {
+	decoder SecretStreamDecoder
+	err     error
+}
+
+// NewDecryptingReader reads the header from src and returns a reader of the
+// plain text of the rest of the stream, e.g. for io.Copy.
+//
+// The stream must be made of chunks of SecretStreamChunkBytes, the last one
+// being shorter and carrying the final tag. The reader returns io.EOF only
+// after the final tag; a truncated or tampered stream gives ErrDecryptSS.
+func NewDecryptingReader(key SecretStreamXCPKey, src io.Reader) (io.Reader, error) {
+	decoder, err := MakeSecretStreamXCPDecoderAutoHeader(key, src, ReadBufferSize(SecretStreamChunkBytes))
+	if err != nil {
+		return nil, err
+	}
+	return &decryptingReader{decoder: decoder}, nil
+}
+
+func (r *decryptingReader) Read(b []byte) (n int, err error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err = r.decoder.Read(b)
+	if err != nil {
+		r.err = err
+	}
+	return
+}
+
+// NewEncryptingWriter writes the header of a new stream to dst and returns a
+// writer encrypting to it, e.g. for io.Copy. The plain text is buffered and
+// encrypted in chunks of SecretStreamChunkBytes, and Close encrypts the rest
+// with the final tag. Close doesn't close dst.
+//
+// An error writing to dst is returned by the current and all following calls.
+// Calling Close again does nothing.
+func NewEncryptingWriter(key SecretStreamXCPKey, dst io.Writer) (io.WriteCloser, error) {
+	encoder := MakeSecretStreamXCPEncoder(key, dst)
+	if _, err := dst.Write(encoder.Header().Bytes); err != nil {
+		return nil, err
+	}
+	return &encryptingWriter{
+		encoder: encoder,
+		buf:     make([]byte, 0, SecretStreamChunkBytes),
+	}, nil
+}
+
+func (w *encryptingWriter) Write(b []byte) (n int, err error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.closed {
+		return 0, ErrInvalidState
+	}
+	for len(b) > 0 {
+		if len(w.buf) == SecretStreamChunkBytes {
+			if _, err = w.encoder.Write(w.buf); err != nil {
+				w.err = err
+				return
+			}
+			w.buf = w.buf[:0]
+		}
+		l := copy(w.buf[len(w.buf):SecretStreamChunkBytes], b)
+		w.buf = w.buf[:len(w.buf)+l]
+		b = b[l:]
+		n += l
+	}
+	return
+}
+
+func (w *encryptingWriter) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+	if w.err != nil {
+		return w.err
+	}
+	if _, err := w.encoder.WriteAndClose(w.buf); err != nil {
+		w.err = err
+	}
+	MemZero(w.buf[:cap(w.buf)])
+	return w.err
+}
+
+// VerifySecretStream authenticates the whole stream read from in, written
+// with key and header, without keeping its plain text, e.g. to check a file
+// before using it. Each chunk is decrypted into a single scratch buffer which
+// is wiped on return.
+//
+// The chunks are of SecretStreamChunkBytes as written by NewEncryptingWriter,
+// unless ReadBufferSize is given in opts. It returns nil if every chunk
+// authenticates, the last one has the final tag and in ends right after it,
+// and ErrDecryptSS otherwise. Errors of in are returned as is.
+func VerifySecretStream(key SecretStreamXCPKey, in io.Reader, header SecretStreamXCPHeader, opts ...SecretStreamDecoderOption) error {
+	opts = append([]SecretStreamDecoderOption{ReadBufferSize(SecretStreamChunkBytes)}, opts...)
+	decoder, err := MakeSecretStreamXCPDecoder(key, in, header, opts...)
+	if err != nil {
+		return err
+	}
+	d := decoder.(*SecretStreamXCPDecoder)
+	defer func() { MemZero(d.mbuf) }()
+
+	for !d.final {
+		if err := d.pullChunk(); err != nil {
+			return err
+		}
+	}
+	var b [1]byte
+	if n, err := io.ReadFull(in, b[:]); n > 0 {
+		return ErrDecryptSS
+	} else if err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// RotateSecretStream re-encrypts the stream read from in, written with oldKey
+// and oldHeader, under newKey in a single pass, e.g. to rotate the key of a
+// file, and returns the header of the new stream written to out. Only one
+// chunk of plain text is held at a time, and it is wiped on return.
+//
+// Each chunk is written again with the same size and tag, so the new stream
+// is read as the old one was. The chunks are of SecretStreamChunkBytes as
+// written by NewEncryptingWriter, unless ReadBufferSize is given in opts.
+//
+// It returns ErrDecryptSS if the old stream doesn't authenticate, as
+// VerifySecretStream does. The chunks already written to out are then left
+// without the final tag, so the new stream doesn't authenticate either, and
+// must be discarded. Errors of in and out are returned as is.
+func RotateSecretStream(oldKey, newKey SecretStreamXCPKey, in io.Reader, oldHeader SecretStreamXCPHeader, out io.Writer, opts ...SecretStreamDecoderOption) (newHeader SecretStreamXCPHeader, err error) {
+	opts = append([]SecretStreamDecoderOption{ReadBufferSize(SecretStreamChunkBytes)}, opts...)
+	decoder, err := MakeSecretStreamXCPDecoder(oldKey, in, oldHeader, opts...)
+	if err != nil {
+		return SecretStreamXCPHeader{}, err
+	}
+	d := decoder.(*SecretStreamXCPDecoder)
+	defer func() { MemZero(d.mbuf) }()
+	encoder := MakeSecretStreamXCPEncoder(newKey, out).(*SecretStreamXCPEncoder)
+
+	for !d.final {
+		if err := d.pullChunk(); err != nil {
+			return SecretStreamXCPHeader{}, err
+		}
+		if d.final {
+			_, err = encoder.WriteAndClose(d.pending)
+		} else {
+			switch d.tag {
+			case SecretStreamTag_Rekey:
+				encoder.Rekey()
+			case SecretStreamTag_Push:
+				encoder.SetTag(SecretStreamTag_Push)
+			}
+			_, err = encoder.Write(d.pending)
+			encoder.SetTag(SecretStreamTag_Message)
+		}
+		if err != nil {
+			return SecretStreamXCPHeader{}, err
+		}
+	}
+	d.pending = nil
+	var b [1]byte
+	if n, err := io.ReadFull(in, b[:]); n > 0 {
+		return SecretStreamXCPHeader{}, ErrDecryptSS
+	} else if err != nil && err != io.EOF {
+		return SecretStreamXCPHeader{}, err
+	}
+	return encoder.Header(), nil
+}
+
+// ReadFullMessage reads the rest of the stream up to the final tag and returns
+// the whole plain text, e.g. for messages small enough to be kept in memory.
+// No plain text is returned on error.
+//
+// The decoder must be made with ReadBufferSize, to find the end of the chunks.
+// It returns ErrInvalidState if not. It returns ErrTruncatedStream if the
+// underlying reader ends right after a chunk which authenticates but isn't
+// final, or before the first chunk, and ErrDecryptSS if a chunk doesn't
+// authenticate, e.g. it has been tampered with or cut short.
+func ReadFullMessage(decoder SecretStreamDecoder) ([]byte, error) {
+	d, ok := decoder.(*SecretStreamXCPDecoder)
+	if !ok || d.bufSize == 0 {
+		return nil, ErrInvalidState
+	}
+	var m []byte
+	b := make([]byte, d.bufSize)
+	defer MemZero(b)
+	for {
+		n, err := d.Read(b)
+		m = append(m, b[:n]...)
+		if err == io.EOF {
+			return m, nil
+		}
+		if err != nil {
+			MemZero(m)
+			if err == ErrDecryptSS && d.ended {
+				err = ErrTruncatedStream
+			}
+			return nil, err
+		}
+	}
+}
+
+// SealSecretStreamBuffer encrypts the whole plain text as a stream of chunks
+// of chunkSize bytes, the last one being shorter or empty and carrying the
+// final tag, and returns its header and the cipher text as a single slice.
+// The size of the cipher text is computed first, len(plaintext) plus the
+// overhead of each chunk, so it is allocated only once.
+//
+// It is the in-memory counterpart of NewEncryptingWriter, and is read back by
+// a decoder made with ReadBufferSize(chunkSize), e.g. with ReadFullMessage.
+func SealSecretStreamBuffer(key SecretStreamXCPKey, plaintext []byte, chunkSize int) (header SecretStreamXCPHeader, ciphertext []byte) {
+	if chunkSize <= 0 {
+		panic(fmt.Sprintf("Incorrect chunk size, got (%d).", chunkSize))
+	}
+	chunks := (len(plaintext) + chunkSize - 1) / chunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(plaintext)+chunks*cryptoSecretStreamXChaCha20Poly1305ABytes))
+	encoder := MakeSecretStreamXCPEncoder(key, out)
+	for ; len(plaintext) > chunkSize; plaintext = plaintext[chunkSize:] {
+		encoder.Write(plaintext[:chunkSize])
+	}
+	encoder.WriteAndClose(plaintext)
+	return encoder.Header(), out.Bytes()
+}
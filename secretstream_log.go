@@ -0,0 +1,130 @@
+package sodium
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// EncryptedLogLineBytesMax is the largest line accepted by EncryptedLogWriter.
+const EncryptedLogLineBytesMax = 1 << 24
+
+// EncryptedLogWriter appends lines to an encrypted log. Each line is one
+// secret stream message with the push tag, framed by the big-endian uint32
+// length of its cipher text, and written to out with a single Write.
+//
+// Close appends an empty message with the final tag. A log missing it has been
+// truncated, which EncryptedLogReader reports as io.ErrUnexpectedEOF after
+// the lines before the cut.
+type EncryptedLogWriter struct {
+	out     io.Writer
+	encoder SecretStreamEncoder
+	buf     bytes.Buffer
+}
+
+// EncryptedLogReader reads back the lines written by EncryptedLogWriter.
+type EncryptedLogReader struct {
+	in      io.Reader
+	decoder *SecretStreamXCPDecoder
+	frame   bytes.Reader
+	err     error
+}
+
+// MakeEncryptedLogWriter makes a log writer appending to out. The header must
+// be stored with the log, e.g. in front of it, and given to
+// MakeEncryptedLogReader.
+func MakeEncryptedLogWriter(key SecretStreamXCPKey, out io.Writer) *EncryptedLogWriter {
+	w := &EncryptedLogWriter{out: out}
+	w.encoder = MakeSecretStreamXCPEncoder(key, &w.buf)
+	return w
+}
+
+// Header returns the header of the log.
+func (w *EncryptedLogWriter) Header() SecretStreamXCPHeader {
+	return w.encoder.Header()
+}
+
+// WriteLine encrypts line as one message and appends it to the log.
+func (w *EncryptedLogWriter) WriteLine(line []byte) error {
+	if len(line) > EncryptedLogLineBytesMax {
+		return ErrMessageTooLarge
+	}
+	w.encoder.SetTag(SecretStreamTag_Push)
+	return w.push(len(line), func() error {
+		_, err := w.encoder.Write(line)
+		return err
+	})
+}
+
+// Close appends the final tag to the log. It doesn't close out.
+func (w *EncryptedLogWriter) Close() error {
+	return w.push(0, w.encoder.Close)
+}
+
+// push frames the message of l bytes encrypted by enc and writes it to out.
+func (w *EncryptedLogWriter) push(l int, enc func() error) error {
+	w.buf.Reset()
+	var lb [secretStreamConnLengthBytes]byte
+	binary.BigEndian.PutUint32(lb[:], uint32(l+cryptoSecretStreamXChaCha20Poly1305ABytes))
+	w.buf.Write(lb[:])
+	if err := enc(); err != nil {
+		return err
+	}
+	_, err := w.out.Write(w.buf.Bytes())
+	return err
+}
+
+// MakeEncryptedLogReader makes a reader of the log in, written with key and
+// header.
+func MakeEncryptedLogReader(key SecretStreamXCPKey, in io.Reader, header SecretStreamXCPHeader) (*EncryptedLogReader, error) {
+	r := &EncryptedLogReader{in: in}
+	decoder, err := MakeSecretStreamXCPDecoder(key, &r.frame, header)
+	if err != nil {
+		return nil, err
+	}
+	r.decoder = decoder.(*SecretStreamXCPDecoder)
+	return r, nil
+}
+
+// ReadLine returns the next line of the log. It returns io.EOF after the final
+// tag, io.ErrUnexpectedEOF if the log ends before it, and ErrDecryptSS if a
+// line has been tampered with, reordered or dropped.
+func (r *EncryptedLogReader) ReadLine() ([]byte, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	line, err := r.readLine()
+	if err != nil {
+		r.err = err
+	}
+	return line, err
+}
+
+func (r *EncryptedLogReader) readLine() ([]byte, error) {
+	abytes := cryptoSecretStreamXChaCha20Poly1305ABytes
+	var lb [secretStreamConnLengthBytes]byte
+	if _, err := io.ReadFull(r.in, lb[:]); err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return nil, err
+	}
+	l := int(binary.BigEndian.Uint32(lb[:]))
+	if l < abytes || l > EncryptedLogLineBytesMax+abytes {
+		return nil, ErrDecryptSS
+	}
+	c := make([]byte, l)
+	if _, err := io.ReadFull(r.in, c); err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return nil, err
+	}
+
+	r.frame.Reset(c)
+	line := make([]byte, l-abytes)
+	if _, err := r.decoder.pull(line, nil); err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, ErrDecryptSS
+	}
+	return line, nil
+}
@@ -0,0 +1,45 @@
+package sodium
+
+import (
+	"io"
+	"sync"
+)
+
+// EncoderPool reuses SecretStreamXCPEncoders for workloads encrypting many
+// short-lived streams. The zero value is ready to use.
+type EncoderPool struct {
+	pool sync.Pool
+}
+
+// NewEncoderPool creates an empty EncoderPool.
+func NewEncoderPool() *EncoderPool {
+	return &EncoderPool{}
+}
+
+// Get returns an encoder starting a new stream with key on out, as if made by
+// MakeSecretStreamXCPEncoder. A new header is generated for every stream.
+func (p *EncoderPool) Get(key SecretStreamXCPKey, out io.Writer) SecretStreamEncoder {
+	e, _ := p.pool.Get().(*SecretStreamXCPEncoder)
+	if e == nil {
+		e = &SecretStreamXCPEncoder{}
+	}
+	e.reset(key, out)
+	return e
+}
+
+// Put wipes the state of the encoder and returns it to the pool. The encoder
+// must not be used after calling Put.
+//
+// Encoders not made by MakeSecretStreamXCPEncoder or Get are ignored.
+func (p *EncoderPool) Put(enc SecretStreamEncoder) {
+	e, ok := enc.(*SecretStreamXCPEncoder)
+	if !ok {
+		return
+	}
+	e.wipe()
+	e.out = nil
+	e.ad = nil
+	e.header = SecretStreamXCPHeader{}
+	e.final = true
+	p.pool.Put(e)
+}
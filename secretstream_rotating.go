@@ -0,0 +1,251 @@
+package sodium
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const rotatingSegmentLast = 1
+
+// rotatingEncoder writes the segments of MakeRotatingSecretStreamEncoder.
+type rotatingEncoder struct {
+	key     SecretStreamXCPKey
+	out     io.Writer
+	max     int64
+	encoder *SecretStreamXCPEncoder
+	frame   bytes.Buffer
+	segment uint64
+	written int64
+	buf     []byte
+	closed  bool
+	err     error
+}
+
+// rotatingDecoder reads the segments written by rotatingEncoder.
+type rotatingDecoder struct {
+	key     SecretStreamXCPKey
+	in      io.Reader
+	decoder *SecretStreamXCPDecoder
+	frame   bytes.Reader
+	segment uint64
+	pending []byte
+	done    bool
+	err     error
+}
+
+// MakeRotatingSecretStreamEncoder returns a writer encrypting to out, which
+// starts a new secret stream, with a new header, after every
+// maxBytesPerSegment bytes of plain text, e.g. for logs rotated by size. The
+// segments are written one after the other to out, and read back by
+// MakeRotatingSecretStreamDecoder.
+//
+// Each segment is the header followed by chunks of at most
+// SecretStreamChunkBytes of plain text, each one framed by the big-endian
+// uint32 length of its cipher text and a flag byte set on the final chunk of
+// the last segment. The index of the segment and the flag are authenticated as
+// the additional data of each chunk, so segments can't be reordered, and
+// dropping the last ones is detected.
+//
+// Close ends the last segment. It doesn't close out.
+func MakeRotatingSecretStreamEncoder(key SecretStreamXCPKey, out io.Writer, maxBytesPerSegment int64) io.WriteCloser {
+	checkTypedSize(&key, "secret stream key")
+	if maxBytesPerSegment <= 0 {
+		panic(fmt.Sprintf("Incorrect segment size, got (%d).", maxBytesPerSegment))
+	}
+	return &rotatingEncoder{
+		key: key,
+		out: out,
+		max: maxBytesPerSegment,
+		buf: make([]byte, 0, SecretStreamChunkBytes),
+	}
+}
+
+func (e *rotatingEncoder) Write(b []byte) (n int, err error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	if e.closed {
+		return 0, ErrInvalidState
+	}
+	for len(b) > 0 {
+		// A full chunk is only pushed once more data comes, so the final
+		// chunk of the last segment is known when Close is called.
+		if e.written+int64(len(e.buf)) == e.max {
+			err = e.push(true, false)
+		} else if len(e.buf) == SecretStreamChunkBytes {
+			err = e.push(false, false)
+		}
+		if err != nil {
+			e.err = err
+			return
+		}
+		room := SecretStreamChunkBytes - len(e.buf)
+		if left := e.max - e.written - int64(len(e.buf)); left < int64(room) {
+			room = int(left)
+		}
+		if room > len(b) {
+			room = len(b)
+		}
+		e.buf = append(e.buf, b[:room]...)
+		b = b[room:]
+		n += room
+	}
+	return
+}
+
+func (e *rotatingEncoder) Close() error {
+	if e.closed {
+		return e.err
+	}
+	e.closed = true
+	if e.err != nil {
+		return e.err
+	}
+	e.err = e.push(true, true)
+	MemZero(e.buf[:cap(e.buf)])
+	return e.err
+}
+
+// push encrypts the buffered plain text as the next chunk, starting a new
+// segment if needed.
+func (e *rotatingEncoder) push(final, last bool) error {
+	if e.encoder == nil {
+		e.encoder = MakeSecretStreamXCPEncoder(e.key, &e.frame).(*SecretStreamXCPEncoder)
+		if _, err := e.out.Write(e.encoder.Header().Bytes); err != nil {
+			return err
+		}
+	}
+	var flags byte
+	if last {
+		flags = rotatingSegmentLast
+	}
+
+	e.frame.Reset()
+	var lb [secretStreamConnLengthBytes]byte
+	binary.BigEndian.PutUint32(lb[:], uint32(len(e.buf)+cryptoSecretStreamXChaCha20Poly1305ABytes))
+	e.frame.Write(lb[:])
+	e.frame.WriteByte(flags)
+	if final {
+		e.encoder.SetTag(SecretStreamTag_Final)
+	}
+	if _, err := e.encoder.WriteWithAD(e.buf, rotatingAD(e.segment, flags)); err != nil {
+		return err
+	}
+	if _, err := e.out.Write(e.frame.Bytes()); err != nil {
+		return err
+	}
+
+	e.written += int64(len(e.buf))
+	MemZero(e.buf)
+	e.buf = e.buf[:0]
+	if final {
+		e.encoder = nil
+		e.segment++
+		e.written = 0
+	}
+	return nil
+}
+
+func rotatingAD(segment uint64, flags byte) Bytes {
+	var s [8]byte
+	binary.BigEndian.PutUint64(s[:], segment)
+	return NewADBuilder().Add(s[:]).Add([]byte{flags}).Bytes()
+}
+
+// MakeRotatingSecretStreamDecoder returns a reader of the plain text of all
+// the segments written by MakeRotatingSecretStreamEncoder to in, reading the
+// header of each segment as it comes.
+//
+// The reader returns io.EOF after the final chunk of the last segment. It
+// returns ErrTruncatedStream if in ends before it, and ErrDecryptSS if a chunk
+// has been tampered with, the segments have been reordered, or data follows
+// the last segment.
+func MakeRotatingSecretStreamDecoder(key SecretStreamXCPKey, in io.Reader) io.Reader {
+	checkTypedSize(&key, "secret stream key")
+	return &rotatingDecoder{key: key, in: in}
+}
+
+func (d *rotatingDecoder) Read(b []byte) (n int, err error) {
+	for len(d.pending) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			d.err = err
+			d.pending = nil
+		}
+	}
+	n = copy(b, d.pending)
+	d.pending = d.pending[n:]
+	return
+}
+
+// next decrypts the next chunk into pending.
+func (d *rotatingDecoder) next() error {
+	if d.decoder == nil {
+		header := SecretStreamXCPHeader{make([]byte, cryptoSecretStreamXChaCha20Poly1305HeaderBytes)}
+		if err := d.readFull(header.Bytes); err != nil {
+			return err
+		}
+		decoder, err := MakeSecretStreamXCPDecoder(d.key, &d.frame, header)
+		if err != nil {
+			return err
+		}
+		d.decoder = decoder.(*SecretStreamXCPDecoder)
+	}
+
+	abytes := cryptoSecretStreamXChaCha20Poly1305ABytes
+	var lb [secretStreamConnLengthBytes + 1]byte
+	if err := d.readFull(lb[:]); err != nil {
+		return err
+	}
+	l := int(binary.BigEndian.Uint32(lb[:]))
+	flags := lb[secretStreamConnLengthBytes]
+	if l < abytes || l > SecretStreamChunkBytes+abytes {
+		return ErrDecryptSS
+	}
+	c := make([]byte, l)
+	if err := d.readFull(c); err != nil {
+		return err
+	}
+
+	d.frame.Reset(c)
+	m := make([]byte, l-abytes)
+	_, err := d.decoder.pull(m, rotatingAD(d.segment, flags))
+	final := err == io.EOF
+	if err != nil && !final {
+		return ErrDecryptSS
+	}
+	if flags == rotatingSegmentLast && !final {
+		return ErrDecryptSS
+	}
+	d.pending = m
+	if final {
+		d.decoder = nil
+		d.segment++
+		if flags == rotatingSegmentLast {
+			d.done = true
+			var extra [1]byte
+			if n, err := io.ReadFull(d.in, extra[:]); n > 0 {
+				return ErrDecryptSS
+			} else if err != io.EOF {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readFull fills b from in, returning ErrTruncatedStream if in ends first.
+func (d *rotatingDecoder) readFull(b []byte) error {
+	_, err := io.ReadFull(d.in, b)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTruncatedStream
+	}
+	return err
+}
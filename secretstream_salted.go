@@ -0,0 +1,84 @@
+package sodium
+
+// #cgo pkg-config: libsodium
+// #include <stdlib.h>
+// #include <sodium.h>
+import "C"
+
+import (
+	"io"
+	"unsafe"
+)
+
+// SecretStreamSaltBytes is the size of the salt written in front of the
+// header by MakeSecretStreamXCPEncoderSalted.
+const SecretStreamSaltBytes = 16
+
+var secretStreamSaltPersonal = [16]byte{'s', 'o', 'd', 'i', 'u', 'm', ' ', 's', 's', ' ', 's', 'a', 'l', 't'}
+
+// MakeSecretStreamXCPEncoderSalted makes an encoder which encrypts with a
+// subkey of key derived from a random salt, so each stream has its own key
+// even when key is shared by many streams. The salt and the header are
+// written to out before the first chunk of cipher text; Header returns the
+// header only.
+//
+// The subkey is the 32-byte BLAKE2b of nothing keyed with key, with the salt
+// and a fixed personalization, which is how crypto_kdf derives subkeys, with
+// a salt of 128 random bits instead of a 64-bit id.
+//
+// The stream is read by MakeSecretStreamXCPDecoderSalted.
+func MakeSecretStreamXCPEncoderSalted(key SecretStreamXCPKey, out io.Writer) SecretStreamEncoder {
+	encoder := SecretStreamXCPEncoder{}
+	encoder.resetSalted(key, out)
+	return &encoder
+}
+
+// resetSalted starts a new stream on out with the subkey of key for a new
+// salt.
+func (e *SecretStreamXCPEncoder) resetSalted(key SecretStreamXCPKey, out io.Writer) {
+	salt := make(Bytes, SecretStreamSaltBytes)
+	C.randombytes_buf(unsafe.Pointer(&salt[0]), C.size_t(len(salt)))
+	sub := secretStreamSaltedKey(key, salt)
+	e.reset(sub, out)
+	MemZero(sub.Bytes)
+	e.salt = salt
+	e.writesHeader = true
+	e.headerPending = true
+}
+
+// MakeSecretStreamXCPDecoderSalted reads the salt and the header written by
+// an encoder made by MakeSecretStreamXCPEncoderSalted from in, then makes a
+// decoder for the rest of the stream with the same subkey of key.
+//
+// It returns ErrInvalidHeader if in ends before the salt and the header are
+// read. Other errors of in are returned as is.
+func MakeSecretStreamXCPDecoderSalted(key SecretStreamXCPKey, in io.Reader, opts ...SecretStreamDecoderOption) (SecretStreamDecoder, error) {
+	b := make([]byte, SecretStreamSaltBytes+cryptoSecretStreamXChaCha20Poly1305HeaderBytes)
+	if _, err := io.ReadFull(in, b); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrInvalidHeader
+		}
+		return nil, err
+	}
+	header := SecretStreamXCPHeader{b[SecretStreamSaltBytes:]}
+	return MakeSecretStreamXCPDecoder(secretStreamSaltedKey(key, b[:SecretStreamSaltBytes]), in, header, opts...)
+}
+
+func secretStreamSaltedKey(key SecretStreamXCPKey, salt Bytes) SecretStreamXCPKey {
+	checkTypedSize(&key, "secret stream key")
+	checkStrict(key.Bytes, "secret stream key")
+
+	sub := make([]byte, cryptoSecretStreamXChaCha20Poly1305KeyBytes)
+	if int(C.crypto_generichash_blake2b_salt_personal(
+		(*C.uchar)(&sub[0]),
+		(C.size_t)(len(sub)),
+		(*C.uchar)(nil),
+		(C.ulonglong)(0),
+		(*C.uchar)(&key.Bytes[0]),
+		(C.size_t)(key.Length()),
+		(*C.uchar)(&salt[0]),
+		(*C.uchar)(&secretStreamSaltPersonal[0]))) != 0 {
+		panic("see libsodium")
+	}
+	return SecretStreamXCPKey{sub}
+}
@@ -5,6 +5,11 @@ package sodium
 // #include <sodium.h>
 import "C"
 
+import (
+	"encoding/binary"
+	"hash"
+)
+
 var (
 	cryptoShortHashBytes    = int(C.crypto_shorthash_bytes())
 	cryptoShortHashKeyBytes = int(C.crypto_shorthash_keybytes())
@@ -26,6 +31,10 @@ func (s ShortHashKey) Size() int {
 	return cryptoShortHashKeyBytes
 }
 
+func (k ShortHashKey) String() string {
+	return redacted("ShortHashKey", k.Bytes)
+}
+
 // Shorthash use a secret key and input to produce a ShortHash.
 // It is protective to short input. And it's output is also too short to
 // be collision-resistent, however it can be used in hash table, Bloom filter
@@ -46,3 +55,56 @@ func (b Bytes) Shorthash(key ShortHashKey) (out Bytes) {
 
 	return
 }
+
+// ShortHash64 provides the SipHash of Shorthash in interface of hash.Hash64.
+//
+// libsodium has no incremental API for it, so written data is kept until Sum.
+type ShortHash64 struct {
+	key ShortHashKey
+	buf Bytes
+}
+
+// NewShortHash creates a hash.Hash64 with the secret key.
+func NewShortHash(key ShortHashKey) hash.Hash64 {
+	checkTypedSize(&key, "key")
+	k := make([]byte, cryptoShortHashKeyBytes)
+	copy(k, key.Bytes)
+	return &ShortHash64{key: ShortHashKey{k}}
+}
+
+// Implements hash.Hash
+func (s ShortHash64) Size() int {
+	return cryptoShortHashBytes
+}
+
+// Implements hash.Hash
+func (s ShortHash64) BlockSize() int {
+	return 8
+}
+
+// Reset drops the written data, keeping the key.
+//
+// Implements hash.Hash
+func (s *ShortHash64) Reset() {
+	s.buf = s.buf[:0]
+}
+
+// Implements hash.Hash
+func (s *ShortHash64) Write(p []byte) (n int, err error) {
+	s.buf = append(s.buf, p...)
+	return len(p), nil
+}
+
+// Sum appends the same bytes as Shorthash of the written data after b.
+//
+// Implements hash.Hash
+func (s *ShortHash64) Sum(b []byte) []byte {
+	return append(b, s.buf.Shorthash(s.key)...)
+}
+
+// Sum64 returns the output of Sum as a little-endian uint64.
+//
+// Implements hash.Hash64
+func (s *ShortHash64) Sum64() uint64 {
+	return binary.LittleEndian.Uint64(s.buf.Shorthash(s.key))
+}
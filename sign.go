@@ -90,6 +90,10 @@ func (k SignSeed) Size() int {
 	return cryptoSignSeedBytes
 }
 
+func (k SignSeed) String() string {
+	return redacted("SignSeed", k.Bytes)
+}
+
 type SignSecretKey struct {
 	Bytes
 }
@@ -98,6 +102,10 @@ func (k SignSecretKey) Size() int {
 	return cryptoSignSecretKeyBytes
 }
 
+func (k SignSecretKey) String() string {
+	return redacted("SignSecretKey", k.Bytes)
+}
+
 // Seed extracts the seed used when generating the key pair.
 func (k SignSecretKey) Seed() SignSeed {
 	checkTypedSize(&k, "Sign SecretKey")
@@ -134,6 +142,12 @@ func (b Signature) Size() int {
 	return cryptoSignBytes
 }
 
+// Equal reports whether b and o are the same signature, comparing them in
+// constant time with crypto_verify_64.
+func (b Signature) Equal(o Bytes) bool {
+	return Verify64(b.Bytes, o)
+}
+
 // Sign returns 'sm': signature+message
 func (b Bytes) Sign(key SignSecretKey) (sm Bytes) {
 	checkTypedSize(&key, "Sign SecretKey")
@@ -197,6 +211,9 @@ func (b Bytes) SignVerifyDetached(sig Signature, key SignPublicKey) (err error)
 func (b Bytes) SignOpen(key SignPublicKey) (m Bytes, err error) {
 	checkTypedSize(&key, "Sign PublicKey")
 	bp, bl := plen(b)
+	if bl < cryptoSignBytes {
+		return nil, ErrOpenSign
+	}
 	m = make([]byte, bl-cryptoSignBytes)
 	mp, _ := plen(m)
 	var mlen C.ulonglong
@@ -0,0 +1,62 @@
+package sodium
+
+// signcryptContext separates signcryption signatures from any other Ed25519
+// signature made with the same key.
+const signcryptContext = "sodium signcrypt"
+
+// signcryptTranscript binds the sender's and the receiver's public keys to the
+// message being signed.
+func signcryptTranscript(spk SignPublicKey, rpk BoxPublicKey, m Bytes) Bytes {
+	t := make([]byte, 0, len(signcryptContext)+spk.Length()+rpk.Length()+m.Length())
+	t = append(t, signcryptContext...)
+	t = append(t, spk.Bytes...)
+	t = append(t, rpk.Bytes...)
+	t = append(t, m...)
+	return t
+}
+
+// Signcrypt signs the message with sender's SignSecretKey and puts the
+// signature along with the message into a sealed box for receiver's
+// BoxPublicKey.
+//
+// The signature covers both sender's SignPublicKey and receiver's
+// BoxPublicKey, so a receiver can not re-encrypt the message to a third party
+// as if it was sent to them by the sender.
+func (b Bytes) Signcrypt(sk SignSecretKey, spk SignPublicKey, rpk BoxPublicKey) (c Bytes) {
+	checkTypedSize(&sk, "sender's Sign SecretKey")
+	checkTypedSize(&spk, "sender's Sign PublicKey")
+	checkTypedSize(&rpk, "receiver's PublicKey")
+
+	sig := signcryptTranscript(spk, rpk, b).SignDetached(sk)
+	sm := make([]byte, 0, sig.Length()+b.Length())
+	sm = append(sm, sig.Bytes...)
+	sm = append(sm, b...)
+
+	return Bytes(sm).SealedBox(rpk)
+}
+
+// Unsigncrypt opens a box made by Signcrypt using receiver's BoxSecretKey, and
+// verifies that the message is signed by sender's SignPublicKey for this
+// receiver.
+//
+// It returns ErrOpenBox if opening failed, or ErrOpenSign if verification failed.
+func (b Bytes) Unsigncrypt(sk BoxSecretKey, spk SignPublicKey) (m Bytes, err error) {
+	checkTypedSize(&sk, "receiver's SecretKey")
+	checkTypedSize(&spk, "sender's Sign PublicKey")
+	if b.Length() < cryptoBoxSealBytes+cryptoSignBytes {
+		return nil, ErrOpenBox
+	}
+
+	kp := BoxKP{sk.PublicKey(), sk}
+	sm, err := b.SealedBoxOpen(kp)
+	if err != nil {
+		return nil, err
+	}
+	sig := Signature{sm[:cryptoSignBytes]}
+	m = sm[cryptoSignBytes:]
+	if err = signcryptTranscript(spk, kp.PublicKey, m).SignVerifyDetached(sig, spk); err != nil {
+		return nil, err
+	}
+
+	return
+}
@@ -1,8 +1,56 @@
 // Package sodium is a wrapper for https://github.com/jedisct1/libsodium
 //
+// It needs libsodium 1.0.18 or later, which CheckLibrary verifies at run time.
+// Version returns the linked version, and SupportsAEGIS and SupportsHKDF tell
+// whether the primitives of later versions are available.
+//
+// SetStrictMode turns on extra checks of the inputs, at some cost in speed.
+//
 // Most of the functions is a method to the "Bytes" type.
 // They are grouped below:
 //
+// # Encoding
+//
+// Bytes, and so every key, can be encoded to and decoded from hexadecimal or
+// base64 strings in constant time. These use libsodium's encoders, which don't
+// index tables with the encoded bytes, unlike encoding/hex and encoding/base64
+// whose lookups can leak the bytes through cache timing. Prefer them for keys
+// and other secrets; the output is the same.
+//
+//	func (b Bytes) Hex() string
+//	func (b Bytes) Base64(v Base64Variant) string
+//	func ParseHex(s string) (b Bytes, err error)
+//	func ParseBase64(s string, v Base64Variant) (b Bytes, err error)
+//
+//	//exactly 16, 32 or 64 bytes, into arrays
+//	func HexToArray16(s string) (a [16]byte, err error)
+//	func HexToArray32(s string) (a [32]byte, err error)
+//	func HexToArray64(s string) (a [64]byte, err error)
+//
+//	//buffer sizes of the C encoders, NUL terminator included
+//	func HexEncodedLen(binLen int) int
+//	func Base64EncodedLen(binLen int, v Base64Variant) int
+//
+// Bytes can be compared in constant time, and so can signatures and MACs,
+// with crypto_verify_* for their size.
+//
+//	func (b Bytes) Equal(o Bytes) bool
+//	func (b Signature) Equal(o Bytes) bool
+//	func (b MAC) Equal(o Bytes) bool
+//	func Verify16(a, b []byte) bool
+//	func Verify32(a, b []byte) bool
+//	func Verify64(a, b []byte) bool
+//
+// Bytes can be padded to a multiple of a block size, e.g. to hide their length.
+//
+//	func (b Bytes) Pad(blockSize int) Bytes
+//	func (b Bytes) Unpad(blockSize int) (Bytes, error)
+//
+// Secret keys and seeds are printed redacted by fmt, as a length and a short
+// fingerprint. Hex gives the actual bytes.
+//
+//	func (b Bytes) Redacted() string
+//
 // # Signature
 //
 // Sender sign a message with its SecretKey and the receiver can verify the
@@ -17,6 +65,10 @@
 //	func (k SignSecretKey) PublicKey() SignPublicKey
 //	func (k SignSecretKey) Seed() SignSeed
 //
+//	//short text for comparing public keys out-of-band
+//	func Fingerprint(pk SignPublicKey) string
+//	func MakeSignKPWithFingerprint() (kp SignKP, fingerprint string, err error)
+//
 //	//SignKP can be converted to BoxKP
 //	//It is recommended to use separate keys for signing and encrytion.
 //	func (p SignKP) ToBox() BoxKP
@@ -56,6 +108,17 @@
 //
 //	func (b Bytes) SealedBox(pk BoxPublicKey) (cm Bytes)
 //	func (b Bytes) SealedBoxOpen(kp BoxKP) (m Bytes, err error)
+//	func SealedBoxOverhead() int
+//
+// A sender can also reuse an ephemeral key pair across the messages of a
+// session, which makes them linkable.
+//
+//	func (b Bytes) SealedBoxWithKP(pk BoxPublicKey, ephemeral BoxKP) (cm Bytes)
+//	func (b Bytes) SealedBoxWithKPOpen(kp BoxKP) (m Bytes, ephemeral BoxPublicKey, err error)
+//
+//	//Bound to a context and to the receiver's PublicKey
+//	func (b Bytes) SealedBoxWithContext(pk BoxPublicKey, context []byte) (cm Bytes)
+//	func (b Bytes) SealedBoxWithContextOpen(kp BoxKP, context []byte) (m Bytes, err error)
 //
 // (X25519-XSalsa20-Poly1305)
 //
@@ -72,6 +135,7 @@
 //	}
 //	func MakeBoxKP() BoxKP
 //	func SeedBoxKP(seed BoxSeed) BoxKP
+//	func BoxKPFromScalar(s Scalar) BoxKP
 //
 //	func (b *BoxNonce) Next()
 //
@@ -83,8 +147,37 @@
 //	func (b Bytes) BoxDetached(n BoxNonce, pk BoxPublicKey, sk BoxSecretKey) (mac BoxMAC, c Bytes)
 //	func (b Bytes) BoxOpenDetached(mac BoxMAC, n BoxNonce, pk BoxPublicKey, sk BoxSecretKey) (c Bytes, err error)
 //
+//	//Random nonce prepended to the box
+//	func (b Bytes) BoxSealNonce(pk BoxPublicKey, sk BoxSecretKey) (c Bytes)
+//	func (b Bytes) BoxOpenSealNonce(pk BoxPublicKey, sk BoxSecretKey) (m Bytes, err error)
+//
+//	func BoxOverhead() int
+//
+//	//Low-order public keys, to reject when received
+//	func (k BoxPublicKey) IsWeak() bool
+//
+//	//Precomputed shared key
+//	func CryptoBoxBeforeNM(pk BoxPublicKey, sk BoxSecretKey) (Bytes, error)
+//
+//	//Session with a peer, nonces are managed
+//	func NewBoxSession(pk BoxPublicKey, sk BoxSecretKey) (*BoxSession, error)
+//	func (s *BoxSession) Encrypt(m Bytes) (c Bytes)
+//	func (s *BoxSession) Decrypt(c Bytes) (m Bytes, err error)
+//
 // (X25519-XSalsa20-Poly1305)
 //
+// # Signcryption
+//
+// The sender signs a message with its SignSecretKey and seals it for the
+// receiver's BoxPublicKey. The receiver opens it with its BoxSecretKey and
+// verifies the sender by its SignPublicKey. The signature also covers the
+// receiver's PublicKey.
+//
+//	func (b Bytes) Signcrypt(sk SignSecretKey, spk SignPublicKey, rpk BoxPublicKey) (c Bytes)
+//	func (b Bytes) Unsigncrypt(sk BoxSecretKey, spk SignPublicKey) (m Bytes, err error)
+//
+// (Ed25519 + X25519-XSalsa20-Poly1305)
+//
 // # Key Exchanging
 //
 // Server and Client exchange their public key and calculates a common session key with their own
@@ -107,11 +200,43 @@
 //
 //	// session keys for server
 //	func (kp KXKP) ServerSessionKeys(client_pk KXPublicKey) (*KXSessionKeys, error) {
+//
+//	// session keys mixed with a pre-shared key
+//	func (kp KXKP) ClientSessionKeysWithPSK(server_pk KXPublicKey, psk []byte) (*KXSessionKeys, error)
+//	func (kp KXKP) ServerSessionKeysWithPSK(client_pk KXPublicKey, psk []byte) (*KXSessionKeys, error)
+//
+//	// session keys used for secret streams
+//	func (k KXSessionKey) ToSecretStreamKey() SecretStreamXCPKey
 //	// client's rx == server's tx
 //	// client's tx == server's rx
 //
 // (rx || tx = BLAKE2B-512(p.n || client_pk || server_pk))
 //
+// # Ed25519 Group Operations
+//
+// Low-level arithmetic on Ed25519 points, for building protocols such as
+// threshold signatures. The NoClamp variants use the scalar as is.
+//
+//	func MakeEd25519Scalar() Ed25519Scalar
+//	func CryptoCoreEd25519IsValidPoint(p Ed25519Point) bool
+//	func CryptoCoreEd25519Add(p, q Ed25519Point) (r Ed25519Point, err error)
+//	func CryptoCoreEd25519Sub(p, q Ed25519Point) (r Ed25519Point, err error)
+//	func CryptoCoreEd25519FromUniform(r Ed25519Uniform) (p Ed25519Point)
+//	func CryptoScalarmultEd25519(n Ed25519Scalar, p Ed25519Point) (q Ed25519Point, err error)
+//	func CryptoScalarmultEd25519NoClamp(n Ed25519Scalar, p Ed25519Point) (q Ed25519Point, err error)
+//	func CryptoScalarmultEd25519Base(n Ed25519Scalar) (q Ed25519Point, err error)
+//	func CryptoScalarmultEd25519BaseNoClamp(n Ed25519Scalar) (q Ed25519Point, err error)
+//
+// # Short-input Hashing
+//
+// Keyed hash for short input, e.g. for hash tables. The output is too short
+// to be collision-resistent.
+//
+//	func (b Bytes) Shorthash(key ShortHashKey) (out Bytes)
+//	func NewShortHash(key ShortHashKey) hash.Hash64
+//
+// (SipHash-2-4)
+//
 // # Secret Key Authentication
 //
 // One holder of a secret key authenticates the message with MAC.
@@ -120,6 +245,25 @@
 //	func (b Bytes) Auth(key MACKey) (mac MAC)
 //	//Holders of the key can verify the message's authenticity.
 //	func (b Bytes) AuthVerify(mac MAC, key MACKey) (err error)
+//	//MAC of a message written in parts.
+//	func MakeAuthState(key MACKey) *AuthState
+//	func (s *AuthState) Write(p []byte) (n int, err error)
+//	func (s *AuthState) Finalize() MAC
+//	func (s *AuthState) FinalizeVerify(mac MAC) (err error)
+//
+//	//data followed by its MAC, e.g. for encrypt-then-MAC with a stream cipher
+//	func MakeAuthenticatedWriter(key MACKey, w io.Writer) io.WriteCloser
+//	func MakeAuthenticatedReader(key MACKey, r io.Reader) io.Reader
+//
+//	//HMAC-SHA-256 and HMAC-SHA-512, for interoperability.
+//	func MakeHMACSHA256Key() HMACSHA256Key
+//	func (b Bytes) AuthHMACSHA256(key HMACSHA256Key) (mac HMACSHA256MAC)
+//	func (b Bytes) AuthHMACSHA256Verify(mac HMACSHA256MAC, key HMACSHA256Key) (err error)
+//	func MakeHMACSHA256State(key HMACSHA256Key) *HMACSHA256State
+//	func MakeHMACSHA512Key() HMACSHA512Key
+//	func (b Bytes) AuthHMACSHA512(key HMACSHA512Key) (mac HMACSHA512MAC)
+//	func (b Bytes) AuthHMACSHA512Verify(mac HMACSHA512MAC, key HMACSHA512Key) (err error)
+//	func MakeHMACSHA512State(key HMACSHA512Key) *HMACSHA512State
 //
 // (HMAC-SHA512256)
 //
@@ -133,13 +277,40 @@
 //	//encrypted message + MAC.
 //	func (b Bytes) SecretBox(n SecretBoxNonce, k SecretBoxKey) (c Bytes)
 //	func (b Bytes) SecretBoxOpen(n SecretBoxNonce, k SecretBoxKey) (m Bytes, err error)
+//	func (b Bytes) SecretBoxInto(dst Bytes, n SecretBoxNonce, k SecretBoxKey) (c Bytes)
+//	func (b Bytes) SecretBoxOpenInto(dst Bytes, n SecretBoxNonce, k SecretBoxKey) (m Bytes, err error)
 //
 //	//Detached version has a separate MAC.
 //	func (b Bytes) SecretBoxDetached(n SecretBoxNonce, k SecretBoxKey) (c Bytes, mac SecretBoxMAC)
 //	func (b Bytes) SecretBoxOpenDetached(mac SecretBoxMAC, n SecretBoxNonce, k SecretBoxKey) (m Bytes, err error)
 //
+//	func SecretBoxOverhead() int
+//
 // (XSalsa20-Poly1305)
 //
+// The XChaCha20-Poly1305 variant has the same API with the SecretBoxXCP prefix.
+//
+//	func (b Bytes) SecretBoxXCP(n SecretBoxXCPNonce, k SecretBoxXCPKey) (c Bytes)
+//	func (b Bytes) SecretBoxXCPOpen(n SecretBoxXCPNonce, k SecretBoxXCPKey) (m Bytes, err error)
+//	func (b Bytes) SecretBoxXCPDetached(n SecretBoxXCPNonce, k SecretBoxXCPKey) (c Bytes, mac SecretBoxXCPMAC)
+//	func (b Bytes) SecretBoxXCPOpenDetached(mac SecretBoxXCPMAC, n SecretBoxXCPNonce, k SecretBoxXCPKey) (m Bytes, err error)
+//
+// (XChaCha20-Poly1305)
+//
+// # Stream Cipher
+//
+// The raw XChaCha20 keystream, XORed with the data. It is NOT authenticated,
+// and is only meant for building modes with their own MAC.
+//
+//	func MakeStreamXCKey() StreamXCKey
+//	func (n *StreamXCNonce) Next()
+//
+//	func (b Bytes) StreamXCXOR(n StreamXCNonce, k StreamXCKey) (c Bytes)
+//	func NewStreamCipherReader(r io.Reader, nonce StreamXCNonce, key StreamXCKey) io.Reader
+//	func NewStreamCipherWriter(w io.Writer, nonce StreamXCNonce, key StreamXCKey) io.Writer
+//
+// (XChaCha20)
+//
 // # Authenticated Encryption with Additional Data
 //
 // Use a secret key and a nonce to protect the key, messages could be encrypted.
@@ -147,8 +318,10 @@
 // authentication tag. Both intergrity and authenticity is checked when
 // decryption. The decryption would not be performed unless the authentication
 // tag is verified.
+// A nil and an empty additional data are the same, here and in secret streams.
 //
 //	func MakeAEADCPKey() AEADCPKey
+//	func MakeAEADCPKeyFrom(r io.Reader) (AEADCPKey, error)
 //	func (n *AEADCPNonce) Next()
 //
 //	//encrypted message + MAC.
@@ -161,9 +334,40 @@
 //	func (b Bytes) AEADCPDecryptDetached(mac AEADCPMAC, ad Bytes, n AEADCPNonce, k AEADCPKey) (m Bytes, err error)
 //	func (b Bytes) AEADCPVerifyDetached(mac AEADCPMAC, ad Bytes, n AEADCPNonce, k AEADCPKey) (err error)
 //
-// AEADCP* (ChaCha20-Poly1305_IETF)
+// AEADCP* (ChaCha20-Poly1305_IETF, RFC 8439, 96-bit counter nonce)
 // AEADXCP* (XChaCha20-Poly1305_IETF)
 //
+//	func AEADChaCha20Poly1305Overhead() int
+//	func AEADXChaCha20Poly1305Overhead() int
+//
+// With libsodium 1.0.19 or later and the sodium_aegis build tag, AEADAEGIS256*
+// (AEGIS-256) and AEADAEGIS128L* (AEGIS-128L) are also available, with the
+// same API as AEADXCPEncrypt and AEADXCPDecrypt.
+//
+// Additional data can't be fed incrementally to the AEAD functions. Large
+// additional data can be collected in chunks, up to a maximum size, then
+// passed as a whole.
+//
+//	func NewAEADAdditionalData(max int) *AEADAdditionalData
+//	func (a *AEADAdditionalData) Write(p []byte) (n int, err error)
+//	func (a *AEADAdditionalData) Bytes() Bytes
+//
+// Several independent pieces of additional data, e.g. for WriteWithAD, can be
+// combined without ambiguity, each one being prefixed by its length.
+//
+//	func NewADBuilder() *ADBuilder
+//	func (a *ADBuilder) Add(segment []byte) *ADBuilder
+//	func (a *ADBuilder) Bytes() Bytes
+//	func ParseAD(ad []byte) (segments [][]byte, err error)
+//
+// Records each encrypted on their own with the nonce of their sequence number,
+// as TLS records, an alternative to secret streams.
+//
+//	func NewRecordStream(w io.Writer, key AEADXCPKey, seq uint64) *RecordStream
+//	func (s *RecordStream) WriteRecord(plaintext, ad []byte) error
+//	func NewRecordReader(r io.Reader, key AEADXCPKey, seq uint64) *RecordReader
+//	func (r *RecordReader) ReadRecord(ad []byte) ([]byte, error)
+//
 // # Secret Key Streaming Encryption
 //
 // High-level streaming API that use AEAD construct. Using
@@ -174,32 +378,160 @@
 // `SecretStreamTag_Message`.
 //
 //	func MakeSecretStreamXCPKey() SecretStreamXCPKey
+//	func SecretStreamMessageBytesMax() uint64
+//	func SecretStreamOverhead() int
+//	func RecommendedChunkSize() int
+//	func MakeSecretStreamXCPKeyFrom(r io.Reader) (SecretStreamXCPKey, error)
+//	func ParseSecretStreamXCPKeyHex(s string) (SecretStreamXCPKey, error)
+//	func ParseSecretStreamXCPKeyBase64(s string, v Base64Variant) (SecretStreamXCPKey, error)
+//	func GenerateRecoveryKey() (key SecretStreamXCPKey, mnemonic string)
+//	func ParseRecoveryKey(mnemonic string) (SecretStreamXCPKey, error)
 //
 //	//decoder
-//	func MakeSecretStreamXCPDecoder(key SecretStreamXCPKey, in io.Reader, header SecretStreamXCPHeader) (SecretStreamDecoder, error)
+//	func MakeSecretStreamXCPDecoder(key SecretStreamXCPKey, in io.Reader, header SecretStreamXCPHeader, opts ...SecretStreamDecoderOption) (SecretStreamDecoder, error)
+//	func MakeSecretStreamXCPDecoderAutoHeader(key SecretStreamXCPKey, in io.Reader, opts ...SecretStreamDecoderOption) (SecretStreamDecoder, error)
+//	func MakeSecretStreamXCPDecoderSalted(key SecretStreamXCPKey, in io.Reader, opts ...SecretStreamDecoderOption) (SecretStreamDecoder, error)
+//	func ReadBufferSize(n int) SecretStreamDecoderOption
+//	func MaxPlaintextBytes(n int64) SecretStreamDecoderOption
+//	func NonBlocking() SecretStreamDecoderOption
 //	func (e *SecretStreamXCPDecoder) Read(b []byte) (n int, err error)
+//	func (e *SecretStreamXCPDecoder) ReadEmptyChunk() error
 //	func (e *SecretStreamXCPDecoder) SetAdditionData(ad []byte)
+//	func (e *SecretStreamXCPDecoder) ReadWithAD(b, ad []byte) (n int, err error)
 //	func (e SecretStreamXCPDecoder) Tag() SecretStreamTag
+//	func (e *SecretStreamXCPDecoder) PeekTag() (SecretStreamTag, error)
+//	func (e *SecretStreamXCPDecoder) Next() error
 //
 //	//encoder
 //	func MakeSecretStreamXCPEncoder(key SecretStreamXCPKey, out io.Writer) SecretStreamEncoder
+//	func MakeSecretStreamXCPEncoderWithHeader(key SecretStreamXCPKey, out io.Writer) SecretStreamEncoder
+//	func MakeSecretStreamXCPEncoderSalted(key SecretStreamXCPKey, out io.Writer) SecretStreamEncoder
 //	func (e *SecretStreamXCPEncoder) Close() error
 //	func (e SecretStreamXCPEncoder) Header() SecretStreamXCPHeader
 //	func (e *SecretStreamXCPEncoder) SetAdditionData(ad []byte)
 //	func (e *SecretStreamXCPEncoder) SetTag(t SecretStreamTag)
+//	func (e *SecretStreamXCPEncoder) Rekey()
+//	func (e *SecretStreamXCPEncoder) SetRekeyInterval(n int)
 //	func (e *SecretStreamXCPEncoder) Write(b []byte) (n int, err error)
 //	func (e *SecretStreamXCPEncoder) WriteAndClose(b []byte) (n int, err error)
+//	func (e *SecretStreamXCPEncoder) WriteWithAD(b, ad []byte) (n int, err error)
+//	func (e *SecretStreamXCPEncoder) Reset(key SecretStreamXCPKey, out io.Writer) error
+//
+//	//streams starting with their header, e.g. files
+//	func NewEncryptingWriter(key SecretStreamXCPKey, dst io.Writer) (io.WriteCloser, error)
+//	func NewDecryptingReader(key SecretStreamXCPKey, src io.Reader) (io.Reader, error)
+//	func ReadFullMessage(decoder SecretStreamDecoder) ([]byte, error)
+//	func VerifySecretStream(key SecretStreamXCPKey, in io.Reader, header SecretStreamXCPHeader, opts ...SecretStreamDecoderOption) error
+//	func RotateSecretStream(oldKey, newKey SecretStreamXCPKey, in io.Reader, oldHeader SecretStreamXCPHeader, out io.Writer, opts ...SecretStreamDecoderOption) (newHeader SecretStreamXCPHeader, err error)
+//
+//	//tree of encrypted files, one stream each, as an fs.FS
+//	func MakeEncryptedFS(root string, key SecretStreamXCPKey) *EncryptedFS
+//	func (f *EncryptedFS) Open(name string) (fs.File, error)
+//	func (f *EncryptedFS) Create(name string) (io.WriteCloser, error)
+//
+//	//whole stream in memory
+//	func SealSecretStreamBuffer(key SecretStreamXCPKey, plaintext []byte, chunkSize int) (header SecretStreamXCPHeader, ciphertext []byte)
+//
+//	//padding the plain text to hide its length
+//	func NewPaddingWriter(w io.WriteCloser, strategy PaddingStrategy) io.WriteCloser
+//	func NewUnpaddingReader(r io.Reader) io.Reader
+//	func PadToMultiple(blockSize int) PaddingStrategy
+//	func PadToPowerOfTwo() PaddingStrategy
+//
+//	//hashing the plain text while encrypting
+//	func NewPlaintextHashingEncoder(encoder SecretStreamEncoder) *PlaintextHashingEncoder
+//	func (e *PlaintextHashingEncoder) PlaintextHash() Bytes
+//
+//	//encrypted net.Conn
+//	func NewSecretStreamConn(conn net.Conn, tx, rx SecretStreamXCPKey) *SecretStreamConn
+//
+//	//reusing encoders
+//	func NewEncoderPool() *EncoderPool
+//	func (p *EncoderPool) Get(key SecretStreamXCPKey, out io.Writer) SecretStreamEncoder
+//	func (p *EncoderPool) Put(enc SecretStreamEncoder)
+//
+//	//encrypted append-only log, one message per line
+//	func MakeEncryptedLogWriter(key SecretStreamXCPKey, out io.Writer) *EncryptedLogWriter
+//	func (w *EncryptedLogWriter) WriteLine(line []byte) error
+//	func MakeEncryptedLogReader(key SecretStreamXCPKey, in io.Reader, header SecretStreamXCPHeader) (*EncryptedLogReader, error)
+//	func (r *EncryptedLogReader) ReadLine() ([]byte, error)
+//
+//	//a new stream every maxBytesPerSegment bytes, e.g. rotated logs
+//	func MakeRotatingSecretStreamEncoder(key SecretStreamXCPKey, out io.Writer, maxBytesPerSegment int64) io.WriteCloser
+//	func MakeRotatingSecretStreamDecoder(key SecretStreamXCPKey, in io.Reader) io.Reader
+//
+//	//datagrams with sequence numbers, e.g. over UDP
+//	func MakeReplayProtectedEncoder(key SecretStreamXCPKey, out io.Writer) *ReplayProtectedEncoder
+//	func (e *ReplayProtectedEncoder) Header() SecretStreamXCPHeader
+//	func MakeReplayProtectedDecoder(key SecretStreamXCPKey, in io.Reader, header SecretStreamXCPHeader, windowSize int) (io.Reader, error)
 //
 // XCP (XChaCha20-Poly1305_IETF)
 //
+// # Envelope
+//
+// Simple self-describing format for encrypting a whole message with a
+// SecretStreamXCPKey. The version and algorithm of the format is checked
+// when opening.
+//
+//	func (b Bytes) SealEnvelope(key SecretStreamXCPKey) (c Bytes)
+//	func (b Bytes) OpenEnvelope(key SecretStreamXCPKey) (m Bytes, err error)
+//	func (b Bytes) SealEnvelopeWithAD(key SecretStreamXCPKey, ad Bytes) (c Bytes)
+//	func (b Bytes) OpenEnvelopeWithAD(key SecretStreamXCPKey, ad Bytes) (m Bytes, err error)
+//
+//	//values encoded with encoding/json or encoding/gob
+//	func SealJSON(key SecretStreamXCPKey, v interface{}) ([]byte, error)
+//	func OpenJSON(key SecretStreamXCPKey, blob []byte, v interface{}) error
+//	func SealGob(key SecretStreamXCPKey, v interface{}) ([]byte, error)
+//	func OpenGob(key SecretStreamXCPKey, blob []byte, v interface{}) error
+//
+// # Multi-Recipient Encryption
+//
+// A message encrypted once, as an Envelope with a random key, and the key
+// sealed for each recipient.
+//
+//	func MultiRecipientSeal(message []byte, recipients []BoxPublicKey) (blob []byte, err error)
+//	func MultiRecipientOpen(blob []byte, pk BoxPublicKey, sk BoxSecretKey) ([]byte, error)
+//
+// # Constructions
+//
+// The sizes of the keys, nonces and overheads of the encryption constructions
+// can be looked up by name, for code handling several of them.
+//
+//	func LookupConstruction(name string) (c Construction, ok bool)
+//	func Constructions() []Construction
+//	func (c Construction) Name() string
+//	func (c Construction) KeyBytes() int
+//	func (c Construction) NonceBytes() int
+//	func (c Construction) Overhead() int
+//
+// # Key Files
+//
+// Self-describing file format for storing any key of the package, checked
+// against corruption when read back.
+//
+//	func WriteKeyFile(w io.Writer, key Typed) error
+//	func ReadKeyFile(r io.Reader) (Typed, error)
+//
+//	//best-effort overwrite before removal
+//	func SecureDeleteFile(path string) error
+//
 // # Key Derivation
 //
 // Deriving subkeys from a single high-entropy key
 //
 //	func MakeMasterKey() MasterKey
+//	func MakeMasterKeyFrom(r io.Reader) (MasterKey, error)
+//	func MakeKDFKey() MasterKey
 //	func MakeKeyContext(s string) KeyContext
+//	func KDFContext(s string) (KeyContext, error)
 //	func (m MasterKey) Derive(length int, id uint64, context KeyContext) SubKey
 //
+//	//independent encryption and authentication keys
+//	func DeriveEncryptAuthKeys(master MasterKey) (encKey SecretBoxKey, authKey MACKey)
+//
+//	//nonces from a counter, e.g. for stateless systems
+//	func DeriveNonce(key GenericHashKey, counter uint64, nonceLen int) Bytes
+//
 // KDF (BLAKE2B)
 package sodium
 
@@ -207,22 +539,53 @@ import (
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"io"
 	"unsafe"
 )
 
 var (
-	ErrAuth          = errors.New("sodium: Message forged")
-	ErrOpenBox       = errors.New("sodium: Can't open box")
-	ErrOpenSign      = errors.New("sodium: Signature forged")
-	ErrDecryptAEAD   = errors.New("sodium: Can't decrypt message")
-	ErrPassword      = errors.New("sodium: Password not matched")
-	ErrInvalidKey    = errors.New("sodium: Invalid key")
-	ErrInvalidHeader = errors.New("sodium: Invalid header")
-	ErrDecryptSS     = errors.New("sodium: Can't decrypt stream")
-	ErrInvalidState  = errors.New("sodium: Invalid state")
-	ErrUnknown       = errors.New("sodium: Unknown")
+	ErrAuth                   = errors.New("sodium: Message forged")
+	ErrOpenBox                = errors.New("sodium: Can't open box")
+	ErrOpenSign               = errors.New("sodium: Signature forged")
+	ErrDecryptAEAD            = errors.New("sodium: Can't decrypt message")
+	ErrPassword               = errors.New("sodium: Password not matched")
+	ErrInvalidKey             = errors.New("sodium: Invalid key")
+	ErrInvalidHeader          = errors.New("sodium: Invalid header")
+	ErrDecryptSS              = errors.New("sodium: Can't decrypt stream")
+	ErrInvalidState           = errors.New("sodium: Invalid state")
+	ErrInvalidKeyContext      = errors.New("sodium: Invalid key context")
+	ErrAdditionalDataTooLarge = errors.New("sodium: Additional data too large")
+	ErrInvalidEncoding        = errors.New("sodium: Invalid encoding")
+	ErrUnsupportedVersion     = errors.New("sodium: Unsupported version")
+	ErrUnsupportedAlgorithm   = errors.New("sodium: Unsupported algorithm")
+	ErrMessageTooLarge        = errors.New("sodium: Message too large")
+	ErrInvalidPoint           = errors.New("sodium: Invalid point")
+	ErrUnsupportedLibrary     = errors.New("sodium: libsodium 1.0.18 or later is required")
+	ErrReplay                 = errors.New("sodium: Replayed or out-of-order message")
+	ErrInvalidChecksum        = errors.New("sodium: Invalid checksum")
+	ErrTruncatedStream        = errors.New("sodium: Stream truncated")
+	ErrInvalidPadding         = errors.New("sodium: Invalid padding")
+	ErrPlaintextTooLarge      = errors.New("sodium: Plain text too large")
+	ErrInvalidRecipients      = errors.New("sodium: Invalid number of recipients")
+	ErrUnknown                = errors.New("sodium: Unknown")
 )
 
+// SodiumError is returned when a libsodium function fails unexpectedly.
+// errors.Is(err, ErrUnknown) holds for it.
+type SodiumError struct {
+	Func string // name of the libsodium function
+	Code int    // its return code
+}
+
+func (e *SodiumError) Error() string {
+	return fmt.Sprintf("sodium: %s returned %d", e.Func, e.Code)
+}
+
+// Is makes SodiumError match ErrUnknown.
+func (e *SodiumError) Is(target error) bool {
+	return target == ErrUnknown
+}
+
 // Typed has pre-defined size.
 type Typed interface {
 	Size() int // Size returns the pre-defined size of the object.
@@ -242,6 +605,10 @@ func (b *Bytes) setBytes(s Bytes) {
 	*b = s[:]
 }
 
+func (b Bytes) bytes() Bytes {
+	return b
+}
+
 func plen(b []byte) (unsafe.Pointer, int) {
 	if len(b) > 0 {
 		return unsafe.Pointer(&b[0]), len(b)
@@ -265,3 +632,13 @@ func Randomize(k Typed) {
 	}
 	k.setBytes(b)
 }
+
+// readTyped fills the Typed with bytes read from r.
+func readTyped(k Typed, r io.Reader) error {
+	b := make([]byte, k.Size())
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+	k.setBytes(b)
+	return nil
+}
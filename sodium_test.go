@@ -2,10 +2,29 @@ package sodium
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"testing/iotest"
+	"time"
+	"unsafe"
 )
 
 var m = Bytes(make([]byte, 1024))
@@ -487,3 +506,3810 @@ func ExampleSecretStreamXCPDecoder_Read() {
 	//0
 	//true
 }
+
+func ExampleReadBufferSize() {
+	key := MakeSecretStreamXCPKey()
+	var buf bytes.Buffer
+	encoder := MakeSecretStreamXCPEncoder(key, &buf)
+	encoder.Write([]byte("chunk one "))
+	encoder.Write([]byte("chunk two "))
+	encoder.WriteAndClose([]byte("end"))
+
+	decoder, err := MakeSecretStreamXCPDecoder(key, &buf, encoder.Header(), ReadBufferSize(10))
+	fmt.Println(err)
+	chunk := make([]byte, 4)
+	var out []byte
+	for {
+		var n int
+		n, err = decoder.Read(chunk)
+		out = append(out, chunk[:n]...)
+		if err != nil {
+			break
+		}
+	}
+	fmt.Println(err == io.EOF)
+	fmt.Println(string(out))
+	//Output: <nil>
+	//true
+	//chunk one chunk two end
+}
+
+func ExampleBytes_Signcrypt() {
+	skp := MakeSignKP()
+	rkp := MakeBoxKP()
+
+	c := m.Signcrypt(skp.SecretKey, skp.PublicKey, rkp.PublicKey)
+	om, err := c.Unsigncrypt(rkp.SecretKey, skp.PublicKey)
+
+	fmt.Println(err)
+	fmt.Println(MemCmp(om, m, m.Length()) == 0)
+	//Output: <nil>
+	//true
+}
+
+func TestSigncrypt(t *testing.T) {
+	skp := MakeSignKP()
+	rkp := MakeBoxKP()
+	c := m.Signcrypt(skp.SecretKey, skp.PublicKey, rkp.PublicKey)
+
+	tampered := append(Bytes{}, c...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := tampered.Unsigncrypt(rkp.SecretKey, skp.PublicKey); err != ErrOpenBox {
+		t.Errorf("tampered cipher text: got %v", err)
+	}
+
+	if _, err := c[:cryptoBoxSealBytes].Unsigncrypt(rkp.SecretKey, skp.PublicKey); err != ErrOpenBox {
+		t.Errorf("truncated cipher text: got %v", err)
+	}
+
+	other := MakeSignKP()
+	if _, err := c.Unsigncrypt(rkp.SecretKey, other.PublicKey); err != ErrOpenSign {
+		t.Errorf("substituted sender key: got %v", err)
+	}
+
+	// a message signed by other, claiming to be from skp
+	forged := m.Signcrypt(other.SecretKey, skp.PublicKey, rkp.PublicKey)
+	if _, err := forged.Unsigncrypt(rkp.SecretKey, skp.PublicKey); err != ErrOpenSign {
+		t.Errorf("forged sender: got %v", err)
+	}
+
+	// receiver forwards the message to a third party
+	tkp := MakeBoxKP()
+	sm, err := c.SealedBoxOpen(rkp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forwarded := sm.SealedBox(tkp.PublicKey)
+	if _, err := forwarded.Unsigncrypt(tkp.SecretKey, skp.PublicKey); err != ErrOpenSign {
+		t.Errorf("forwarded message: got %v", err)
+	}
+}
+
+func ExampleKDFContext() {
+	context, err := KDFContext("userauth")
+	fmt.Println(context, err)
+	sk := MakeKDFKey().Derive(CryptoKDFBytesMin, 1, context)
+	fmt.Println(sk.Length() == CryptoKDFBytesMin)
+
+	_, err = KDFContext("testblablabla")
+	fmt.Println(err)
+	//Output: userauth <nil>
+	//true
+	//sodium: Invalid key context
+}
+
+func TestDeriveEncryptAuthKeys(t *testing.T) {
+	master := MakeMasterKey()
+	enc, auth := DeriveEncryptAuthKeys(master)
+	if enc.Length() != enc.Size() || auth.Length() != auth.Size() {
+		t.Fatalf("got %d and %d bytes", enc.Length(), auth.Length())
+	}
+	if enc.Equal(auth.Bytes) {
+		t.Error("both keys are the same")
+	}
+	if enc.Equal(master.Bytes) || auth.Equal(master.Bytes) {
+		t.Error("a key is the master key")
+	}
+
+	enc2, auth2 := DeriveEncryptAuthKeys(master)
+	if !enc.Equal(enc2.Bytes) || !auth.Equal(auth2.Bytes) {
+		t.Error("not deterministic")
+	}
+	enc3, auth3 := DeriveEncryptAuthKeys(MakeMasterKey())
+	if enc.Equal(enc3.Bytes) || auth.Equal(auth3.Bytes) {
+		t.Error("same keys from another master key")
+	}
+}
+
+func ExampleAEADAdditionalData() {
+	key := MakeAEADXCPKey()
+	n := AEADXCPNonce{}
+	Randomize(&n)
+
+	ad := NewAEADAdditionalData(32)
+	ad.Write([]byte("manifest "))
+	io.Copy(ad, bytes.NewReader([]byte("entries")))
+	_, err := ad.Write(make([]byte, 32))
+	fmt.Println(err)
+
+	e := m.AEADXCPEncrypt(ad.Bytes(), n, key)
+	err = e.AEADXCPVerify(Bytes("manifest entries"), n, key)
+	fmt.Println(err)
+	//Output: sodium: Additional data too large
+	//<nil>
+}
+
+func TestADBuilder(t *testing.T) {
+	ab := NewADBuilder().Add([]byte("ab")).Add([]byte("c")).Bytes()
+	bc := NewADBuilder().Add([]byte("a")).Add([]byte("bc")).Bytes()
+	if ab.Equal(bc) {
+		t.Error("different segments give the same additional data")
+	}
+	if NewADBuilder().Bytes().Equal(NewADBuilder().Add(nil).Bytes()) {
+		t.Error("an empty segment is lost")
+	}
+
+	var seq [8]byte
+	binary.BigEndian.PutUint64(seq[:], 7)
+	a := NewADBuilder().Add(seq[:]).Add(nil).Add([]byte("data"))
+	segments, err := ParseAD(a.Bytes())
+	if err != nil || len(segments) != 3 || !bytes.Equal(segments[0], seq[:]) ||
+		len(segments[1]) != 0 || string(segments[2]) != "data" {
+		t.Errorf("got %q, %v", segments, err)
+	}
+	if segments, err := ParseAD(nil); err != nil || len(segments) != 0 {
+		t.Errorf("empty: got %q, %v", segments, err)
+	}
+	for _, l := range []int{1, 3, 5, a.Bytes().Length() - 1} {
+		if _, err := ParseAD(a.Bytes()[:l]); err != ErrInvalidEncoding {
+			t.Errorf("truncated to %d bytes: got %v", l, err)
+		}
+	}
+
+	key := MakeSecretStreamXCPKey()
+	var stream bytes.Buffer
+	encoder := MakeSecretStreamXCPEncoder(key, &stream)
+	encoder.(*SecretStreamXCPEncoder).WriteWithAD(m, a.Bytes())
+	decoder, _ := MakeSecretStreamXCPDecoder(key, bytes.NewReader(stream.Bytes()), encoder.Header())
+	if _, err := decoder.(*SecretStreamXCPDecoder).ReadWithAD(make([]byte, len(m)), NewADBuilder().Add(seq[:]).Add([]byte("data")).Bytes()); err != ErrDecryptSS {
+		t.Errorf("other segments: got %v, want ErrDecryptSS", err)
+	}
+	decoder, _ = MakeSecretStreamXCPDecoder(key, bytes.NewReader(stream.Bytes()), encoder.Header())
+	if _, err := decoder.(*SecretStreamXCPDecoder).ReadWithAD(make([]byte, len(m)), a.Bytes()); err != nil {
+		t.Errorf("same segments: %v", err)
+	}
+	a.Reset()
+	if a.Bytes().Length() != 0 {
+		t.Error("not reset")
+	}
+}
+
+func ExampleMakeSecretStreamXCPKeyFrom() {
+	seed := bytes.Repeat([]byte{0x42}, 32)
+	k1, err := MakeSecretStreamXCPKeyFrom(bytes.NewReader(seed))
+	fmt.Println(err)
+	k2, _ := MakeSecretStreamXCPKeyFrom(bytes.NewReader(seed))
+	fmt.Println(MemCmp(k1.Bytes, k2.Bytes, k1.Size()) == 0)
+
+	_, err = MakeSecretStreamXCPKeyFrom(bytes.NewReader(seed[:16]))
+	fmt.Println(err)
+
+	k3, _ := MakeSecretStreamXCPKeyFrom(nil)
+	fmt.Println(k3.Length())
+	//Output: <nil>
+	//true
+	//unexpected EOF
+	//32
+}
+
+func ExampleVerify32() {
+	kp := MakeBoxKP()
+	pk := kp.SecretKey.PublicKey()
+
+	fmt.Println(Verify32(kp.PublicKey.Bytes, pk.Bytes))
+	fmt.Println(Verify32(kp.PublicKey.Bytes, kp.SecretKey.Bytes))
+	fmt.Println(Verify32(kp.PublicKey.Bytes, pk.Bytes[:16]))
+	fmt.Println(Verify16(pk.Bytes[:16], pk.Bytes[:16]))
+	//Output: true
+	//false
+	//false
+	//true
+}
+
+func ExampleEncoderPool() {
+	key := MakeSecretStreamXCPKey()
+	pool := NewEncoderPool()
+
+	var buf bytes.Buffer
+	encoder := pool.Get(key, &buf)
+	header := encoder.Header()
+	encoder.WriteAndClose([]byte("test"))
+	pool.Put(encoder)
+
+	decoder, _ := MakeSecretStreamXCPDecoder(key, &buf, header)
+	chunk := make([]byte, 4)
+	n, err := decoder.Read(chunk)
+	fmt.Println(string(chunk[:n]), err == io.EOF)
+	//Output: test true
+}
+
+func BenchmarkMakeSecretStreamXCPEncoder(b *testing.B) {
+	key := MakeSecretStreamXCPKey()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			encoder := MakeSecretStreamXCPEncoder(key, io.Discard)
+			encoder.Write(m)
+			encoder.Close()
+		}
+	})
+}
+
+func BenchmarkEncoderPool(b *testing.B) {
+	key := MakeSecretStreamXCPKey()
+	pool := NewEncoderPool()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			encoder := pool.Get(key, io.Discard)
+			encoder.Write(m)
+			encoder.Close()
+			pool.Put(encoder)
+		}
+	})
+}
+
+func ExampleMakeSecretStreamXCPEncoderWithHeader() {
+	key := MakeSecretStreamXCPKey()
+	var buf bytes.Buffer
+	encoder := MakeSecretStreamXCPEncoderWithHeader(key, &buf)
+	encoder.WriteAndClose([]byte("test"))
+	fmt.Println(buf.Len())
+
+	decoder, err := MakeSecretStreamXCPDecoderAutoHeader(key, &buf)
+	fmt.Println(err)
+	chunk := make([]byte, 4)
+	n, err := decoder.Read(chunk)
+	fmt.Println(string(chunk[:n]), err == io.EOF)
+
+	_, err = MakeSecretStreamXCPDecoderAutoHeader(key, bytes.NewReader(make([]byte, 10)))
+	fmt.Println(err)
+	//Output: 45
+	//<nil>
+	//test true
+	//sodium: Invalid header
+}
+
+func ExampleParseSecretStreamXCPKeyHex() {
+	key := MakeSecretStreamXCPKey()
+
+	k1, err := ParseSecretStreamXCPKeyHex(key.Hex())
+	fmt.Println(err, MemCmp(k1.Bytes, key.Bytes, key.Size()) == 0)
+
+	k2, err := ParseSecretStreamXCPKeyBase64(key.Base64(Base64Variant_URLSafeNoPadding), Base64Variant_URLSafeNoPadding)
+	fmt.Println(err, MemCmp(k2.Bytes, key.Bytes, key.Size()) == 0)
+
+	_, err = ParseSecretStreamXCPKeyHex(key.Hex()[:32])
+	fmt.Println(err)
+	_, err = ParseSecretStreamXCPKeyHex("not hex")
+	fmt.Println(err)
+
+	fmt.Println(Bytes("sodium").Hex(), Bytes("sodium").Base64(Base64Variant_Original))
+	//Output: <nil> true
+	//<nil> true
+	//sodium: Invalid key
+	//sodium: Invalid encoding
+	//736f6469756d c29kaXVt
+}
+
+func ExampleBytes_SealEnvelope() {
+	key := MakeSecretStreamXCPKey()
+
+	c := Bytes("test").SealEnvelope(key)
+	fmt.Println(c[0], c[1], c.Length())
+
+	md, err := c.OpenEnvelope(key)
+	fmt.Println(string(md), err)
+
+	c[0] = 2
+	_, err = c.OpenEnvelope(key)
+	fmt.Println(err)
+	//Output: 1 1 47
+	//test <nil>
+	//sodium: Unsupported version
+}
+
+func TestOpenEnvelopeGolden(t *testing.T) {
+	golden, err := os.ReadFile("testdata/envelope_v1.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := SecretStreamXCPKey{make([]byte, 32)}
+	for i := range key.Bytes {
+		key.Bytes[i] = byte(i)
+	}
+
+	md, err := Bytes(golden).OpenEnvelope(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(md) != "golden envelope" {
+		t.Errorf("got %q", md)
+	}
+
+	for i := range golden {
+		tampered := append(Bytes{}, golden...)
+		tampered[i] ^= 1
+		if _, err := tampered.OpenEnvelope(key); err == nil {
+			t.Errorf("tampered byte %d: opened", i)
+		}
+	}
+	if _, err := Bytes(golden[:len(golden)-1]).OpenEnvelope(key); err == nil {
+		t.Error("truncated: opened")
+	}
+}
+
+type envelopeRecord struct {
+	Name  string
+	Tags  []string
+	Inner struct {
+		ID    int
+		Attrs map[string]float64
+	}
+}
+
+func TestSealJSONGob(t *testing.T) {
+	key := MakeSecretStreamXCPKey()
+	var v envelopeRecord
+	v.Name = "test"
+	v.Tags = []string{"a", "b"}
+	v.Inner.ID = 42
+	v.Inner.Attrs = map[string]float64{"x": 1.5}
+
+	seals := map[string]func(SecretStreamXCPKey, interface{}) ([]byte, error){"json": SealJSON, "gob": SealGob}
+	opens := map[string]func(SecretStreamXCPKey, []byte, interface{}) error{"json": OpenJSON, "gob": OpenGob}
+	for name, seal := range seals {
+		blob, err := seal(key, v)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var got envelopeRecord
+		if err := opens[name](key, blob, &got); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, v) {
+			t.Errorf("%s: got %+v, want %+v", name, got, v)
+		}
+		if err := opens[name](MakeSecretStreamXCPKey(), blob, &got); err != ErrDecryptSS {
+			t.Errorf("%s: wrong key: got %v", name, err)
+		}
+	}
+
+	if _, err := SealJSON(key, make(chan int)); err == nil {
+		t.Error("json: expected an error for a channel")
+	}
+	blob := Bytes("not json").SealEnvelope(key)
+	if err := OpenJSON(key, blob, &v); err == nil {
+		t.Error("json: expected an error for invalid JSON")
+	}
+}
+
+func ExampleConstantTimeSelect() {
+	a := Bytes("left")
+	b := Bytes("righ")
+
+	fmt.Println(string(ConstantTimeSelect(1, a, b)))
+	fmt.Println(string(ConstantTimeSelect(0, a, b)))
+	//Output: left
+	//righ
+}
+
+func ExampleBytes_BoxSealNonce() {
+	rkp := MakeBoxKP()
+	skp := MakeBoxKP()
+
+	c := m.BoxSealNonce(rkp.PublicKey, skp.SecretKey)
+	om, err := c.BoxOpenSealNonce(skp.PublicKey, rkp.SecretKey)
+
+	fmt.Println(c.Length() == m.Length()+cryptoBoxNonceBytes+cryptoBoxMacBytes)
+	fmt.Println(err)
+	fmt.Println(MemCmp(om, m, m.Length()) == 0)
+
+	_, err = c[:cryptoBoxNonceBytes].BoxOpenSealNonce(skp.PublicKey, rkp.SecretKey)
+	fmt.Println(err)
+	//Output: true
+	//<nil>
+	//true
+	//sodium: Can't open box
+}
+
+func ExampleNewSecretStreamConn() {
+	ckp := MakeKXKP()
+	skp := MakeKXKP()
+	css, _ := ckp.ClientSessionKeys(skp.PublicKey)
+	sss, _ := skp.ServerSessionKeys(ckp.PublicKey)
+
+	a, b := net.Pipe()
+	client := NewSecretStreamConn(a, SecretStreamXCPKey{css.Tx.Bytes}, SecretStreamXCPKey{css.Rx.Bytes})
+	server := NewSecretStreamConn(b, SecretStreamXCPKey{sss.Tx.Bytes}, SecretStreamXCPKey{sss.Rx.Bytes})
+
+	go func() {
+		client.Write([]byte("hello "))
+		client.Write([]byte("server"))
+		client.Close()
+	}()
+	msg, err := io.ReadAll(server)
+	fmt.Println(string(msg), err)
+	//Output: hello server <nil>
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// flakyConn times out every other call and transfers at most 3 bytes at once.
+type flakyConn struct {
+	net.Conn
+	buf   bytes.Buffer
+	calls int
+}
+
+func (c *flakyConn) Read(b []byte) (int, error) {
+	c.calls++
+	if c.calls%2 == 0 {
+		return 0, timeoutError{}
+	}
+	if len(b) > 3 {
+		b = b[:3]
+	}
+	return c.buf.Read(b)
+}
+
+func (c *flakyConn) Write(b []byte) (int, error) {
+	c.calls++
+	if c.calls%2 == 0 {
+		return 0, timeoutError{}
+	}
+	if len(b) > 3 {
+		b = b[:3]
+	}
+	n, _ := c.buf.Write(b)
+	return n, timeoutError{}
+}
+
+func (c *flakyConn) Close() error {
+	return nil
+}
+
+func TestSecretStreamConnTimeout(t *testing.T) {
+	tx := MakeSecretStreamXCPKey()
+	rx := MakeSecretStreamXCPKey()
+	conn := &flakyConn{}
+	w := NewSecretStreamConn(conn, tx, rx)
+
+	msg := m[:100]
+	for sent := msg; len(sent) > 0; {
+		n, err := w.Write(sent)
+		if err == nil {
+			break
+		}
+		if _, ok := err.(net.Error); !ok {
+			t.Fatal(err)
+		}
+		sent = sent[n:]
+	}
+	for i := 0; ; i++ {
+		err := w.Close()
+		if err == nil {
+			break
+		}
+		if _, ok := err.(net.Error); !ok || i == 100 {
+			t.Fatalf("Close: %v", err)
+		}
+	}
+	stream := append([]byte{}, conn.buf.Bytes()...)
+
+	r := NewSecretStreamConn(conn, rx, tx)
+	var got []byte
+	b := make([]byte, 7)
+	for {
+		n, err := r.Read(b)
+		got = append(got, b[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if _, ok := err.(net.Error); err != nil && !ok {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(got, msg) {
+		t.Errorf("got %x", got)
+	}
+
+	truncated := &flakyConn{}
+	truncated.buf.Write(stream[:len(stream)-1])
+	r = NewSecretStreamConn(truncated, rx, tx)
+	var err error
+	for {
+		if _, err = r.Read(b); err == nil {
+			continue
+		}
+		if _, ok := err.(net.Error); !ok {
+			break
+		}
+	}
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated: got %v", err)
+	}
+}
+
+func ExampleNewShortHash() {
+	key := ShortHashKey{}
+	Randomize(&key)
+
+	h := NewShortHash(key)
+	h.Write([]byte("short "))
+	h.Write([]byte("message"))
+	sum := h.Sum(nil)
+	sum64 := h.Sum64()
+
+	hash := Bytes(`short message`).Shorthash(key)
+	fmt.Println(MemCmp(sum, hash, hash.Length()) == 0)
+	fmt.Println(sum64 == binary.LittleEndian.Uint64(hash))
+
+	h.Reset()
+	h.Write([]byte("short message"))
+	fmt.Println(h.Sum64() == sum64)
+	//Output: true
+	//true
+	//true
+}
+
+func TestSecretStreamMessageTooLarge(t *testing.T) {
+	max := SecretStreamMessageBytesMax()
+	if uint64(^uint(0)>>1) <= max {
+		t.Skip("max message length doesn't fit in a slice")
+	}
+	if err := checkMessageLen(int(max) + 1); err != ErrMessageTooLarge {
+		t.Errorf("max+1: got %v", err)
+	}
+	if err := checkMessageLen(int(max)); err != nil {
+		t.Errorf("max: got %v", err)
+	}
+	if err := checkMessageLen(0); err != nil {
+		t.Errorf("empty: got %v", err)
+	}
+}
+
+func TestSecretStreamEmptyMessage(t *testing.T) {
+	key := MakeSecretStreamXCPKey()
+	var buf bytes.Buffer
+	encoder := MakeSecretStreamXCPEncoder(key, &buf)
+	if _, err := encoder.Write(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := encoder.Write([]byte{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 3*cryptoSecretStreamXChaCha20Poly1305ABytes {
+		t.Fatalf("stream length %d", buf.Len())
+	}
+
+	decoder, err := MakeSecretStreamXCPDecoder(key, &buf, encoder.Header())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := decoder.(*SecretStreamXCPDecoder)
+	for i := 0; i < 2; i++ {
+		if err := d.ReadEmptyChunk(); err != nil {
+			t.Fatalf("chunk %d: got %v", i, err)
+		}
+		if d.Tag() != SecretStreamTag_Message {
+			t.Fatalf("chunk %d: got tag %d", i, d.Tag())
+		}
+	}
+	if err := d.ReadEmptyChunk(); err != io.EOF {
+		t.Fatalf("final chunk: got %v", err)
+	}
+
+	c := Bytes(nil).SealEnvelope(key)
+	if md, err := c.OpenEnvelope(key); err != nil || md.Length() != 0 {
+		t.Fatalf("envelope: got %q, %v", md, err)
+	}
+}
+
+// liarReader claims to read more than asked.
+type liarReader struct{}
+
+func (liarReader) Read(b []byte) (int, error) {
+	return len(b) + 1, nil
+}
+
+// stuckReader never makes progress.
+type stuckReader struct{}
+
+func (stuckReader) Read(b []byte) (int, error) {
+	return 0, nil
+}
+
+func TestSecretStreamDecoderEdgeCases(t *testing.T) {
+	key := MakeSecretStreamXCPKey()
+	var buf bytes.Buffer
+	encoder := MakeSecretStreamXCPEncoder(key, &buf)
+	encoder.Write([]byte("test"))
+	encoder.WriteAndClose([]byte("end"))
+	stream := buf.Bytes()
+
+	decoder, _ := MakeSecretStreamXCPDecoder(key, iotest.OneByteReader(bytes.NewReader(stream)), encoder.Header())
+	b := make([]byte, 4)
+	if n, err := decoder.Read(b); n != 4 || err != nil || string(b) != "test" {
+		t.Errorf("short reads: got %d, %v", n, err)
+	}
+	if n, err := decoder.Read(b); n != 3 || err != io.EOF || string(b[:n]) != "end" {
+		t.Errorf("short reads, last chunk: got %d, %v", n, err)
+	}
+
+	r := bytes.NewReader(stream)
+	decoder, _ = MakeSecretStreamXCPDecoder(key, r, encoder.Header())
+	if n, err := decoder.Read(nil); n != 0 || err != nil || r.Len() != len(stream) {
+		t.Errorf("empty buffer: got %d, %v, read %d bytes", n, err, len(stream)-r.Len())
+	}
+	if n, err := decoder.Read(b); n != 4 || err != nil || string(b) != "test" {
+		t.Errorf("after an empty buffer: got %d, %v", n, err)
+	}
+	if err := decoder.(*SecretStreamXCPDecoder).ReadEmptyChunk(); err != ErrDecryptSS {
+		t.Errorf("empty chunk read for a non-empty one: got %v", err)
+	}
+
+	decoder, _ = MakeSecretStreamXCPDecoder(key, bytes.NewReader(stream[:10]), encoder.Header())
+	if _, err := decoder.Read(b); err != ErrDecryptSS {
+		t.Errorf("truncated chunk: got %v", err)
+	}
+
+	decoder, _ = MakeSecretStreamXCPDecoder(key, bytes.NewReader(stream[:21]), encoder.Header())
+	if n, err := decoder.Read(b); n != 4 || err != nil {
+		t.Errorf("truncated stream, first chunk: got %d, %v", n, err)
+	}
+	if _, err := decoder.Read(b); err != ErrDecryptSS {
+		t.Errorf("truncated stream: got %v", err)
+	}
+
+	decoder, _ = MakeSecretStreamXCPDecoder(key, liarReader{}, encoder.Header())
+	if _, err := decoder.Read(b); err != ErrDecryptSS {
+		t.Errorf("reader overflowing the buffer: got %v", err)
+	}
+
+	decoder, _ = MakeSecretStreamXCPDecoder(key, stuckReader{}, encoder.Header())
+	if _, err := decoder.Read(b); err != io.ErrNoProgress {
+		t.Errorf("reader without progress: got %v", err)
+	}
+}
+
+func ExamplePWHashScryptStoreInteractive() {
+	s := PWHashScryptStoreInteractive("test")
+	str := s.Value()              // legacy hash from storage
+	t := LoadPWHashScryptStr(str) // load from storage
+	fmt.Println(t.PWHashVerify("test"))
+	fmt.Println(t.PWHashVerify("wrong"))
+
+	salt := PWHashScryptSalt{}
+	Randomize(&salt)
+	key, err := PWHashScrypt("test", salt, 32, CryptoPWHashScryptOpsLimitInteractive, CryptoPWHashScryptMemLimitInteractive)
+	fmt.Println(key.Length(), err)
+	//Output: <nil>
+	//sodium: Password not matched
+	//32 <nil>
+}
+
+func ExampleBoxKPFromScalar() {
+	s := Scalar{bytes.Repeat([]byte{0xff}, 32)}
+	kp := BoxKPFromScalar(s)
+
+	fmt.Println(kp.SecretKey.Bytes[0], kp.SecretKey.Bytes[31])
+	fmt.Println(MemCmp(kp.PublicKey.Bytes, CryptoScalarmultBase(s).Bytes, 32) == 0)
+
+	rkp := MakeBoxKP()
+	n := BoxNonce{}
+	Randomize(&n)
+	bc := m.Box(n, rkp.PublicKey, kp.SecretKey)
+	_, err := bc.BoxOpen(n, kp.PublicKey, rkp.SecretKey)
+	fmt.Println(err)
+	//Output: 248 127
+	//true
+	//<nil>
+}
+
+func TestGenericHashParallelGolden(t *testing.T) {
+	d := make([]byte, 10000)
+	for i := range d {
+		d[i] = byte(i % 251)
+	}
+	vectors := []struct {
+		data      []byte
+		chunkSize int
+		want      string
+	}{
+		{nil, 1024, "024db4a9a56212d347f2486d89765e725140ef3dcc0bca8197d5595f9922297f"},
+		{d, 1024, "83eb5e7364362bbe64645d1314660a12bd50efeb03a92a215c9c529c3f604089"},
+		{d, 4096, "9ff362eca36041d96210862b4a3ef3480030aa0bcb60204c03e92efae43f8a4d"},
+	}
+	for _, v := range vectors {
+		for _, workers := range []int{0, 1, 3, 64} {
+			got := CryptoGenericHashParallel(v.data, v.chunkSize, workers).Hex()
+			if got != v.want {
+				t.Errorf("len %d chunk %d workers %d: got %s, want %s", len(v.data), v.chunkSize, workers, got, v.want)
+			}
+		}
+	}
+}
+
+func BenchmarkGenericHash(b *testing.B) {
+	d := make([]byte, 64<<20)
+	b.SetBytes(int64(len(d)))
+	for i := 0; i < b.N; i++ {
+		h := NewGenericHashDefault()
+		h.Write(d)
+		h.Sum(nil)
+	}
+}
+
+func BenchmarkGenericHashParallel(b *testing.B) {
+	d := make([]byte, 64<<20)
+	b.SetBytes(int64(len(d)))
+	for i := 0; i < b.N; i++ {
+		CryptoGenericHashParallel(d, 1<<20, 0)
+	}
+}
+
+func ExampleSecretBoxOverhead() {
+	n := SecretBoxNonce{}
+	k := SecretBoxKey{}
+	Randomize(&n)
+	Randomize(&k)
+	fmt.Println(m.SecretBox(n, k).Length() - m.Length())
+
+	fmt.Println(SecretBoxOverhead(), BoxOverhead(), SealedBoxOverhead())
+	fmt.Println(AEADXChaCha20Poly1305Overhead(), SecretStreamOverhead())
+	//Output: 16
+	//16 16 48
+	//16 17
+}
+
+func TestAEADCPRFC8439(t *testing.T) {
+	k := AEADCPKey{make([]byte, 32)}
+	for i := range k.Bytes {
+		k.Bytes[i] = byte(0x80 + i)
+	}
+	n := AEADCPNonce{[]byte{0x07, 0x00, 0x00, 0x00, 0x40, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47}}
+	ad := Bytes{0x50, 0x51, 0x52, 0x53, 0xc0, 0xc1, 0xc2, 0xc3, 0xc4, 0xc5, 0xc6, 0xc7}
+	p := Bytes("Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it.")
+
+	want := "d31a8d34648e60db7b86afbc53ef7ec2a4aded51296e08fea9e2b5a736ee62d6" +
+		"3dbea45e8ca9671282fafb69da92728b1a71de0a9e060b2905d6a5b67ecd3b36" +
+		"92ddbd7f2d778b8c9803aee328091b58fab324e4fad675945585808b4831d7bc" +
+		"3ff4def08e4b7a9de576d26586cec64b6116" +
+		"1ae10b594f09e26a7e902ecbd0600691"
+
+	c := p.AEADCPEncrypt(ad, n, k)
+	if c.Hex() != want {
+		t.Fatalf("got %s, want %s", c.Hex(), want)
+	}
+	d, err := c.AEADCPDecrypt(ad, n, k)
+	if err != nil || !bytes.Equal(d, p) {
+		t.Errorf("decrypt failed: %v", err)
+	}
+}
+
+func ExampleMakeEncryptedLogWriter() {
+	key := MakeSecretStreamXCPKey()
+	log := &bytes.Buffer{}
+
+	w := MakeEncryptedLogWriter(key, log)
+	w.WriteLine([]byte("user logged in"))
+	w.WriteLine([]byte("user logged out"))
+	w.Close()
+
+	r, _ := MakeEncryptedLogReader(key, log, w.Header())
+	for {
+		line, err := r.ReadLine()
+		if err != nil {
+			fmt.Println(err)
+			break
+		}
+		fmt.Printf("%s\n", line)
+	}
+	//Output: user logged in
+	//user logged out
+	//EOF
+}
+
+func TestEncryptedLogTruncated(t *testing.T) {
+	key := MakeSecretStreamXCPKey()
+	log := &bytes.Buffer{}
+	w := MakeEncryptedLogWriter(key, log)
+	w.WriteLine([]byte("first"))
+	first := log.Len()
+	w.WriteLine([]byte("second"))
+	second := log.Len()
+	w.Close()
+	full := log.Bytes()
+
+	for _, l := range []int{first, first + 3, first + 10, second, len(full) - 1} {
+		r, _ := MakeEncryptedLogReader(key, bytes.NewReader(full[:l]), w.Header())
+		if line, err := r.ReadLine(); err != nil || string(line) != "first" {
+			t.Fatalf("cut at %d: first line %q, %v", l, line, err)
+		}
+		if l >= second {
+			if line, err := r.ReadLine(); err != nil || string(line) != "second" {
+				t.Fatalf("cut at %d: second line %q, %v", l, line, err)
+			}
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := r.ReadLine(); err != io.ErrUnexpectedEOF {
+				t.Errorf("cut at %d: got %v, want io.ErrUnexpectedEOF", l, err)
+			}
+		}
+	}
+
+	r, _ := MakeEncryptedLogReader(key, bytes.NewReader(full[first:]), w.Header())
+	if _, err := r.ReadLine(); err != ErrDecryptSS {
+		t.Errorf("dropped line: got %v, want ErrDecryptSS", err)
+	}
+}
+
+func TestCoreEd25519(t *testing.T) {
+	a, b := MakeEd25519Scalar(), MakeEd25519Scalar()
+	aB, err := CryptoScalarmultEd25519BaseNoClamp(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bB, _ := CryptoScalarmultEd25519BaseNoClamp(b)
+	if !CryptoCoreEd25519IsValidPoint(aB) {
+		t.Error("a*B is not valid")
+	}
+
+	abB, _ := CryptoScalarmultEd25519NoClamp(a, bB)
+	baB, _ := CryptoScalarmultEd25519NoClamp(b, aB)
+	if !bytes.Equal(abB.Bytes, baB.Bytes) {
+		t.Error("a*(b*B) != b*(a*B)")
+	}
+
+	sum, _ := CryptoCoreEd25519Add(aB, bB)
+	diff, _ := CryptoCoreEd25519Sub(sum, bB)
+	if !bytes.Equal(diff.Bytes, aB.Bytes) {
+		t.Error("a*B + b*B - b*B != a*B")
+	}
+
+	clamped, _ := CryptoScalarmultEd25519Base(a)
+	if bytes.Equal(clamped.Bytes, aB.Bytes) {
+		t.Error("clamped and unclamped products are equal")
+	}
+
+	u := Ed25519Uniform{}
+	Randomize(&u)
+	if !CryptoCoreEd25519IsValidPoint(CryptoCoreEd25519FromUniform(u)) {
+		t.Error("point from uniform is not valid")
+	}
+
+	identity := Ed25519Point{make([]byte, 32)}
+	identity.Bytes[0] = 1
+	noncanonical := Ed25519Point{bytes.Repeat([]byte{0xff}, 32)}
+	offcurve := Ed25519Point{make([]byte, 32)}
+	offcurve.Bytes[0] = 8
+	for _, p := range []Ed25519Point{identity, noncanonical, offcurve, {make([]byte, 32)}, {aB.Bytes[:31]}} {
+		if CryptoCoreEd25519IsValidPoint(p) {
+			t.Errorf("%x is valid", p.Bytes)
+		}
+	}
+	if _, err := CryptoCoreEd25519Add(aB, offcurve); err != ErrInvalidPoint {
+		t.Errorf("add invalid point: got %v", err)
+	}
+	if _, err := CryptoScalarmultEd25519NoClamp(a, identity); err != ErrInvalidPoint {
+		t.Errorf("scalarmult small order point: got %v", err)
+	}
+}
+
+func TestSecretStreamDecoderAutoHeaderShortReads(t *testing.T) {
+	key := MakeSecretStreamXCPKey()
+	var buf bytes.Buffer
+	encoder := MakeSecretStreamXCPEncoderWithHeader(key, &buf)
+	encoder.WriteAndClose([]byte("test"))
+	stream := buf.Bytes()
+
+	decoder, err := MakeSecretStreamXCPDecoderAutoHeader(key, iotest.OneByteReader(bytes.NewReader(stream)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk := make([]byte, 4)
+	if n, err := decoder.Read(chunk); err != io.EOF || string(chunk[:n]) != "test" {
+		t.Errorf("got %q, %v", chunk[:n], err)
+	}
+
+	for _, l := range []int{0, 1, cryptoSecretStreamXChaCha20Poly1305HeaderBytes - 1} {
+		in := iotest.OneByteReader(bytes.NewReader(stream[:l]))
+		if _, err := MakeSecretStreamXCPDecoderAutoHeader(key, in); err != ErrInvalidHeader {
+			t.Errorf("%d bytes: got %v, want ErrInvalidHeader", l, err)
+		}
+	}
+
+	in := iotest.TimeoutReader(bytes.NewReader(stream))
+	in.Read(make([]byte, 1))
+	if _, err := MakeSecretStreamXCPDecoderAutoHeader(key, in); err != iotest.ErrTimeout {
+		t.Errorf("got %v, want iotest.ErrTimeout", err)
+	}
+}
+
+func ExampleBytes_Equal() {
+	key1 := MakeSecretStreamXCPKey()
+	key2 := SecretStreamXCPKey{append(Bytes{}, key1.Bytes...)}
+	fmt.Println(key1.Equal(key2.Bytes))
+
+	key2.Bytes[31] ^= 1
+	fmt.Println(key1.Equal(key2.Bytes))
+	fmt.Println(key1.Equal(key1.Bytes[:16]))
+	fmt.Println(Bytes{}.Equal(nil))
+	//Output: true
+	//false
+	//false
+	//true
+}
+
+func TestSecretStreamRekey(t *testing.T) {
+	key := MakeSecretStreamXCPKey()
+	var buf bytes.Buffer
+	encoder := MakeSecretStreamXCPEncoder(key, &buf)
+	encoder.(*SecretStreamXCPEncoder).SetRekeyInterval(3)
+	for i := 0; i < 10; i++ {
+		if i == 4 {
+			encoder.(*SecretStreamXCPEncoder).Rekey()
+		}
+		encoder.Write([]byte{byte(i)})
+	}
+	encoder.Close()
+	stream := append([]byte{}, buf.Bytes()...)
+
+	decoder, _ := MakeSecretStreamXCPDecoder(key, &buf, encoder.Header())
+	var rekeys []int
+	for i := 0; i < 10; i++ {
+		b := make([]byte, 1)
+		if _, err := decoder.Read(b); err != nil || b[0] != byte(i) {
+			t.Fatalf("chunk %d: got %v, %v", i, b, err)
+		}
+		if decoder.Tag() == SecretStreamTag_Rekey {
+			rekeys = append(rekeys, i)
+		}
+	}
+	if err := decoder.(*SecretStreamXCPDecoder).ReadEmptyChunk(); err != io.EOF {
+		t.Errorf("got %v, want io.EOF", err)
+	}
+	if fmt.Sprint(rekeys) != "[2 4 5 8]" {
+		t.Errorf("rekeyed after chunks %v", rekeys)
+	}
+
+	// The tag is authenticated: a chunk can't be turned into a rekey.
+	stream[0] ^= 0x02 // crypto_secretstream_xchacha20poly1305_TAG_REKEY
+	decoder, _ = MakeSecretStreamXCPDecoder(key, bytes.NewReader(stream), encoder.Header())
+	if _, err := decoder.Read(make([]byte, 1)); err != ErrDecryptSS {
+		t.Errorf("got %v, want ErrDecryptSS", err)
+	}
+}
+
+func TestNewDecryptingReader(t *testing.T) {
+	key := MakeSecretStreamXCPKey()
+	m := make([]byte, SecretStreamChunkBytes*5/2)
+	rand.Read(m)
+
+	var buf bytes.Buffer
+	encoder := MakeSecretStreamXCPEncoderWithHeader(key, &buf)
+	encoder.Write(m[:SecretStreamChunkBytes])
+	encoder.Write(m[SecretStreamChunkBytes : 2*SecretStreamChunkBytes])
+	encoder.WriteAndClose(m[2*SecretStreamChunkBytes:])
+	stream := buf.Bytes()
+
+	r, err := NewDecryptingReader(key, bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if _, err := io.Copy(&out, r); err != nil || !bytes.Equal(out.Bytes(), m) {
+		t.Fatalf("copy: %v", err)
+	}
+	if _, err := r.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("read after end: got %v, want io.EOF", err)
+	}
+
+	headerLen := cryptoSecretStreamXChaCha20Poly1305HeaderBytes
+	chunkLen := SecretStreamChunkBytes + cryptoSecretStreamXChaCha20Poly1305ABytes
+	for _, l := range []int{headerLen, headerLen + chunkLen, headerLen + chunkLen + 100, len(stream) - 1} {
+		r, err := NewDecryptingReader(key, bytes.NewReader(stream[:l]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(io.Discard, r); err != ErrDecryptSS {
+			t.Errorf("truncated at %d: got %v, want ErrDecryptSS", l, err)
+		}
+	}
+}
+
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	if w.n < len(b) {
+		return 0, io.ErrShortWrite
+	}
+	w.n -= len(b)
+	return len(b), nil
+}
+
+func TestNewEncryptingWriter(t *testing.T) {
+	key := MakeSecretStreamXCPKey()
+	for _, size := range []int{0, 1, SecretStreamChunkBytes, SecretStreamChunkBytes*3 + 7} {
+		m := make([]byte, size)
+		rand.Read(m)
+
+		var buf bytes.Buffer
+		w, err := NewEncryptingWriter(key, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(w, iotest.HalfReader(bytes.NewReader(m))); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		l := buf.Len()
+		if err := w.Close(); err != nil || buf.Len() != l {
+			t.Errorf("second Close: %v, wrote %d bytes", err, buf.Len()-l)
+		}
+		if _, err := w.Write([]byte{1}); err != ErrInvalidState {
+			t.Errorf("Write after Close: got %v, want ErrInvalidState", err)
+		}
+
+		r, _ := NewDecryptingReader(key, &buf)
+		var out bytes.Buffer
+		if _, err := io.Copy(&out, r); err != nil || !bytes.Equal(out.Bytes(), m) {
+			t.Errorf("size %d: %v", size, err)
+		}
+	}
+
+	if _, err := NewEncryptingWriter(key, &failingWriter{}); err != io.ErrShortWrite {
+		t.Errorf("header: got %v, want io.ErrShortWrite", err)
+	}
+	w, _ := NewEncryptingWriter(key, &failingWriter{n: cryptoSecretStreamXChaCha20Poly1305HeaderBytes})
+	if _, err := w.Write(make([]byte, SecretStreamChunkBytes+1)); err != io.ErrShortWrite {
+		t.Errorf("Write: got %v, want io.ErrShortWrite", err)
+	}
+	if _, err := w.Write([]byte{1}); err != io.ErrShortWrite {
+		t.Errorf("Write after error: got %v, want io.ErrShortWrite", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := w.Close(); err != io.ErrShortWrite {
+			t.Errorf("Close after error: got %v, want io.ErrShortWrite", err)
+		}
+	}
+}
+
+func TestGenericHashClone(t *testing.T) {
+	key := GenericHashKey{make([]byte, cryptoGenericHashKeyBytes)}
+	Randomize(&key)
+	prefix := bytes.Repeat([]byte("header"), 50)
+
+	h := NewGenericHashKeyed(32, key).(*GenericHash)
+	h.Write(prefix)
+	c := h.Clone()
+	h.Write([]byte("body one"))
+	c.Write([]byte("body two"))
+
+	for _, v := range []struct {
+		h    *GenericHash
+		body string
+	}{{h, "body one"}, {c, "body two"}} {
+		fresh := NewGenericHashKeyed(32, key)
+		fresh.Write(prefix)
+		fresh.Write([]byte(v.body))
+		if !bytes.Equal(v.h.Sum(nil), fresh.Sum(nil)) {
+			t.Errorf("%s: cloned digest differs from fresh one", v.body)
+		}
+	}
+
+	if !bytes.Equal(h.Clone().Sum(nil), h.Sum(nil)) {
+		t.Error("clone of a finalized hash differs")
+	}
+}
+
+func TestGenericHashSaveRestore(t *testing.T) {
+	key := GenericHashKey{make([]byte, cryptoGenericHashKeyBytes)}
+	Randomize(&key)
+	data := bytes.Repeat(m, 5)
+
+	for _, keyed := range []bool{false, true} {
+		var h, whole *GenericHash
+		if keyed {
+			h = NewGenericHashKeyed(48, key).(*GenericHash)
+			whole = NewGenericHashKeyed(48, key).(*GenericHash)
+		} else {
+			h = NewGenericHash(48).(*GenericHash)
+			whole = NewGenericHash(48).(*GenericHash)
+		}
+		whole.Write(data)
+
+		// Checkpoint in the middle of a block.
+		h.Write(data[:1000])
+		saved, err := h.Save()
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.Free()
+		resumed, err := RestoreGenericHashState(saved, 48)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resumed.Write(data[1000:])
+		if !bytes.Equal(resumed.Sum(nil), whole.Sum(nil)) {
+			t.Errorf("keyed %v: resumed digest differs", keyed)
+		}
+		if _, err := resumed.Save(); err != ErrInvalidState {
+			t.Errorf("keyed %v: saved after Sum: got %v", keyed, err)
+		}
+	}
+
+	saved, _ := NewGenericHash(32).(*GenericHash).Save()
+	if _, err := RestoreGenericHashState(saved, 64); err != ErrInvalidEncoding {
+		t.Errorf("other length: got %v", err)
+	}
+	for _, l := range []int{0, 4, 10, len(saved) - 1} {
+		if _, err := RestoreGenericHashState(saved[:l], 32); err != ErrInvalidEncoding {
+			t.Errorf("truncated to %d bytes: got %v", l, err)
+		}
+	}
+	for i, want := range map[int]error{0: ErrInvalidEncoding, 4: ErrUnsupportedVersion, 8: ErrUnsupportedVersion} {
+		b := append([]byte{}, saved...)
+		b[i] ^= 1
+		if _, err := RestoreGenericHashState(b, 32); err != want {
+			t.Errorf("byte %d changed: got %v, want %v", i, err, want)
+		}
+	}
+}
+
+func ExampleSecretStreamXCPEncoder_WriteWithAD() {
+	key := MakeSecretStreamXCPKey()
+	var buf bytes.Buffer
+	encoder := MakeSecretStreamXCPEncoder(key, &buf).(*SecretStreamXCPEncoder)
+	encoder.SetAdditionData([]byte("stream"))
+	for i := byte(0); i < 3; i++ {
+		encoder.WriteWithAD([]byte("chunk"), []byte{i})
+	}
+	encoder.Write([]byte("plain"))
+	stream := append([]byte{}, buf.Bytes()...)
+
+	d, _ := MakeSecretStreamXCPDecoder(key, &buf, encoder.Header())
+	decoder := d.(*SecretStreamXCPDecoder)
+	decoder.SetAdditionData([]byte("stream"))
+	chunk := make([]byte, 5)
+	for i := byte(0); i < 3; i++ {
+		n, err := decoder.ReadWithAD(chunk, []byte{i})
+		fmt.Println(string(chunk[:n]), err)
+	}
+	n, err := decoder.Read(chunk)
+	fmt.Println(string(chunk[:n]), err)
+
+	d, _ = MakeSecretStreamXCPDecoder(key, bytes.NewReader(stream), encoder.Header())
+	_, err = d.(*SecretStreamXCPDecoder).ReadWithAD(chunk, []byte{1})
+	fmt.Println(err)
+	//Output: chunk <nil>
+	//chunk <nil>
+	//chunk <nil>
+	//plain <nil>
+	//sodium: Can't decrypt stream
+}
+
+func ExampleSodiumError() {
+	var err error = &SodiumError{"crypto_secretstream_xchacha20poly1305_push", -1}
+	fmt.Println(err)
+	fmt.Println(errors.Is(err, ErrUnknown), errors.Is(err, ErrDecryptSS))
+
+	var serr *SodiumError
+	fmt.Println(errors.As(fmt.Errorf("write: %w", err), &serr), serr.Func)
+	//Output: sodium: crypto_secretstream_xchacha20poly1305_push returned -1
+	//true false
+	//true crypto_secretstream_xchacha20poly1305_push
+}
+
+func ExampleCheckLibrary() {
+	fmt.Println(CheckLibrary())
+	//Output: <nil>
+}
+
+func TestSecretStreamEncoderReset(t *testing.T) {
+	key1, key2 := MakeSecretStreamXCPKey(), MakeSecretStreamXCPKey()
+	var buf1, buf2 bytes.Buffer
+
+	encoder := MakeSecretStreamXCPEncoderWithHeader(key1, &buf1).(*SecretStreamXCPEncoder)
+	encoder.SetAdditionData([]byte("first"))
+	encoder.WriteAndClose([]byte("stream one"))
+	header1 := encoder.Header()
+
+	if err := encoder.Reset(SecretStreamXCPKey{key2.Bytes[:16]}, &buf2); err != ErrInvalidKey {
+		t.Fatalf("got %v, want ErrInvalidKey", err)
+	}
+	if err := encoder.Reset(key2, &buf2); err != nil {
+		t.Fatal(err)
+	}
+	if encoder.Header().Equal(header1.Bytes) {
+		t.Error("header not renewed")
+	}
+	encoder.WriteAndClose([]byte("stream two"))
+
+	for _, v := range []struct {
+		key SecretStreamXCPKey
+		buf *bytes.Buffer
+		ad  []byte
+		m   string
+	}{{key1, &buf1, []byte("first"), "stream one"}, {key2, &buf2, nil, "stream two"}} {
+		decoder, err := MakeSecretStreamXCPDecoderAutoHeader(v.key, v.buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoder.SetAdditionData(v.ad)
+		b := make([]byte, len(v.m))
+		if n, err := decoder.Read(b); err != io.EOF || string(b[:n]) != v.m {
+			t.Errorf("got %q, %v", b[:n], err)
+		}
+	}
+}
+
+func TestGenericHashSecure(t *testing.T) {
+	if GenericHashStateBytes() < int(unsafe.Sizeof(*new(GenericHash).state)) {
+		t.Errorf("GenericHashStateBytes() = %d", GenericHashStateBytes())
+	}
+
+	key := GenericHashKey{make([]byte, cryptoGenericHashKeyBytes)}
+	Randomize(&key)
+	h := NewGenericHashKeyed(64, key)
+	s := NewGenericHashKeyedSecure(64, key)
+	defer s.Free()
+	h.Write(m)
+	s.Write(m)
+	c := s.Clone()
+	defer c.Free()
+	want := h.Sum(nil)
+	if !bytes.Equal(s.Sum(nil), want) || !bytes.Equal(c.Sum(nil), want) {
+		t.Error("secure digest differs")
+	}
+
+	u := NewGenericHashSecure(32)
+	u.Write(m)
+	f := NewGenericHash(32)
+	f.Write(m)
+	if !bytes.Equal(u.Sum(nil), f.Sum(nil)) {
+		t.Error("unkeyed secure digest differs")
+	}
+	u.Free()
+	u.Free()
+}
+
+func ExampleSecretStreamXCPDecoder_PeekTag() {
+	key := MakeSecretStreamXCPKey()
+	var buf bytes.Buffer
+	encoder := MakeSecretStreamXCPEncoder(key, &buf)
+	encoder.Write([]byte("data"))
+	encoder.SetTag(SecretStreamTag_Push)
+	encoder.Write([]byte("ctrl"))
+	encoder.Close()
+
+	d, _ := MakeSecretStreamXCPDecoder(key, &buf, encoder.Header(), ReadBufferSize(4))
+	decoder := d.(*SecretStreamXCPDecoder)
+	for {
+		tag, err := decoder.PeekTag()
+		if err != nil {
+			fmt.Println(err)
+			break
+		}
+		b := make([]byte, 4)
+		n, _ := decoder.Read(b)
+		fmt.Printf("%v %v %q\n", tag == SecretStreamTag_Push, tag == SecretStreamTag_Final, b[:n])
+	}
+
+	unbuffered, _ := MakeSecretStreamXCPDecoder(key, &buf, encoder.Header())
+	_, err := unbuffered.(*SecretStreamXCPDecoder).PeekTag()
+	fmt.Println(err)
+	//Output: false false "data"
+	//true false "ctrl"
+	//false true ""
+	//EOF
+	//sodium: Invalid state
+}
+
+func TestBoxSession(t *testing.T) {
+	alice, bob := MakeBoxKP(), MakeBoxKP()
+	as, err := NewBoxSession(bob.PublicKey, alice.SecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, _ := NewBoxSession(alice.PublicKey, bob.SecretKey)
+
+	c1 := as.Encrypt(Bytes("one"))
+	c2 := as.Encrypt(Bytes("two"))
+	r1 := bs.Encrypt(Bytes("one"))
+	if c1.Length() != 8+3+BoxOverhead() {
+		t.Errorf("got %d bytes", c1.Length())
+	}
+	if bytes.Equal(c1[8:], r1[8:]) {
+		t.Error("both directions use the same nonce")
+	}
+
+	if _, err := bs.Decrypt(c2); err != ErrReplay {
+		t.Errorf("out of order: got %v, want ErrReplay", err)
+	}
+	if m, err := bs.Decrypt(c1); err != nil || string(m) != "one" {
+		t.Errorf("got %q, %v", m, err)
+	}
+	if _, err := bs.Decrypt(c1); err != ErrReplay {
+		t.Errorf("replay: got %v, want ErrReplay", err)
+	}
+
+	forged := append(Bytes{}, c2...)
+	forged[len(forged)-1] ^= 1
+	if _, err := bs.Decrypt(forged); err != ErrOpenBox {
+		t.Errorf("forged: got %v, want ErrOpenBox", err)
+	}
+	// A message must not be skipped either.
+	binary.BigEndian.PutUint64(r1, 1)
+	if _, err := as.Decrypt(r1); err != ErrReplay {
+		t.Errorf("skipped: got %v, want ErrReplay", err)
+	}
+	if m, err := bs.Decrypt(c2); err != nil || string(m) != "two" {
+		t.Errorf("got %q, %v", m, err)
+	}
+
+	if _, err := as.Decrypt(c1[:10]); err != ErrOpenBox {
+		t.Errorf("short: got %v, want ErrOpenBox", err)
+	}
+}
+
+func TestBoxPublicKeyIsWeak(t *testing.T) {
+	defer SetStrictMode(false)
+	sk := MakeBoxKP().SecretKey
+	for i, w := range boxWeakPublicKeys {
+		for _, top := range []byte{0, 0x80} {
+			pk := BoxPublicKey{append(Bytes{}, w[:]...)}
+			pk.Bytes[31] |= top
+			if !pk.IsWeak() {
+				t.Errorf("point %d, top bit %#x: not weak", i, top)
+			}
+			for _, strict := range []bool{false, true} {
+				SetStrictMode(strict)
+				if _, err := CryptoBoxBeforeNM(pk, sk); err != ErrInvalidKey {
+					t.Errorf("point %d, top bit %#x, strict %v: got %v, want ErrInvalidKey", i, top, strict, err)
+				}
+			}
+			SetStrictMode(false)
+
+			pk.Bytes[3] ^= 1
+			if pk.IsWeak() {
+				t.Errorf("point %d with a flipped bit: weak", i)
+			}
+		}
+	}
+
+	pk := MakeBoxKP().PublicKey
+	if pk.IsWeak() {
+		t.Error("random key: weak")
+	}
+	k1, err := CryptoBoxBeforeNM(pk, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewBoxSession(pk, sk); err != nil {
+		t.Fatal(err)
+	}
+	if k1.Length() != cryptoBoxBeforeNmBytes {
+		t.Errorf("got %d bytes", k1.Length())
+	}
+}
+
+func ExampleGenerateRecoveryKey() {
+	key, mnemonic := GenerateRecoveryKey()
+	fmt.Println(len(mnemonic), strings.Count(mnemonic, "-"))
+
+	parsed, err := ParseRecoveryKey(strings.ToLower(strings.ReplaceAll(mnemonic, "-", " ")))
+	fmt.Println(parsed.Equal(key.Bytes), err)
+
+	typo := []byte(mnemonic)
+	if typo[0] == 'A' {
+		typo[0] = 'B'
+	} else {
+		typo[0] = 'A'
+	}
+	_, err = ParseRecoveryKey(string(typo))
+	fmt.Println(err)
+
+	_, err = ParseRecoveryKey(mnemonic[:20])
+	fmt.Println(err)
+	//Output: 72 14
+	//true <nil>
+	//sodium: Invalid checksum
+	//sodium: Invalid encoding
+}
+
+func ExampleBytes_SealEnvelopeWithAD() {
+	key := MakeSecretStreamXCPKey()
+	c := Bytes("content").SealEnvelopeWithAD(key, Bytes("report.txt"))
+
+	md, err := c.OpenEnvelopeWithAD(key, Bytes("report.txt"))
+	fmt.Println(string(md), err)
+	_, err = c.OpenEnvelopeWithAD(key, Bytes("other.txt"))
+	fmt.Println(err)
+	_, err = c.OpenEnvelope(key)
+	fmt.Println(err)
+
+	md, err = Bytes("content").SealEnvelope(key).OpenEnvelopeWithAD(key, nil)
+	fmt.Println(string(md), err)
+	//Output: content <nil>
+	//sodium: Can't decrypt stream
+	//sodium: Can't decrypt stream
+	//content <nil>
+}
+
+func BenchmarkSecretStreamChunkSize(b *testing.B) {
+	key := MakeSecretStreamXCPKey()
+	m := make([]byte, 4<<20)
+	for _, size := range []int{256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20} {
+		b.Run(fmt.Sprintf("encode/%d", size), func(b *testing.B) {
+			b.SetBytes(int64(len(m)))
+			for i := 0; i < b.N; i++ {
+				encoder := MakeSecretStreamXCPEncoder(key, io.Discard)
+				for off := 0; off < len(m); off += size {
+					encoder.Write(m[off : off+size])
+				}
+				encoder.Close()
+			}
+		})
+
+		var buf bytes.Buffer
+		encoder := MakeSecretStreamXCPEncoder(key, &buf)
+		for off := 0; off < len(m); off += size {
+			encoder.Write(m[off : off+size])
+		}
+		encoder.Close()
+		stream := buf.Bytes()
+		b.Run(fmt.Sprintf("decode/%d", size), func(b *testing.B) {
+			b.SetBytes(int64(len(m)))
+			for i := 0; i < b.N; i++ {
+				decoder, _ := MakeSecretStreamXCPDecoder(key, bytes.NewReader(stream), encoder.Header(), ReadBufferSize(size))
+				io.Copy(io.Discard, decoder)
+			}
+		})
+	}
+}
+
+func ExampleBytes_Redacted() {
+	key := SecretStreamXCPKey{make([]byte, 32)}
+	fmt.Println(key.Bytes.Redacted())
+	fmt.Println(key)
+	fmt.Printf("%+v\n", struct{ Key SecretBoxKey }{SecretBoxKey{key.Bytes}})
+	fmt.Println(strings.Contains(fmt.Sprintf("%x", key), key.Hex()))
+	//Output: Bytes(32 bytes, blake2b:ff0f2249)
+	//SecretStreamXCPKey(32 bytes, blake2b:ff0f2249)
+	//{Key:SecretBoxKey(32 bytes, blake2b:ff0f2249)}
+	//false
+}
+
+func ExampleSecretStreamXCPDecoder_Next() {
+	key := MakeSecretStreamXCPKey()
+	var buf bytes.Buffer
+	for _, segment := range []string{"first segment", "second"} {
+		encoder := MakeSecretStreamXCPEncoderWithHeader(key, &buf)
+		encoder.WriteAndClose([]byte(segment))
+	}
+
+	d, _ := MakeSecretStreamXCPDecoderAutoHeader(key, &buf)
+	decoder := d.(*SecretStreamXCPDecoder)
+	fmt.Println(decoder.Next())
+	for _, segment := range []string{"first segment", "second"} {
+		b := make([]byte, len(segment))
+		n, err := decoder.Read(b)
+		fmt.Println(string(b[:n]), err)
+		fmt.Println(decoder.Next())
+	}
+	//Output: sodium: Invalid state
+	//first segment EOF
+	//<nil>
+	//second EOF
+	//EOF
+}
+
+func TestSecretStreamDecoderNextTruncated(t *testing.T) {
+	key := MakeSecretStreamXCPKey()
+	var buf bytes.Buffer
+	encoder := MakeSecretStreamXCPEncoderWithHeader(key, &buf)
+	encoder.Close()
+	buf.Write(make([]byte, 10))
+
+	decoder, _ := MakeSecretStreamXCPDecoderAutoHeader(key, &buf)
+	if err := decoder.(*SecretStreamXCPDecoder).ReadEmptyChunk(); err != io.EOF {
+		t.Fatalf("got %v, want io.EOF", err)
+	}
+	if err := decoder.(*SecretStreamXCPDecoder).Next(); err != ErrInvalidHeader {
+		t.Errorf("got %v, want ErrInvalidHeader", err)
+	}
+}
+
+func TestKXSessionKeysWithPSK(t *testing.T) {
+	client, server := MakeKXKP(), MakeKXKP()
+	psk := bytes.Repeat([]byte{7}, 32)
+
+	ck, err := client.ClientSessionKeysWithPSK(server.PublicKey, psk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk, _ := server.ServerSessionKeysWithPSK(client.PublicKey, psk)
+	if !ck.Tx.Equal(sk.Rx.Bytes) || !ck.Rx.Equal(sk.Tx.Bytes) {
+		t.Error("keys don't match with the same psk")
+	}
+
+	plain, _ := client.ClientSessionKeys(server.PublicKey)
+	if ck.Tx.Equal(plain.Tx.Bytes) || ck.Rx.Equal(plain.Rx.Bytes) {
+		t.Error("psk not mixed")
+	}
+
+	wrong, _ := server.ServerSessionKeysWithPSK(client.PublicKey, bytes.Repeat([]byte{8}, 32))
+	if ck.Tx.Equal(wrong.Rx.Bytes) || ck.Rx.Equal(wrong.Tx.Bytes) {
+		t.Error("keys match with a wrong psk")
+	}
+}
+
+func TestEncodingMatchesStdlib(t *testing.T) {
+	variants := map[Base64Variant]*base64.Encoding{
+		Base64Variant_Original:          base64.StdEncoding,
+		Base64Variant_OriginalNoPadding: base64.RawStdEncoding,
+		Base64Variant_URLSafe:           base64.URLEncoding,
+		Base64Variant_URLSafeNoPadding:  base64.RawURLEncoding,
+	}
+	for l := 0; l < 70; l++ {
+		b := make(Bytes, l)
+		rand.Read(b)
+
+		if got, want := b.Hex(), hex.EncodeToString(b); got != want {
+			t.Errorf("Hex(%x) = %s, want %s", []byte(b), got, want)
+		}
+		if d, err := ParseHex(b.Hex()); err != nil || !bytes.Equal(d, b) {
+			t.Errorf("ParseHex(%s) = %x, %v", b.Hex(), []byte(d), err)
+		}
+		if got := HexEncodedLen(l); got != hex.EncodedLen(l)+1 {
+			t.Errorf("HexEncodedLen(%d) = %d", l, got)
+		}
+		for v, enc := range variants {
+			got, want := b.Base64(v), enc.EncodeToString(b)
+			if got != want {
+				t.Errorf("Base64(%x, %d) = %s, want %s", []byte(b), v, got, want)
+			}
+			if n := Base64EncodedLen(l, v); n != enc.EncodedLen(l)+1 {
+				t.Errorf("Base64EncodedLen(%d, %d) = %d, want %d", l, v, n, enc.EncodedLen(l)+1)
+			}
+			if d, err := ParseBase64(want, v); err != nil || !bytes.Equal(d, b) {
+				t.Errorf("ParseBase64(%s, %d) = %x, %v", want, v, []byte(d), err)
+			}
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("unknown variant: didn't panic")
+		}
+	}()
+	Base64EncodedLen(8, Base64Variant(2))
+}
+
+func TestParseBase64UnknownVariant(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("didn't panic")
+		}
+	}()
+	ParseBase64("aGVsbG8=", Base64Variant(42))
+}
+
+func TestKeyFileGolden(t *testing.T) {
+	golden, err := os.ReadFile("testdata/keyfile_v1.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := SecretStreamXCPKey{make([]byte, 32)}
+	for i := range key.Bytes {
+		key.Bytes[i] = byte(i)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteKeyFile(&buf, &key); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), golden) {
+		t.Errorf("got %x, want %x", buf.Bytes(), golden)
+	}
+
+	k, err := ReadKeyFile(bytes.NewReader(golden))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := k.(*SecretStreamXCPKey); !ok || !got.Equal(key.Bytes) {
+		t.Errorf("got %T %v", k, k)
+	}
+
+	for i := range golden {
+		tampered := append([]byte{}, golden...)
+		tampered[i] ^= 1
+		if _, err := ReadKeyFile(bytes.NewReader(tampered)); err == nil {
+			t.Errorf("tampered byte %d: read", i)
+		}
+	}
+	if _, err := ReadKeyFile(bytes.NewReader(golden[:len(golden)-1])); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated: got %v", err)
+	}
+}
+
+func TestKeyFileTypes(t *testing.T) {
+	box := MakeBoxKP()
+	sign := MakeSignKP()
+	keys := []Typed{
+		&box.PublicKey,
+		&box.SecretKey,
+		&sign.PublicKey,
+		&sign.SecretKey,
+		&GenericHashKey{Bytes(make([]byte, 16))},
+		&SubKey{Bytes(make([]byte, 64))},
+	}
+	for _, key := range keys {
+		var buf bytes.Buffer
+		if err := WriteKeyFile(&buf, key); err != nil {
+			t.Fatalf("%T: %v", key, err)
+		}
+		k, err := ReadKeyFile(&buf)
+		if err != nil {
+			t.Fatalf("%T: %v", key, err)
+		}
+		if fmt.Sprintf("%T", k) != fmt.Sprintf("%T", key) || !k.(typedBytes).bytes().Equal(key.(typedBytes).bytes()) {
+			t.Errorf("%T: got %T", key, k)
+		}
+	}
+
+	if err := WriteKeyFile(new(bytes.Buffer), &Scalar{}); err != ErrUnsupportedAlgorithm {
+		t.Errorf("Scalar: got %v", err)
+	}
+}
+
+func TestRotateSecretStream(t *testing.T) {
+	oldKey := MakeSecretStreamXCPKey()
+	newKey := MakeSecretStreamXCPKey()
+	m := make([]byte, 2*SecretStreamChunkBytes+100)
+	rand.Read(m)
+	var buf bytes.Buffer
+	w, _ := NewEncryptingWriter(oldKey, &buf)
+	w.Write(m)
+	w.Close()
+	hl := cryptoSecretStreamXChaCha20Poly1305HeaderBytes
+	oldHeader := SecretStreamXCPHeader{buf.Bytes()[:hl]}
+	c := buf.Bytes()[hl:]
+
+	var rotated bytes.Buffer
+	newHeader, err := RotateSecretStream(oldKey, newKey, bytes.NewReader(c), oldHeader, &rotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.Len() != len(c) {
+		t.Errorf("rotated length: got %d, want %d", rotated.Len(), len(c))
+	}
+	r, err := NewDecryptingReader(newKey, io.MultiReader(bytes.NewReader(newHeader.Bytes), bytes.NewReader(rotated.Bytes())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, m) {
+		t.Error("rotated stream doesn't decrypt to the plain text")
+	}
+	if err := VerifySecretStream(oldKey, bytes.NewReader(rotated.Bytes()), newHeader); err != ErrDecryptSS {
+		t.Errorf("old key: got %v", err)
+	}
+
+	tampered := append([]byte{}, c...)
+	tampered[SecretStreamChunkBytes+50] ^= 1
+	if _, err := RotateSecretStream(oldKey, newKey, bytes.NewReader(tampered), oldHeader, io.Discard); err != ErrDecryptSS {
+		t.Errorf("tampered: got %v", err)
+	}
+	if _, err := RotateSecretStream(newKey, newKey, bytes.NewReader(c), oldHeader, io.Discard); err != ErrDecryptSS {
+		t.Errorf("wrong key: got %v", err)
+	}
+	broken := errors.New("broken")
+	in := io.MultiReader(bytes.NewReader(c[:10]), iotest.ErrReader(broken))
+	if _, err := RotateSecretStream(oldKey, newKey, in, oldHeader, io.Discard); err != broken {
+		t.Errorf("reader error: got %v", err)
+	}
+
+	var tagged bytes.Buffer
+	e := MakeSecretStreamXCPEncoder(oldKey, &tagged).(*SecretStreamXCPEncoder)
+	e.SetTag(SecretStreamTag_Push)
+	e.Write([]byte("pushed chunk 123"))
+	e.SetTag(SecretStreamTag_Message)
+	e.Rekey()
+	e.Write([]byte("rekeyed chunk 45"))
+	e.Write([]byte("plain chunk 6789"))
+	e.WriteAndClose([]byte("final"))
+	rotated.Reset()
+	newHeader, err = RotateSecretStream(oldKey, newKey, &tagged, e.Header(), &rotated, ReadBufferSize(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := MakeSecretStreamXCPDecoder(newKey, &rotated, newHeader, ReadBufferSize(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 16)
+	for _, want := range []SecretStreamTag{SecretStreamTag_Push, SecretStreamTag_Rekey, SecretStreamTag_Message, SecretStreamTag_Final} {
+		if _, err := d.Read(b); err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+		if d.Tag() != want {
+			t.Errorf("rotated tag: got %v, want %v", d.Tag(), want)
+		}
+	}
+}
+
+func TestVerifySecretStream(t *testing.T) {
+	key := MakeSecretStreamXCPKey()
+	var buf bytes.Buffer
+	w, _ := NewEncryptingWriter(key, &buf)
+	w.Write(make([]byte, 2*SecretStreamChunkBytes+100))
+	w.Close()
+	hl := cryptoSecretStreamXChaCha20Poly1305HeaderBytes
+	header := SecretStreamXCPHeader{buf.Bytes()[:hl]}
+	c := buf.Bytes()[hl:]
+
+	if err := VerifySecretStream(key, bytes.NewReader(c), header); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySecretStream(key, iotest.OneByteReader(bytes.NewReader(c)), header); err != nil {
+		t.Fatalf("one byte reader: %v", err)
+	}
+
+	tampered := append([]byte{}, c...)
+	tampered[SecretStreamChunkBytes+50] ^= 1
+	if err := VerifySecretStream(key, bytes.NewReader(tampered), header); err != ErrDecryptSS {
+		t.Errorf("tampered: got %v", err)
+	}
+	chunk := SecretStreamChunkBytes + cryptoSecretStreamXChaCha20Poly1305ABytes
+	if err := VerifySecretStream(key, bytes.NewReader(c[:2*chunk]), header); err != ErrDecryptSS {
+		t.Errorf("truncated: got %v", err)
+	}
+	if err := VerifySecretStream(key, bytes.NewReader(append(c[:len(c):len(c)], 0)), header); err != ErrDecryptSS {
+		t.Errorf("trailing data: got %v", err)
+	}
+	if err := VerifySecretStream(MakeSecretStreamXCPKey(), bytes.NewReader(c), header); err != ErrDecryptSS {
+		t.Errorf("wrong key: got %v", err)
+	}
+	broken := errors.New("broken")
+	in := io.MultiReader(bytes.NewReader(c[:chunk+10]), iotest.ErrReader(broken))
+	if err := VerifySecretStream(key, in, header); err != broken {
+		t.Errorf("reader error: got %v", err)
+	}
+}
+
+func ExampleDeterministicID() {
+	fmt.Println(DeterministicID([]byte("sodium"), 16))
+	fmt.Println(DeterministicIDKeyed([]byte("sodium"), 9, GenericHashKey{make([]byte, 16)}))
+	//Output: zQDgNNNz8rTXQaX249t3wg
+	//Zb72ZbHjZ7IK
+}
+
+func TestSecretStreamDecoderSmallReads(t *testing.T) {
+	key := MakeSecretStreamXCPKey()
+	plain := make([]byte, 3*1000+123)
+	rand.Read(plain)
+	var buf bytes.Buffer
+	encoder := MakeSecretStreamXCPEncoder(key, &buf)
+	for i := 0; i < 3; i++ {
+		encoder.Write(plain[i*1000 : (i+1)*1000])
+	}
+	encoder.WriteAndClose(plain[3000:])
+
+	for _, size := range []int{1, 7, 999, 1000, 1001, 4096} {
+		decoder, _ := MakeSecretStreamXCPDecoder(key, iotest.OneByteReader(bytes.NewReader(buf.Bytes())), encoder.Header(), ReadBufferSize(1000))
+		var got []byte
+		b := make([]byte, size)
+		var err error
+		for err == nil {
+			var n int
+			n, err = decoder.Read(b)
+			if n > len(b) {
+				t.Fatalf("size %d: n = %d", size, n)
+			}
+			got = append(got, b[:n]...)
+		}
+		if err != io.EOF || !bytes.Equal(got, plain) {
+			t.Errorf("size %d: got %d bytes, %v", size, len(got), err)
+		}
+	}
+
+	decoder, _ := MakeSecretStreamXCPDecoder(key, bytes.NewReader(buf.Bytes()), encoder.Header(), ReadBufferSize(1000))
+	var out bytes.Buffer
+	if n, err := io.Copy(&out, iotest.HalfReader(decoder)); err != nil || n != int64(len(plain)) || !bytes.Equal(out.Bytes(), plain) {
+		t.Errorf("io.Copy: got %d, %v", n, err)
+	}
+}
+
+func TestCryptoScalarmultBaseBatch(t *testing.T) {
+	ns := benchmarkScalars(10)
+	qs := CryptoScalarmultBaseBatch(ns)
+	if len(qs) != len(ns) {
+		t.Fatalf("got %d results", len(qs))
+	}
+	for i := range ns {
+		if !qs[i].Equal(CryptoScalarmultBase(ns[i]).Bytes) {
+			t.Errorf("scalar %d: results differ", i)
+		}
+	}
+	if CryptoScalarmultBaseBatch(nil) != nil {
+		t.Error("empty batch: got results")
+	}
+}
+
+func benchmarkScalars(n int) []Scalar {
+	ns := make([]Scalar, n)
+	for i := range ns {
+		ns[i] = Scalar{make([]byte, 32)}
+		Randomize(&ns[i])
+	}
+	return ns
+}
+
+func BenchmarkCryptoScalarmultBase(b *testing.B) {
+	ns := benchmarkScalars(1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, n := range ns {
+			CryptoScalarmultBase(n)
+		}
+	}
+}
+
+func BenchmarkCryptoScalarmultBaseBatch(b *testing.B) {
+	ns := benchmarkScalars(1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		CryptoScalarmultBaseBatch(ns)
+	}
+}
+
+func TestStrictMode(t *testing.T) {
+	SetStrictMode(true)
+	defer SetStrictMode(false)
+	if !StrictMode() {
+		t.Fatal("strict mode not on")
+	}
+
+	panics := func(name string, f func()) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Errorf("%s: didn't panic", name)
+			}
+		}()
+		f()
+	}
+	zeroKey := SecretBoxKey{make([]byte, cryptoSecretBoxKeyBytes)}
+	zeroNonce := SecretBoxNonce{make([]byte, cryptoSecretBoxNonceBytes)}
+	key := SecretBoxKey{}
+	Randomize(&key)
+	nonce := SecretBoxNonce{}
+	Randomize(&nonce)
+
+	panics("zero key", func() { m.SecretBox(nonce, zeroKey) })
+	panics("zero nonce", func() { m.SecretBox(zeroNonce, key) })
+	panics("zero secret stream key", func() {
+		MakeSecretStreamXCPEncoder(SecretStreamXCPKey{make([]byte, 32)}, io.Discard)
+	})
+
+	c := m.SecretBox(nonce, key)
+	if _, err := c.SecretBoxOpen(nonce, key); err != nil {
+		t.Errorf("valid box: %v", err)
+	}
+	if _, err := c[:cryptoSecretBoxMacBytes-1].SecretBoxOpen(nonce, key); err != ErrOpenBox {
+		t.Errorf("short box: got %v", err)
+	}
+	xk := MakeAEADXCPKey()
+	if _, err := Bytes("short").AEADXCPDecrypt(nil, AEADXCPNonce{make([]byte, 24)}, xk); err != ErrDecryptAEAD {
+		t.Errorf("short AEAD: got %v", err)
+	}
+
+	SetStrictMode(false)
+	m.SecretBox(zeroNonce, zeroKey)
+}
+
+func TestShortCipherTexts(t *testing.T) {
+	short := Bytes("short")
+	sn := SecretBoxNonce{}
+	Randomize(&sn)
+	sk := SecretBoxKey{}
+	Randomize(&sk)
+	if _, err := short.SecretBoxOpen(sn, sk); err != ErrOpenBox {
+		t.Errorf("SecretBoxOpen: got %v", err)
+	}
+	bn := BoxNonce{}
+	Randomize(&bn)
+	kp := MakeBoxKP()
+	if _, err := short.BoxOpen(bn, kp.PublicKey, kp.SecretKey); err != ErrOpenBox {
+		t.Errorf("BoxOpen: got %v", err)
+	}
+	if _, err := short.SealedBoxOpen(kp); err != ErrOpenBox {
+		t.Errorf("SealedBoxOpen: got %v", err)
+	}
+	if _, err := short.SignOpen(MakeSignKP().PublicKey); err != ErrOpenSign {
+		t.Errorf("SignOpen: got %v", err)
+	}
+	cn := AEADCPNonce{}
+	Randomize(&cn)
+	if _, err := short.AEADCPDecrypt(nil, cn, MakeAEADCPKey()); err != ErrDecryptAEAD {
+		t.Errorf("AEADCPDecrypt: got %v", err)
+	}
+	xn := AEADXCPNonce{}
+	Randomize(&xn)
+	if _, err := short.AEADXCPDecrypt(nil, xn, MakeAEADXCPKey()); err != ErrDecryptAEAD {
+		t.Errorf("AEADXCPDecrypt: got %v", err)
+	}
+}
+
+func TestSealedBoxWithKP(t *testing.T) {
+	rkp := MakeBoxKP()
+	ephemeral := MakeBoxKP()
+
+	c1 := Bytes("first").SealedBoxWithKP(rkp.PublicKey, ephemeral)
+	c2 := Bytes("first").SealedBoxWithKP(rkp.PublicKey, ephemeral)
+	if bytes.Equal(c1, c2) {
+		t.Error("same box for two messages")
+	}
+	for _, c := range []Bytes{c1, c2} {
+		m, epk, err := c.SealedBoxWithKPOpen(rkp)
+		if err != nil || string(m) != "first" || !epk.Equal(ephemeral.PublicKey.Bytes) {
+			t.Errorf("got %q, %v", m, err)
+		}
+	}
+
+	if _, _, err := c1.SealedBoxWithKPOpen(MakeBoxKP()); err != ErrOpenBox {
+		t.Errorf("wrong receiver: got %v", err)
+	}
+	c1[len(c1)-1] ^= 1
+	if _, _, err := c1.SealedBoxWithKPOpen(rkp); err != ErrOpenBox {
+		t.Errorf("tampered: got %v", err)
+	}
+	if _, _, err := c1[:cryptoBoxPublicKeyBytes].SealedBoxWithKPOpen(rkp); err != ErrOpenBox {
+		t.Errorf("short: got %v", err)
+	}
+}
+
+func TestPlaintextHashingEncoder(t *testing.T) {
+	key := MakeSecretStreamXCPKey()
+	var buf bytes.Buffer
+	encoder := NewPlaintextHashingEncoder(MakeSecretStreamXCPEncoder(key, &buf))
+	encoder.Write([]byte("first "))
+	encoder.WriteWithAD([]byte("second "), []byte("ad"))
+	if encoder.PlaintextHash() != nil {
+		t.Error("hash before close")
+	}
+	encoder.WriteAndClose([]byte("last"))
+
+	h := NewGenericHashDefault()
+	h.Write([]byte("first second last"))
+	if want := Bytes(h.Sum(nil)); !encoder.PlaintextHash().Equal(want) {
+		t.Errorf("got %s, want %s", encoder.PlaintextHash().Hex(), want.Hex())
+	}
+
+	decoder, _ := MakeSecretStreamXCPDecoder(key, &buf, encoder.Header())
+	b := make([]byte, 6)
+	if _, err := decoder.Read(b); err != nil || string(b) != "first " {
+		t.Errorf("got %q, %v", b, err)
+	}
+}
+
+func TestReadFullMessage(t *testing.T) {
+	key := MakeSecretStreamXCPKey()
+	var buf bytes.Buffer
+	encoder := MakeSecretStreamXCPEncoder(key, &buf)
+	encoder.Write(bytes.Repeat([]byte("a"), 100))
+	encoder.Write(bytes.Repeat([]byte("b"), 100))
+	encoder.WriteAndClose([]byte("end"))
+	stream := buf.Bytes()
+	chunk := 100 + cryptoSecretStreamXChaCha20Poly1305ABytes
+
+	read := func(s []byte, opts ...SecretStreamDecoderOption) ([]byte, error) {
+		decoder, _ := MakeSecretStreamXCPDecoder(key, iotest.HalfReader(bytes.NewReader(s)), encoder.Header(), opts...)
+		return ReadFullMessage(decoder)
+	}
+	m, err := read(stream, ReadBufferSize(100))
+	if err != nil || len(m) != 203 || string(m[200:]) != "end" {
+		t.Errorf("got %d bytes, %v", len(m), err)
+	}
+
+	for _, l := range []int{0, chunk, 2 * chunk} {
+		if m, err := read(stream[:l], ReadBufferSize(100)); err != ErrTruncatedStream || m != nil {
+			t.Errorf("truncated at %d: got %d bytes, %v", l, len(m), err)
+		}
+	}
+	// a chunk cut short can't be told apart from a tampered one
+	for _, l := range []int{2*chunk + 5, len(stream) - 1} {
+		if m, err := read(stream[:l], ReadBufferSize(100)); err != ErrDecryptSS || m != nil {
+			t.Errorf("cut at %d: got %d bytes, %v", l, len(m), err)
+		}
+	}
+
+	for _, i := range []int{chunk + 1, len(stream) - 1} {
+		tampered := append([]byte{}, stream...)
+		tampered[i] ^= 1
+		if m, err := read(tampered, ReadBufferSize(100)); err != ErrDecryptSS || m != nil {
+			t.Errorf("tampered at %d: got %d bytes, %v", i, len(m), err)
+		}
+	}
+	if _, err := read(stream); err != ErrInvalidState {
+		t.Errorf("without ReadBufferSize: got %v", err)
+	}
+}
+
+func TestRandomBytesClose(t *testing.T) {
+	RandomBytesClose()
+	k1, k2 := MakeAEADXCPKey(), MakeAEADXCPKey()
+	if k1.Equal(k2.Bytes) {
+		t.Error("same keys after closing the generator")
+	}
+}
+
+func TestCryptoGenericHash512(t *testing.T) {
+	key := make([]byte, 16)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	for _, v := range []struct {
+		key  []byte
+		want string
+	}{
+		{nil, "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923"},
+		{key, "4c76bc7ad0fc52e4bde231b38727c331172cfe3eeaf10cd2fa5c65abbdb8faeaad2da338531b382ac103f10ccaf41f74d8870d016c48b269c0d9a5cf5752c8c3"},
+	} {
+		if got := CryptoGenericHash512([]byte("abc"), v.key).Hex(); got != v.want {
+			t.Errorf("key %x: got %s, want %s", v.key, got, v.want)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("short key: didn't panic")
+		}
+	}()
+	CryptoGenericHash512([]byte("abc"), make([]byte, 8))
+}
+
+func TestSecretStreamSetTagFinal(t *testing.T) {
+	key := MakeSecretStreamXCPKey()
+	var buf bytes.Buffer
+	encoder := MakeSecretStreamXCPEncoder(key, &buf)
+	encoder.Write([]byte("first"))
+	encoder.SetTag(SecretStreamTag_Final)
+	if _, err := encoder.Write([]byte("last")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := encoder.Write([]byte("more")); err != ErrInvalidState {
+		t.Errorf("write after final: got %v", err)
+	}
+	if _, err := encoder.WriteAndClose([]byte("more")); err != ErrInvalidState {
+		t.Errorf("WriteAndClose after final: got %v", err)
+	}
+
+	decoder, _ := MakeSecretStreamXCPDecoder(key, &buf, encoder.Header())
+	b := make([]byte, 5)
+	decoder.Read(b)
+	if n, err := decoder.Read(b[:4]); n != 4 || err != io.EOF || decoder.Tag() != SecretStreamTag_Final || string(b[:n]) != "last" {
+		t.Errorf("got %q, %v, tag %v", b[:n], err, decoder.Tag())
+	}
+	if buf.Len() != 0 {
+		t.Errorf("%d bytes after the final chunk", buf.Len())
+	}
+}
+
+func TestPWHashContext(t *testing.T) {
+	s, err := PWHashStoreInteractiveContext(context.Background(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PWHashVerifyContext(context.Background(), "test"); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+	if err := s.PWHashVerifyContext(context.Background(), "wrong"); err != ErrPassword {
+		t.Errorf("wrong password: got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := PWHashStoreSensitiveContext(ctx, "test"); err != context.Canceled {
+		t.Errorf("cancelled: got %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := CryptoGenericHashParallelContext(ctx, make([]byte, 1<<26), 1<<20, 1); err != context.DeadlineExceeded {
+		t.Errorf("timeout: got %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("invalid chunk size: expected panic")
+		}
+	}()
+	CryptoGenericHashParallelContext(context.Background(), m, 0, 1)
+}
+
+func TestCryptoPwHash(t *testing.T) {
+	salt := PWHashSalt{make([]byte, cryptoPWHashSaltBytes)}
+	for i := range salt.Bytes {
+		salt.Bytes[i] = byte(i)
+	}
+	want, _ := hex.DecodeString("3fde0023e9c90652edac14784971e4258e084751bce00b5965d995c639b15cff")
+	key, err := CryptoPwHash("password", salt, 32, CryptoPWHashOpsLimitInteractive, CryptoPWHashMemLimitInteractive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, want) {
+		t.Errorf("key: got %x", key)
+	}
+
+	key, err = CryptoPwHashWithTimeout(context.Background(), "password", salt, 32,
+		CryptoPWHashOpsLimitInteractive, CryptoPWHashMemLimitInteractive)
+	if err != nil || !bytes.Equal(key, want) {
+		t.Errorf("with timeout: got %x, %v", key, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := CryptoPwHashWithTimeout(ctx, "password", salt, 32,
+		CryptoPWHashOpsLimitSensitive, CryptoPWHashMemLimitSensitive); err != context.Canceled {
+		t.Errorf("cancelled: got %v", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := CryptoPwHashWithTimeout(ctx, "password", salt, 32,
+		CryptoPWHashOpsLimitInteractive, CryptoPWHashMemLimitInteractive); err != context.DeadlineExceeded {
+		t.Errorf("timeout: got %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("short key: expected panic")
+		}
+	}()
+	CryptoPwHashWithTimeout(context.Background(), "password", salt, 1,
+		CryptoPWHashOpsLimitInteractive, CryptoPWHashMemLimitInteractive)
+}
+
+func TestEqualConstantTime(t *testing.T) {
+	kp := MakeSignKP()
+	sig := m.SignDetached(kp.SecretKey)
+	other := append(Bytes{}, sig.Bytes...)
+	if !sig.Equal(other) {
+		t.Error("signature: equal copies differ")
+	}
+	other[63] ^= 1
+	if sig.Equal(other) || sig.Equal(other[:32]) || sig.Equal(nil) {
+		t.Error("signature: unequal values are equal")
+	}
+
+	key := MACKey{}
+	Randomize(&key)
+	mac := m.Auth(key)
+	if !mac.Equal(m.Auth(key).Bytes) {
+		t.Error("MAC: equal values differ")
+	}
+	if mac.Equal(m[1:].Auth(key).Bytes) || mac.Equal(mac.Bytes[:16]) {
+		t.Error("MAC: unequal values are equal")
+	}
+
+	sk := SecretBoxKey{}
+	Randomize(&sk)
+	n := SecretBoxNonce{}
+	Randomize(&n)
+	_, tag := m.SecretBoxDetached(n, sk)
+	_, tag2 := m.SecretBoxDetached(n, sk)
+	if !tag.Equal(tag2.Bytes) {
+		t.Error("secret box MAC: equal values differ")
+	}
+	tag2.Bytes[0] ^= 1
+	if tag.Equal(tag2.Bytes) {
+		t.Error("secret box MAC: unequal values are equal")
+	}
+
+	for _, size := range []int{8, 16, 32, 64, 100} {
+		a := make(Bytes, size)
+		rand.Read(a)
+		b := append(Bytes{}, a...)
+		if !a.Equal(b) {
+			t.Errorf("%d bytes: equal values differ", size)
+		}
+		b[size-1] ^= 0x80
+		if a.Equal(b) {
+			t.Errorf("%d bytes: unequal values are equal", size)
+		}
+	}
+}
+
+func TestAuthState(t *testing.T) {
+	key := MACKey{}
+	Randomize(&key)
+	msg := make(Bytes, 1000)
+	rand.Read(msg)
+
+	s := MakeAuthState(key)
+	s.Write(msg[:1])
+	s.Write(nil)
+	s.Write(msg[1:600])
+	io.Copy(s, bytes.NewReader(msg[600:]))
+	mac := s.Finalize()
+	if want := msg.Auth(key); !mac.Equal(want.Bytes) {
+		t.Errorf("got %s, want %s", mac.Hex(), want.Hex())
+	}
+	if !s.Finalize().Equal(mac.Bytes) {
+		t.Error("second Finalize differs")
+	}
+	if _, err := s.Write(msg); err != ErrInvalidState {
+		t.Errorf("write after Finalize: got %v", err)
+	}
+
+	s = MakeAuthState(key)
+	s.Write(msg)
+	if err := s.FinalizeVerify(mac); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+	s = MakeAuthState(key)
+	s.Write(msg[1:])
+	if err := s.FinalizeVerify(mac); err != ErrAuth {
+		t.Errorf("verify other message: got %v", err)
+	}
+}
+
+func TestAuthHMACSHA2(t *testing.T) {
+	msg := make(Bytes, 1000)
+	rand.Read(msg)
+
+	k256 := MakeHMACSHA256Key()
+	std := hmac.New(sha256.New, k256.Bytes)
+	std.Write(msg)
+	mac256 := msg.AuthHMACSHA256(k256)
+	if !mac256.Equal(std.Sum(nil)) {
+		t.Errorf("HMAC-SHA-256: got %s", mac256.Hex())
+	}
+	if err := msg.AuthHMACSHA256Verify(mac256, k256); err != nil {
+		t.Errorf("HMAC-SHA-256 verify: %v", err)
+	}
+	if err := msg[1:].AuthHMACSHA256Verify(mac256, k256); err != ErrAuth {
+		t.Errorf("HMAC-SHA-256 verify other message: got %v", err)
+	}
+	s256 := MakeHMACSHA256State(k256)
+	s256.Write(msg[:300])
+	s256.Write(msg[300:])
+	if err := s256.FinalizeVerify(mac256); err != nil {
+		t.Errorf("HMAC-SHA-256 state: %v", err)
+	}
+
+	k512 := MakeHMACSHA512Key()
+	std = hmac.New(sha512.New, k512.Bytes)
+	std.Write(msg)
+	mac512 := msg.AuthHMACSHA512(k512)
+	if mac512.Length() != 64 || !mac512.Equal(std.Sum(nil)) {
+		t.Errorf("HMAC-SHA-512: got %s", mac512.Hex())
+	}
+	if err := msg.AuthHMACSHA512Verify(mac512, k512); err != nil {
+		t.Errorf("HMAC-SHA-512 verify: %v", err)
+	}
+	s512 := MakeHMACSHA512State(k512)
+	s512.Write(msg[:1])
+	s512.Write(msg[1:])
+	if !s512.Finalize().Equal(mac512.Bytes) {
+		t.Error("HMAC-SHA-512 state: MACs differ")
+	}
+}
+
+func ExampleBytes_Pad() {
+	p := Bytes("sodium").Pad(8)
+	fmt.Println(p.Hex())
+	u, err := p.Unpad(8)
+	fmt.Println(string(u), err)
+	_, err = p[:7].Unpad(8)
+	fmt.Println(err)
+	//Output: 736f6469756d8000
+	//sodium <nil>
+	//sodium: Invalid padding
+}
+
+func TestPaddingWriter(t *testing.T) {
+	key := MakeSecretStreamXCPKey()
+	encrypt := func(plain []byte, strategy PaddingStrategy) []byte {
+		var buf bytes.Buffer
+		w, _ := NewEncryptingWriter(key, &buf)
+		pw := NewPaddingWriter(w, strategy)
+		pw.Write(plain)
+		if err := pw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	decrypt := func(c []byte) ([]byte, error) {
+		r, _ := NewDecryptingReader(key, bytes.NewReader(c))
+		return io.ReadAll(NewUnpaddingReader(iotest.OneByteReader(r)))
+	}
+
+	for _, strategy := range []PaddingStrategy{PadToMultiple(1000), PadToPowerOfTwo()} {
+		var lengths []int
+		for _, l := range []int{520, 700, 999} {
+			plain := make([]byte, l)
+			rand.Read(plain)
+			plain[l-1] = 0x80
+			c := encrypt(plain, strategy)
+			lengths = append(lengths, len(c))
+			if got, err := decrypt(c); err != nil || !bytes.Equal(got, plain) {
+				t.Errorf("length %d: got %d bytes, %v", l, len(got), err)
+			}
+		}
+		if lengths[0] != lengths[1] || lengths[1] != lengths[2] {
+			t.Errorf("cipher text lengths differ: %v", lengths)
+		}
+	}
+
+	big := bytes.Repeat([]byte{0x80, 0}, SecretStreamChunkBytes)
+	if got, err := decrypt(encrypt(big, PadToMultiple(16))); err != nil || !bytes.Equal(got, big) {
+		t.Errorf("padding-like plain text: got %d bytes, %v", len(got), err)
+	}
+
+	var buf bytes.Buffer
+	w, _ := NewEncryptingWriter(key, &buf)
+	w.Write([]byte("no padding"))
+	w.Close()
+	if _, err := decrypt(buf.Bytes()); err != ErrInvalidPadding {
+		t.Errorf("unpadded stream: got %v", err)
+	}
+}
+
+func TestAEADNilAndEmptyAD(t *testing.T) {
+	cpKey := MakeAEADCPKey()
+	cpNonce := AEADCPNonce{}
+	Randomize(&cpNonce)
+	xcpKey := MakeAEADXCPKey()
+	xcpNonce := AEADXCPNonce{}
+	Randomize(&xcpNonce)
+
+	for _, c := range []struct {
+		name    string
+		encrypt func(ad Bytes) Bytes
+		decrypt func(c, ad Bytes) error
+	}{
+		{"ChaCha20-Poly1305",
+			func(ad Bytes) Bytes { return m.AEADCPEncrypt(ad, cpNonce, cpKey) },
+			func(c, ad Bytes) error { _, err := c.AEADCPDecrypt(ad, cpNonce, cpKey); return err }},
+		{"ChaCha20-Poly1305 detached",
+			func(ad Bytes) Bytes {
+				c, mac := m.AEADCPEncryptDetached(ad, cpNonce, cpKey)
+				return append(c, mac.Bytes...)
+			},
+			func(c, ad Bytes) error {
+				mac := AEADCPMAC{c[m.Length():]}
+				_, err := c[:m.Length()].AEADCPDecryptDetached(mac, ad, cpNonce, cpKey)
+				return err
+			}},
+		{"XChaCha20-Poly1305",
+			func(ad Bytes) Bytes { return m.AEADXCPEncrypt(ad, xcpNonce, xcpKey) },
+			func(c, ad Bytes) error { _, err := c.AEADXCPDecrypt(ad, xcpNonce, xcpKey); return err }},
+		{"XChaCha20-Poly1305 detached",
+			func(ad Bytes) Bytes {
+				c, mac := m.AEADXCPEncryptDetached(ad, xcpNonce, xcpKey)
+				return append(c, mac.Bytes...)
+			},
+			func(c, ad Bytes) error {
+				mac := AEADXCPMAC{c[m.Length():]}
+				_, err := c[:m.Length()].AEADXCPDecryptDetached(mac, ad, xcpNonce, xcpKey)
+				return err
+			}},
+	} {
+		withNil, withEmpty := c.encrypt(nil), c.encrypt(Bytes{})
+		if !bytes.Equal(withNil, withEmpty) {
+			t.Errorf("%s: nil and empty ad give different cipher texts", c.name)
+		}
+		if bytes.Equal(withNil, c.encrypt(Bytes("ad"))) {
+			t.Errorf("%s: ad ignored", c.name)
+		}
+		if err := c.decrypt(withNil, Bytes{}); err != nil {
+			t.Errorf("%s: nil ad, decrypted with empty ad: %v", c.name, err)
+		}
+		if err := c.decrypt(withEmpty, nil); err != nil {
+			t.Errorf("%s: empty ad, decrypted with nil ad: %v", c.name, err)
+		}
+		if err := c.decrypt(withNil, Bytes("ad")); err != ErrDecryptAEAD {
+			t.Errorf("%s: nil ad, decrypted with an ad: got %v", c.name, err)
+		}
+	}
+}
+
+func TestSecretStreamNilAndEmptyAD(t *testing.T) {
+	key := MakeSecretStreamXCPKey()
+	for _, c := range []struct {
+		name        string
+		write, read []byte
+		err         error
+	}{
+		{"nil, empty", nil, []byte{}, io.EOF},
+		{"empty, nil", []byte{}, nil, io.EOF},
+		{"nil, non-empty", nil, []byte("ad"), ErrDecryptSS},
+		{"non-empty, empty", []byte("ad"), []byte{}, ErrDecryptSS},
+	} {
+		var buf bytes.Buffer
+		encoder := MakeSecretStreamXCPEncoder(key, &buf)
+		encoder.SetAdditionData(c.write)
+		encoder.WriteAndClose([]byte("test"))
+		decoder, _ := MakeSecretStreamXCPDecoder(key, &buf, encoder.Header())
+		decoder.SetAdditionData(c.read)
+		if _, err := decoder.Read(make([]byte, 4)); err != c.err {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.err)
+		}
+	}
+
+	k := MakeSecretStreamXCPKey()
+	if _, err := Bytes("test").SealEnvelopeWithAD(k, nil).OpenEnvelopeWithAD(k, Bytes{}); err != nil {
+		t.Errorf("envelope, nil and empty ad: %v", err)
+	}
+}
+
+func TestSecretStreamMaxPlaintextBytes(t *testing.T) {
+	key := MakeSecretStreamXCPKey()
+	var buf bytes.Buffer
+	encoder := MakeSecretStreamXCPEncoder(key, &buf)
+	for i := 0; i < 3; i++ {
+		encoder.Write(make([]byte, 100))
+	}
+	encoder.Close()
+	stream := buf.Bytes()
+
+	r := bytes.NewReader(stream)
+	decoder, _ := MakeSecretStreamXCPDecoder(key, r, encoder.Header(), MaxPlaintextBytes(250))
+	b := make([]byte, 100)
+	for i := 0; i < 2; i++ {
+		if n, err := decoder.Read(b); n != 100 || err != nil {
+			t.Fatalf("chunk %d: got %d, %v", i, n, err)
+		}
+	}
+	if n, err := decoder.Read(b); n != 0 || err != ErrPlaintextTooLarge {
+		t.Errorf("over the limit: got %d, %v", n, err)
+	}
+	if _, err := decoder.Read(nil); err != ErrPlaintextTooLarge {
+		t.Errorf("after the limit, empty buffer: got %v", err)
+	}
+	left := r.Len()
+	if _, err := decoder.Read(b); err != ErrPlaintextTooLarge {
+		t.Errorf("after the limit: got %v", err)
+	}
+	if r.Len() != left {
+		t.Errorf("after the limit: read %d more bytes", left-r.Len())
+	}
+
+	decoder, _ = MakeSecretStreamXCPDecoder(key, bytes.NewReader(stream), encoder.Header(), ReadBufferSize(100), MaxPlaintextBytes(250))
+	got, err := io.ReadAll(decoder)
+	if len(got) != 200 || err != ErrPlaintextTooLarge {
+		t.Errorf("buffered: got %d bytes, %v", len(got), err)
+	}
+
+	decoder, _ = MakeSecretStreamXCPDecoder(key, bytes.NewReader(stream), encoder.Header(), ReadBufferSize(100), MaxPlaintextBytes(300))
+	if got, err := io.ReadAll(decoder); len(got) != 300 || err != nil {
+		t.Errorf("at the limit: got %d bytes, %v", len(got), err)
+	}
+}
+
+func TestSignSecretKeyPublicKey(t *testing.T) {
+	kp := MakeSignKP()
+	stored := SignSecretKey{append(Bytes{}, kp.SecretKey.Bytes...)}
+
+	pk := stored.PublicKey()
+	if !pk.Equal(kp.PublicKey.Bytes) {
+		t.Fatalf("got %s, want %s", pk.Hex(), kp.PublicKey.Hex())
+	}
+	sig := m.SignDetached(stored)
+	if err := m.SignVerifyDetached(sig, pk); err != nil {
+		t.Errorf("verify with the recovered key: %v", err)
+	}
+	if _, err := m.Sign(stored).SignOpen(pk); err != nil {
+		t.Errorf("open with the recovered key: %v", err)
+	}
+}
+
+func TestSecretBoxXCP(t *testing.T) {
+	key := SecretBoxXCPKey{}
+	Randomize(&key)
+	n := SecretBoxXCPNonce{}
+	Randomize(&n)
+
+	c := m.SecretBoxXCP(n, key)
+	if c.Length() != m.Length()+SecretBoxXCPOverhead() {
+		t.Errorf("got %d bytes", c.Length())
+	}
+	if md, err := c.SecretBoxXCPOpen(n, key); err != nil || !md.Equal(m) {
+		t.Errorf("open: %v", err)
+	}
+	dc, mac := m.SecretBoxXCPDetached(n, key)
+	if !bytes.Equal(append(append(Bytes{}, mac.Bytes...), dc...), c) {
+		t.Error("detached box differs from the combined one")
+	}
+	if md, err := dc.SecretBoxXCPOpenDetached(mac, n, key); err != nil || !md.Equal(m) {
+		t.Errorf("open detached: %v", err)
+	}
+
+	if bytes.Equal(m.SecretBox(SecretBoxNonce{n.Bytes}, SecretBoxKey{key.Bytes}), c) {
+		t.Error("same box as XSalsa20-Poly1305")
+	}
+	c[0] ^= 1
+	if _, err := c.SecretBoxXCPOpen(n, key); err != ErrOpenBox {
+		t.Errorf("forged: got %v", err)
+	}
+	if _, err := c[:cryptoSecretBoxXCPMacBytes-1].SecretBoxXCPOpen(n, key); err != ErrOpenBox {
+		t.Errorf("short: got %v", err)
+	}
+}
+
+func TestSecretBoxInto(t *testing.T) {
+	key := SecretBoxKey{}
+	Randomize(&key)
+	n := SecretBoxNonce{}
+	Randomize(&n)
+
+	buf := make(Bytes, 0, m.Length()+SecretBoxOverhead())
+	c := m.SecretBoxInto(buf, n, key)
+	if &c[0] != &buf[:1][0] || !c.Equal(m.SecretBox(n, key)) {
+		t.Error("box not written into dst")
+	}
+	if small := m.SecretBoxInto(make(Bytes, 10), n, key); !small.Equal(c) {
+		t.Error("box differs when dst is too small")
+	}
+
+	out := make(Bytes, m.Length())
+	md, err := c.SecretBoxOpenInto(out[:0], n, key)
+	if err != nil || &md[0] != &out[0] || !md.Equal(m) {
+		t.Errorf("open into: %v", err)
+	}
+	c[0] ^= 1
+	if _, err := c.SecretBoxOpenInto(out, n, key); err != ErrOpenBox {
+		t.Errorf("forged: got %v", err)
+	}
+	if _, err := c[:5].SecretBoxOpenInto(out, n, key); err != ErrOpenBox {
+		t.Errorf("short: got %v", err)
+	}
+}
+
+// BenchmarkSecretBox on amd64, before and after checking the sizes of the key
+// and nonce without making them escape to the heap:
+//
+//	                before                      after
+//	alloc/1024      2080 ns/op  1200 B/op  3    2135 ns/op  1152 B/op  1
+//	into/1024       1840 ns/op    48 B/op  2    1808 ns/op     0 B/op  0
+//	open-into/1024  2170 ns/op    48 B/op  2    1982 ns/op     0 B/op  0
+//	alloc/32         503 ns/op    96 B/op  3     406 ns/op    48 B/op  1
+//	into/32          463 ns/op    48 B/op  2     407 ns/op     0 B/op  0
+//	open-into/32     598 ns/op    48 B/op  2     556 ns/op     0 B/op  0
+//
+// Boxing 64 messages of 32 bytes in a single call into libsodium was about
+// 10% faster than 64 calls of SecretBoxInto, not enough to be worth a batch
+// API copying the messages into one buffer.
+func BenchmarkSecretBox(b *testing.B) {
+	key := SecretBoxKey{}
+	Randomize(&key)
+	n := SecretBoxNonce{}
+	Randomize(&n)
+
+	for _, size := range []int{1024, 32} {
+		msg := make(Bytes, size)
+		c := msg.SecretBox(n, key)
+		b.Run(fmt.Sprintf("alloc/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				msg.SecretBox(n, key)
+			}
+		})
+		b.Run(fmt.Sprintf("into/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			buf := make(Bytes, 0, msg.Length()+SecretBoxOverhead())
+			for i := 0; i < b.N; i++ {
+				msg.SecretBoxInto(buf, n, key)
+			}
+		})
+		b.Run(fmt.Sprintf("open-into/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			buf := make(Bytes, 0, msg.Length())
+			for i := 0; i < b.N; i++ {
+				c.SecretBoxOpenInto(buf, n, key)
+			}
+		})
+	}
+}
+
+func ExampleKXSessionKey_ToSecretStreamKey() {
+	server, client := MakeKXKP(), MakeKXKP()
+	sss, _ := server.ServerSessionKeys(client.PublicKey)
+	css, _ := client.ClientSessionKeys(server.PublicKey)
+
+	// The client sends a stream with its Tx key...
+	var buf bytes.Buffer
+	encoder := MakeSecretStreamXCPEncoderWithHeader(css.Tx.ToSecretStreamKey(), &buf)
+	encoder.WriteAndClose([]byte("hello server"))
+
+	// ...which the server reads with its Rx key.
+	decoder, _ := MakeSecretStreamXCPDecoderAutoHeader(sss.Rx.ToSecretStreamKey(), &buf)
+	b := make([]byte, 12)
+	_, err := decoder.Read(b)
+	fmt.Println(string(b), err)
+	//Output: hello server EOF
+}
+
+func TestStreamCipher(t *testing.T) {
+	key := MakeStreamXCKey()
+	n := StreamXCNonce{make([]byte, StreamXCNonce{}.Size())}
+	Randomize(&n)
+	// Long enough to span several blocks, with an odd length.
+	data := append(append(Bytes{}, m...), m[:77]...)
+
+	c := data.StreamXCXOR(n, key)
+	if c.Equal(data) {
+		t.Fatal("not encrypted")
+	}
+	if p := c.StreamXCXOR(n, key); !p.Equal(data) {
+		t.Fatal("StreamXCXOR is not its own inverse")
+	}
+
+	got, err := io.ReadAll(NewStreamCipherReader(iotest.OneByteReader(bytes.NewReader(data)), n, key))
+	if err != nil || !c.Equal(got) {
+		t.Errorf("one-byte reads: %v", err)
+	}
+
+	for _, size := range []int{1, 7, 63, 64, 65, 200} {
+		var buf bytes.Buffer
+		w := NewStreamCipherWriter(&buf, n, key)
+		for i := 0; i < len(data); i += size {
+			end := i + size
+			if end > len(data) {
+				end = len(data)
+			}
+			if _, err := w.Write(data[i:end]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !c.Equal(buf.Bytes()) {
+			t.Errorf("writes of %d bytes: output differs from StreamXCXOR", size)
+		}
+	}
+
+	p, err := io.ReadAll(NewStreamCipherReader(iotest.HalfReader(bytes.NewReader(c)), n, key))
+	if err != nil || !data.Equal(p) {
+		t.Errorf("decrypting: %v", err)
+	}
+}
+
+func TestConstructions(t *testing.T) {
+	want := map[string][3]int{
+		"secretbox_xsalsa20poly1305":     {SecretBoxKey{}.Size(), SecretBoxNonce{}.Size(), SecretBoxOverhead()},
+		"secretbox_xchacha20poly1305":    {SecretBoxXCPKey{}.Size(), SecretBoxXCPNonce{}.Size(), SecretBoxXCPOverhead()},
+		"box_curve25519xsalsa20poly1305": {BoxSecretKey{}.Size(), BoxNonce{}.Size(), BoxOverhead()},
+		"aead_chacha20poly1305_ietf":     {AEADCPKey{}.Size(), AEADCPNonce{}.Size(), AEADChaCha20Poly1305Overhead()},
+		"aead_xchacha20poly1305_ietf":    {AEADXCPKey{}.Size(), AEADXCPNonce{}.Size(), AEADXChaCha20Poly1305Overhead()},
+		"secretstream_xchacha20poly1305": {SecretStreamXCPKey{}.Size(), SecretStreamXCPHeader{}.Size(), SecretStreamOverhead()},
+		"stream_xchacha20":               {StreamXCKey{}.Size(), StreamXCNonce{}.Size(), 0},
+	}
+	for name, w := range want {
+		c, ok := LookupConstruction(name)
+		if !ok {
+			t.Errorf("%s: not found", name)
+			continue
+		}
+		if got := [3]int{c.KeyBytes(), c.NonceBytes(), c.Overhead()}; got != w || c.Name() != name {
+			t.Errorf("%s: got %q %v, want %v", name, c.Name(), got, w)
+		}
+	}
+
+	cs := Constructions()
+	if len(cs) < len(want) {
+		t.Errorf("got %d constructions", len(cs))
+	}
+	for i := 1; i < len(cs); i++ {
+		if cs[i-1].Name() >= cs[i].Name() {
+			t.Errorf("not sorted: %q before %q", cs[i-1].Name(), cs[i].Name())
+		}
+	}
+	if _, ok := LookupConstruction("secretbox"); ok {
+		t.Error("found an unknown construction")
+	}
+}
+
+func TestSecretStreamSalted(t *testing.T) {
+	key := MakeSecretStreamXCPKey()
+	var buf1, buf2 bytes.Buffer
+
+	e1 := MakeSecretStreamXCPEncoderSalted(key, &buf1)
+	e1.WriteAndClose(m)
+	e2 := MakeSecretStreamXCPEncoderSalted(key, &buf2)
+	e2.WriteAndClose(m)
+	if buf1.Len() != SecretStreamSaltBytes+e1.Header().Length()+len(m)+SecretStreamOverhead() {
+		t.Fatalf("got %d bytes", buf1.Len())
+	}
+	if bytes.Equal(buf1.Bytes()[:SecretStreamSaltBytes], buf2.Bytes()[:SecretStreamSaltBytes]) {
+		t.Error("same salt for two streams")
+	}
+	if !bytes.Equal(buf1.Bytes()[SecretStreamSaltBytes:SecretStreamSaltBytes+e1.Header().Length()], e1.Header().Bytes) {
+		t.Error("header not after the salt")
+	}
+
+	// The base key itself doesn't decrypt the stream.
+	stream := buf1.Bytes()
+	plain, _ := MakeSecretStreamXCPDecoder(key, bytes.NewReader(stream[SecretStreamSaltBytes+e1.Header().Length():]), e1.Header())
+	if _, err := plain.Read(make([]byte, len(m))); err != ErrDecryptSS {
+		t.Errorf("base key: got %v, want ErrDecryptSS", err)
+	}
+
+	decoder, err := MakeSecretStreamXCPDecoderSalted(key, bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, len(m))
+	if _, err := decoder.Read(got); err != io.EOF || !bytes.Equal(got, m) {
+		t.Errorf("got %v", err)
+	}
+
+	salted := append([]byte{}, stream...)
+	salted[0] ^= 1
+	decoder, _ = MakeSecretStreamXCPDecoderSalted(key, bytes.NewReader(salted))
+	if _, err := decoder.Read(got); err != ErrDecryptSS {
+		t.Errorf("other salt: got %v, want ErrDecryptSS", err)
+	}
+	if _, err := MakeSecretStreamXCPDecoderSalted(key, bytes.NewReader(stream[:SecretStreamSaltBytes+3])); err != ErrInvalidHeader {
+		t.Errorf("short: got %v, want ErrInvalidHeader", err)
+	}
+
+	var buf3 bytes.Buffer
+	e1.(*SecretStreamXCPEncoder).Reset(key, &buf3)
+	e1.WriteAndClose(m)
+	if bytes.Equal(buf3.Bytes()[:SecretStreamSaltBytes], stream[:SecretStreamSaltBytes]) {
+		t.Error("salt not renewed by Reset")
+	}
+	decoder, _ = MakeSecretStreamXCPDecoderSalted(key, &buf3)
+	if _, err := decoder.Read(got); err != io.EOF || !bytes.Equal(got, m) {
+		t.Errorf("after Reset: %v", err)
+	}
+}
+
+func TestSecureDeleteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/key"
+	var buf bytes.Buffer
+	key := MakeSecretStreamXCPKey()
+	WriteKeyFile(&buf, &key)
+	data := bytes.Repeat(buf.Bytes(), 1000)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	// A second link keeps the overwritten contents reachable.
+	if err := os.Link(path, dir+"/link"); err != nil {
+		t.Skip(err)
+	}
+
+	if err := SecureDeleteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("file not removed: %v", err)
+	}
+	got, err := os.ReadFile(dir + "/link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(data) || !bytes.Equal(got, make([]byte, len(data))) {
+		t.Errorf("got %d bytes, not all zeros", len(got))
+	}
+
+	if err := SecureDeleteFile(path); !os.IsNotExist(err) {
+		t.Errorf("missing file: got %v", err)
+	}
+
+	target := dir + "/target"
+	if err := os.WriteFile(target, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, dir+"/symlink"); err != nil {
+		t.Skip(err)
+	}
+	if err := SecureDeleteFile(dir + "/symlink"); !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("symlink: got %v", err)
+	}
+	if got, _ := os.ReadFile(target); !bytes.Equal(got, data) {
+		t.Error("symlink: target overwritten")
+	}
+	if err := SecureDeleteFile(dir); !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("directory: got %v", err)
+	}
+}
+
+func TestSealedBoxWithContext(t *testing.T) {
+	alice, bob := MakeBoxKP(), MakeBoxKP()
+	c := m.SealedBoxWithContext(alice.PublicKey, []byte("to alice"))
+	if c.Length() != len(m)+SealedBoxOverhead()+32 {
+		t.Errorf("got %d bytes", c.Length())
+	}
+	if d, err := c.SealedBoxWithContextOpen(alice, []byte("to alice")); err != nil || !bytes.Equal(d, m) {
+		t.Errorf("got %v", err)
+	}
+	if _, err := c.SealedBoxWithContextOpen(alice, []byte("to bob")); err != ErrOpenBox {
+		t.Errorf("other context: got %v, want ErrOpenBox", err)
+	}
+	if _, err := c.SealedBoxWithContextOpen(alice, nil); err != ErrOpenBox {
+		t.Errorf("no context: got %v, want ErrOpenBox", err)
+	}
+
+	// Alice can open the inner message and seal it again for Bob, but Bob
+	// sees it was meant for her.
+	inner, _ := c.SealedBoxOpen(alice)
+	replayed := inner.SealedBox(bob.PublicKey)
+	if _, err := replayed.SealedBoxWithContextOpen(bob, []byte("to alice")); err != ErrOpenBox {
+		t.Errorf("replayed to another key: got %v, want ErrOpenBox", err)
+	}
+
+	empty := Bytes{}.SealedBoxWithContext(bob.PublicKey, nil)
+	if d, err := empty.SealedBoxWithContextOpen(bob, []byte{}); err != nil || d.Length() != 0 {
+		t.Errorf("empty: got %q, %v", d, err)
+	}
+	if _, err := c[:40].SealedBoxWithContextOpen(alice, []byte("to alice")); err != ErrOpenBox {
+		t.Errorf("short: got %v, want ErrOpenBox", err)
+	}
+}
+
+func TestRotatingSecretStream(t *testing.T) {
+	key := MakeSecretStreamXCPKey()
+	data := bytes.Repeat(m, 10)
+	encrypt := func(max int64) []byte {
+		var buf bytes.Buffer
+		w := MakeRotatingSecretStreamEncoder(key, &buf, max)
+		for i := 0; i < len(data); i += 700 {
+			end := i + 700
+			if end > len(data) {
+				end = len(data)
+			}
+			if _, err := w.Write(data[i:end]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	decrypt := func(stream []byte) ([]byte, error) {
+		return io.ReadAll(MakeRotatingSecretStreamDecoder(key, bytes.NewReader(stream)))
+	}
+
+	for _, max := range []int64{1, 1000, 1024, 1 << 20} {
+		if got, err := decrypt(encrypt(max)); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("max %d: got %d bytes, %v", max, len(got), err)
+		}
+	}
+
+	// With 1000 bytes per segment, each segment but the last one is a header
+	// and a single chunk.
+	stream := encrypt(1000)
+	seg := SecretStreamXCPHeader{}.Size() + 5 + 1000 + SecretStreamOverhead()
+	last := SecretStreamXCPHeader{}.Size() + 5 + len(data)%1000 + SecretStreamOverhead()
+	if len(stream) != 10*seg+last {
+		t.Fatalf("got %d bytes, want %d", len(stream), 10*seg+last)
+	}
+	if _, err := decrypt(stream[:3*seg]); err != ErrTruncatedStream {
+		t.Errorf("last segments dropped: got %v, want ErrTruncatedStream", err)
+	}
+	if _, err := decrypt(stream[:3*seg+30]); err != ErrTruncatedStream {
+		t.Errorf("cut in a segment: got %v, want ErrTruncatedStream", err)
+	}
+	swapped := append(append(append([]byte{}, stream[seg:2*seg]...), stream[:seg]...), stream[2*seg:]...)
+	if _, err := decrypt(swapped); err != ErrDecryptSS {
+		t.Errorf("segments swapped: got %v, want ErrDecryptSS", err)
+	}
+	if _, err := decrypt(append(append([]byte{}, stream...), 0)); err != ErrDecryptSS {
+		t.Errorf("trailing data: got %v, want ErrDecryptSS", err)
+	}
+
+	var buf bytes.Buffer
+	w := MakeRotatingSecretStreamEncoder(key, &buf, 1000)
+	w.Close()
+	if got, err := decrypt(buf.Bytes()); err != nil || len(got) != 0 {
+		t.Errorf("empty: got %d bytes, %v", len(got), err)
+	}
+	if _, err := w.Write(m); err != ErrInvalidState {
+		t.Errorf("write after Close: got %v", err)
+	}
+}
+
+func TestBloomHasher(t *testing.T) {
+	key := GenericHashKey{make([]byte, cryptoGenericHashKeyBytes)}
+	for i := range key.Bytes {
+		key.Bytes[i] = byte(i)
+	}
+	h := NewBloomHasher(key, 3)
+
+	// Computed with Python's hashlib.blake2b.
+	want := []uint64{0xf8560a2635cdec47, 0x65e51b918d32a56b, 0x9cef249825d5adfd}
+	got := h.Hashes([]byte("hello"))
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %x, want %x", got, want)
+	}
+	if fmt.Sprint(h.Hashes([]byte("hello"))) != fmt.Sprint(got) {
+		t.Error("not deterministic")
+	}
+	if fmt.Sprint(h.Hashes([]byte("hellp"))) == fmt.Sprint(got) {
+		t.Error("same hashes for another input")
+	}
+
+	other := GenericHashKey{make([]byte, cryptoGenericHashKeyBytes)}
+	Randomize(&other)
+	o := NewBloomHasher(other, 3).Hashes([]byte("hello"))
+	for i := range o {
+		if o[i] == got[i] {
+			t.Errorf("hash %d is the same with another key", i)
+		}
+	}
+	if l := len(NewBloomHasher(key, 7).Hashes(nil)); l != 7 {
+		t.Errorf("got %d hashes", l)
+	}
+}
+
+func TestMultiRecipient(t *testing.T) {
+	recipients := []BoxKP{MakeBoxKP(), MakeBoxKP(), MakeBoxKP()}
+	outsider := MakeBoxKP()
+	pks := make([]BoxPublicKey, len(recipients))
+	for i := range recipients {
+		pks[i] = recipients[i].PublicKey
+	}
+
+	blob, err := MultiRecipientSeal(m, pks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, kp := range recipients {
+		if got, err := MultiRecipientOpen(blob, kp.PublicKey, kp.SecretKey); err != nil || !bytes.Equal(got, m) {
+			t.Errorf("recipient %d: %v", i, err)
+		}
+	}
+	if _, err := MultiRecipientOpen(blob, outsider.PublicKey, outsider.SecretKey); err != ErrOpenBox {
+		t.Errorf("outsider: got %v, want ErrOpenBox", err)
+	}
+
+	// Dropping a recipient changes the authenticated prefix.
+	wrapped := 32 + SealedBoxOverhead()
+	dropped := append([]byte{MultiRecipientVersion, 0, 2}, blob[3+wrapped:]...)
+	if _, err := MultiRecipientOpen(dropped, recipients[1].PublicKey, recipients[1].SecretKey); err != ErrDecryptSS {
+		t.Errorf("recipient dropped: got %v, want ErrDecryptSS", err)
+	}
+	forged := append([]byte{}, blob...)
+	forged[len(forged)-1] ^= 1
+	if _, err := MultiRecipientOpen(forged, recipients[0].PublicKey, recipients[0].SecretKey); err != ErrDecryptSS {
+		t.Errorf("forged: got %v, want ErrDecryptSS", err)
+	}
+	if _, err := MultiRecipientOpen(blob[:3+wrapped], recipients[0].PublicKey, recipients[0].SecretKey); err != ErrInvalidHeader {
+		t.Errorf("short: got %v, want ErrInvalidHeader", err)
+	}
+	if _, err := MultiRecipientOpen(append([]byte{2}, blob[1:]...), recipients[0].PublicKey, recipients[0].SecretKey); err != ErrUnsupportedVersion {
+		t.Errorf("version: got %v, want ErrUnsupportedVersion", err)
+	}
+
+	if _, err := MultiRecipientSeal(m, nil); err != ErrInvalidRecipients {
+		t.Errorf("no recipients: got %v, want ErrInvalidRecipients", err)
+	}
+	weak := BoxPublicKey{make([]byte, 32)}
+	if _, err := MultiRecipientSeal(m, append(pks, weak)); err != ErrInvalidKey {
+		t.Errorf("weak recipient: got %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestTranscript(t *testing.T) {
+	hash := func(protocol string, msgs ...string) Bytes {
+		tr := NewTranscript(protocol)
+		for i := 0; i < len(msgs); i += 2 {
+			tr.AddMessage(msgs[i], []byte(msgs[i+1]))
+		}
+		return tr.Hash()
+	}
+
+	h := hash("test v1", "client hello", "abc", "server hello", "def")
+	if h.Length() != 32 {
+		t.Fatalf("Hash length: got %d, want 32", h.Length())
+	}
+	if MemCmp(h, hash("test v1", "client hello", "abc", "server hello", "def"), 32) != 0 {
+		t.Error("same messages: different hashes")
+	}
+	for name, other := range map[string]Bytes{
+		"reordered": hash("test v1", "server hello", "def", "client hello", "abc"),
+		"relabeled": hash("test v1", "client hello", "abc", "server finished", "def"),
+		"moved":     hash("test v1", "client hello", "abcd", "server hello", "ef"),
+		"boundary":  hash("test v1", "client hell", "oabc", "server hello", "def"),
+		"protocol":  hash("test v2", "client hello", "abc", "server hello", "def"),
+		"dropped":   hash("test v1", "client hello", "abc"),
+	} {
+		if MemCmp(h, other, 32) == 0 {
+			t.Errorf("%s: same hash", name)
+		}
+	}
+
+	// Hash doesn't end the transcript.
+	tr := NewTranscript("test v1")
+	tr.AddMessage("client hello", []byte("abc"))
+	if first := tr.Hash(); MemCmp(first, tr.Hash(), 32) != 0 {
+		t.Error("Hash changed the transcript")
+	}
+	tr.AddMessage("server hello", []byte("def"))
+	if MemCmp(h, tr.Hash(), 32) != 0 {
+		t.Error("Hash then AddMessage: different hash")
+	}
+}
+
+// TestSecretStreamInterop decodes a stream made by the C API of libsodium,
+// which libsodium-wrappers and PyNaCl wrap, with key 00 01 ... 1f and the
+// chunks "Hello", ", secret" with additional data "header" and the rekey tag,
+// then "stream!" with the final tag.
+//
+// The vectors were generated with libsodium 1.0.18 called directly from C, not
+// through this package, by testdata/secretstream_interop.c, which prints them
+// again. libsodium-wrappers and PyNaCl's nacl.bindings pass the header and the
+// chunks of crypto_secretstream_xchacha20poly1305 through unchanged; they were
+// not run to produce these vectors.
+func TestSecretStreamInterop(t *testing.T) {
+	unhex := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	key := SecretStreamXCPKey{make([]byte, 32)}
+	for i := range key.Bytes {
+		key.Bytes[i] = byte(i)
+	}
+	header := SecretStreamXCPHeader{unhex("3ad60ae14a872b4ead06ef273ba408aa11f8663b4ea373af")}
+	chunks := [][]byte{
+		unhex("c325ef3ae97420208a29a9324eff385d02bca57ae38b"),
+		unhex("32fb6a4dd0821b6e1cb36d1ecb839f571815f58836b4ecf8ec"),
+		unhex("5d1aa7dab5f1996811efba8b5f1bb92bdc2787e3308d63fb"),
+	}
+	msgs := []string{"Hello", ", secret", "stream!"}
+	ads := []string{"", "header", ""}
+	tags := []SecretStreamTag{SecretStreamTag_Message, SecretStreamTag_Rekey, SecretStreamTag_Final}
+
+	var stream []byte
+	for _, c := range chunks {
+		stream = append(stream, c...)
+	}
+	decoder, err := MakeSecretStreamXCPDecoder(key, bytes.NewReader(stream), header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, msg := range msgs {
+		b := make([]byte, len(msg))
+		n, err := decoder.(*SecretStreamXCPDecoder).ReadWithAD(b, []byte(ads[i]))
+		if err != nil && !(i == len(msgs)-1 && err == io.EOF) {
+			t.Fatalf("chunk %d: %v", i, err)
+		}
+		if string(b[:n]) != msg || decoder.Tag() != tags[i] {
+			t.Errorf("chunk %d: got %q with tag %v, want %q with tag %v", i, b[:n], decoder.Tag(), msg, tags[i])
+		}
+	}
+
+	// The header is random, so the encoder can't reproduce the vector, but its
+	// output must be the bare cipher text of each chunk, in the same layout.
+	var out bytes.Buffer
+	encoder := MakeSecretStreamXCPEncoder(key, &out)
+	for i, msg := range msgs {
+		encoder.SetTag(tags[i])
+		if _, err := encoder.(*SecretStreamXCPEncoder).WriteWithAD([]byte(msg), []byte(ads[i])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if out.Len() != len(stream) {
+		t.Fatalf("encoded length: got %d, want %d", out.Len(), len(stream))
+	}
+	decoder, err = MakeSecretStreamXCPDecoder(key, &out, encoder.Header())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, msg := range msgs {
+		b := make([]byte, len(msg))
+		if n, _ := decoder.(*SecretStreamXCPDecoder).ReadWithAD(b, []byte(ads[i])); string(b[:n]) != msg || decoder.Tag() != tags[i] {
+			t.Errorf("re-encoded chunk %d: got %q with tag %v", i, b[:n], decoder.Tag())
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	pk := SignPublicKey{make([]byte, cryptoSignPublicKeyBytes)}
+	for i := range pk.Bytes {
+		pk.Bytes[i] = byte(i)
+	}
+	// Computed with Python's hashlib.blake2b and base64.b32encode.
+	if got, want := Fingerprint(pk), "ZMXV-CYH4-D57A-LJK6"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	kp, fp, err := MakeSignKPWithFingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp != Fingerprint(kp.PublicKey) || fp != Fingerprint(kp.SecretKey.PublicKey()) {
+		t.Error("fingerprint not of the generated key")
+	}
+	if fp == Fingerprint(MakeSignKP().PublicKey) {
+		t.Error("same fingerprint for another key")
+	}
+}
+
+func TestConstantTimeLookup(t *testing.T) {
+	table := [][]byte{[]byte("zero"), []byte("one "), []byte("two "), []byte("3333")}
+	for i, want := range table {
+		got := ConstantTimeLookup(table, i)
+		if !bytes.Equal(got, want) {
+			t.Errorf("index %d: got %q, want %q", i, got, want)
+		}
+		got[0] ^= 1
+		if table[i][0] == got[0] {
+			t.Errorf("index %d: not a copy", i)
+		}
+	}
+
+	for name, f := range map[string]func(){
+		"empty":          func() { ConstantTimeLookup(nil, 0) },
+		"unequal":        func() { ConstantTimeLookup([][]byte{{1, 2}, {3}}, 0) },
+		"negative index": func() { ConstantTimeLookup(table, -1) },
+		"index too big":  func() { ConstantTimeLookup(table, len(table)) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: didn't panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestAuthenticatedWriterReader(t *testing.T) {
+	key, other := MACKey{}, MACKey{}
+	Randomize(&key)
+	Randomize(&other)
+	var buf bytes.Buffer
+	w := MakeAuthenticatedWriter(key, &buf)
+	if _, err := w.Write(m[:100]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(m[100:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(m); err != ErrInvalidState {
+		t.Errorf("Write after Close: got %v, want ErrInvalidState", err)
+	}
+	blob := buf.Bytes()
+	if len(blob) != len(m)+cryptoAuthBytes || !bytes.Equal(blob[:len(m)], m) {
+		t.Fatal("unexpected layout")
+	}
+	if err := Bytes(blob[:len(m)]).AuthVerify(MAC{blob[len(m):]}, key); err != nil {
+		t.Errorf("trailer is not the MAC of Auth: %v", err)
+	}
+
+	for name, r := range map[string]io.Reader{
+		"whole":    bytes.NewReader(blob),
+		"one byte": iotest.OneByteReader(bytes.NewReader(blob)),
+		"data err": iotest.DataErrReader(bytes.NewReader(blob)),
+	} {
+		got, err := io.ReadAll(MakeAuthenticatedReader(key, r))
+		if err != nil || !bytes.Equal(got, m) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	tamper := func(i int) []byte {
+		b := append([]byte{}, blob...)
+		b[i] ^= 1
+		return b
+	}
+	for name, b := range map[string][]byte{
+		"data":      tamper(0),
+		"mac":       tamper(len(blob) - 1),
+		"truncated": blob[:len(blob)-1],
+		"no mac":    blob[:len(m)],
+		"appended":  append(append([]byte{}, blob...), 0),
+		"empty":     nil,
+	} {
+		if _, err := io.ReadAll(MakeAuthenticatedReader(key, bytes.NewReader(b))); err != ErrAuth {
+			t.Errorf("%s: got %v, want ErrAuth", name, err)
+		}
+	}
+	if _, err := io.ReadAll(MakeAuthenticatedReader(other, bytes.NewReader(blob))); err != ErrAuth {
+		t.Errorf("wrong key: got %v, want ErrAuth", err)
+	}
+}
+
+func TestHexToArray(t *testing.T) {
+	var k SignSecretKey
+	Randomize(&k)
+	b := k.Bytes
+	h := hex.EncodeToString(b)
+
+	a16, err := HexToArray16(h[:32])
+	if err != nil || !bytes.Equal(a16[:], b[:16]) {
+		t.Errorf("HexToArray16: %v", err)
+	}
+	a32, err := HexToArray32(strings.ToUpper(h[:64]))
+	if err != nil || !bytes.Equal(a32[:], b[:32]) {
+		t.Errorf("HexToArray32: %v", err)
+	}
+	a64, err := HexToArray64(h)
+	if err != nil || !bytes.Equal(a64[:], b) {
+		t.Errorf("HexToArray64: %v", err)
+	}
+
+	for name, s := range map[string]string{
+		"short":   h[:62],
+		"long":    h[:66],
+		"odd":     h[:63],
+		"invalid": "zz" + h[2:64],
+		"spaced":  h[:2] + " " + h[3:64],
+		"empty":   "",
+	} {
+		if a, err := HexToArray32(s); err != ErrInvalidEncoding || a != [32]byte{} {
+			t.Errorf("%s: got %v, want ErrInvalidEncoding and zeros", name, err)
+		}
+	}
+}
+
+// wouldBlockReader returns its data a few bytes at a time, failing with
+// errWouldBlock or returning nothing in between, as a non-blocking socket.
+type wouldBlockReader struct {
+	data  []byte
+	calls int
+}
+
+var errWouldBlock = errors.New("would block")
+
+func (r *wouldBlockReader) Read(b []byte) (int, error) {
+	r.calls++
+	switch r.calls % 3 {
+	case 1:
+		return 0, errWouldBlock
+	case 2:
+		return 0, nil
+	}
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	if len(b) > 7 {
+		b = b[:7]
+	}
+	n := copy(b, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestSecretStreamNonBlocking(t *testing.T) {
+	key := MakeSecretStreamXCPKey()
+	var c bytes.Buffer
+	encoder := MakeSecretStreamXCPEncoder(key, &c)
+	encoder.Write(m[:100])
+	encoder.WriteAndClose(m[100:150])
+
+	for _, buffered := range []bool{true, false} {
+		opts := []SecretStreamDecoderOption{NonBlocking()}
+		if buffered {
+			opts = append(opts, ReadBufferSize(100))
+		}
+		d, err := MakeSecretStreamXCPDecoder(key, &wouldBlockReader{data: c.Bytes()}, encoder.Header(), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []byte
+		var blocked int
+		for err != io.EOF {
+			// Without ReadBufferSize, the buffer is the size of the chunk.
+			size := 30
+			if !buffered {
+				size = 100
+				if len(got) >= 100 {
+					size = 50
+				}
+			}
+			b := make([]byte, size)
+			var n int
+			n, err = d.Read(b)
+			got = append(got, b[:n]...)
+			switch err {
+			case errWouldBlock, io.ErrNoProgress:
+				blocked++
+			case nil, io.EOF:
+			default:
+				t.Fatalf("buffered %v: %v", buffered, err)
+			}
+		}
+		if !bytes.Equal(got, m[:150]) {
+			t.Errorf("buffered %v: wrong plain text", buffered)
+		}
+		if blocked == 0 {
+			t.Errorf("buffered %v: reader errors not returned", buffered)
+		}
+	}
+
+	d, _ := MakeSecretStreamXCPDecoder(key, &wouldBlockReader{data: c.Bytes(), calls: 1}, encoder.Header(), NonBlocking())
+	if _, err := d.Read(make([]byte, 100)); err != io.ErrNoProgress {
+		t.Fatalf("got %v, want io.ErrNoProgress", err)
+	}
+	if _, err := d.Read(make([]byte, 100)); err != errWouldBlock {
+		t.Fatalf("got %v, want errWouldBlock", err)
+	}
+	if _, err := d.Read(make([]byte, 99)); err != ErrInvalidState {
+		t.Errorf("other length: got %v, want ErrInvalidState", err)
+	}
+}
+
+func TestChunker(t *testing.T) {
+	var key GenericHashKey
+	Randomize(&key)
+	data := make([]byte, 1<<20)
+	rand.Read(data)
+	const min, avg, max = 2048, 8192, 32768
+
+	chunks := func(key GenericHashKey, data []byte) []Chunk {
+		c := NewChunker(iotest.HalfReader(bytes.NewReader(data)), key, min, avg, max)
+		var chunks []Chunk
+		for {
+			chunk, err := c.Next()
+			if err == io.EOF {
+				return chunks
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			chunks = append(chunks, chunk)
+		}
+	}
+	ids := func(chunks []Chunk) map[string]bool {
+		ids := map[string]bool{}
+		for _, c := range chunks {
+			ids[string(c.ID)] = true
+		}
+		return ids
+	}
+
+	cs := chunks(key, data)
+	var joined []byte
+	for i, c := range cs {
+		if c.Offset != int64(len(joined)) {
+			t.Errorf("chunk %d: got offset %d, want %d", i, c.Offset, len(joined))
+		}
+		if (len(c.Data) < min && i < len(cs)-1) || len(c.Data) > max {
+			t.Errorf("chunk %d: size %d out of range", i, len(c.Data))
+		}
+		if !c.ID.Equal(chunks(key, c.Data)[0].ID) {
+			t.Errorf("chunk %d: ID not of its content", i)
+		}
+		joined = append(joined, c.Data...)
+	}
+	if !bytes.Equal(joined, data) {
+		t.Fatal("chunks don't make the data back")
+	}
+	if n := len(cs); n < len(data)/avg/2 || n > len(data)/avg*2 {
+		t.Errorf("got %d chunks, want about %d", n, len(data)/avg)
+	}
+
+	// Inserting bytes only changes the chunks around them.
+	edited := append(append(append([]byte{}, data[:len(data)/2]...), "inserted"...), data[len(data)/2:]...)
+	shared := 0
+	before := ids(cs)
+	for id := range ids(chunks(key, edited)) {
+		if before[id] {
+			shared++
+		}
+	}
+	if shared < len(cs)-3 {
+		t.Errorf("only %d of %d chunks shared after an insertion", shared, len(cs))
+	}
+
+	var other GenericHashKey
+	Randomize(&other)
+	for id := range ids(chunks(other, data)) {
+		if before[id] {
+			t.Fatal("same chunk ID with another key")
+		}
+	}
+	if len(chunks(key, nil)) != 0 {
+		t.Error("chunks of empty data")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("NewChunker with min >= avg didn't panic")
+		}
+	}()
+	NewChunker(bytes.NewReader(data), key, avg, avg, max)
+}
+
+func TestVersion(t *testing.T) {
+	var major, minor, patch int
+	if _, err := fmt.Sscanf(Version(), "%d.%d.%d", &major, &minor, &patch); err != nil {
+		t.Fatalf("Version %q: %v", Version(), err)
+	}
+	hkdf := major > 1 || major == 1 && (minor > 0 || patch >= 19)
+	if SupportsHKDF() != hkdf {
+		t.Errorf("SupportsHKDF with %s: got %v", Version(), SupportsHKDF())
+	}
+}
+
+func TestSealSecretStreamBuffer(t *testing.T) {
+	key := MakeSecretStreamXCPKey()
+	const chunk = 100
+	for _, l := range []int{0, 1, chunk - 1, chunk, chunk + 1, 3 * chunk, len(m)} {
+		header, c := SealSecretStreamBuffer(key, m[:l], chunk)
+		chunks := (l + chunk - 1) / chunk
+		if chunks == 0 {
+			chunks = 1
+		}
+		if want := l + chunks*SecretStreamOverhead(); len(c) != want || cap(c) != want {
+			t.Errorf("%d bytes: got length %d and capacity %d, want %d", l, len(c), cap(c), want)
+		}
+		d, err := MakeSecretStreamXCPDecoder(key, bytes.NewReader(c), header, ReadBufferSize(chunk))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadFullMessage(d)
+		if err != nil || !bytes.Equal(got, m[:l]) {
+			t.Errorf("%d bytes: %v", l, err)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("chunk size 0 didn't panic")
+		}
+	}()
+	SealSecretStreamBuffer(key, m, 0)
+}
+
+// datagrams collects each Write as a datagram, and returns one per Read.
+type datagrams [][]byte
+
+func (d *datagrams) Write(b []byte) (int, error) {
+	*d = append(*d, append([]byte{}, b...))
+	return len(b), nil
+}
+
+func (d *datagrams) Read(b []byte) (int, error) {
+	if len(*d) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, (*d)[0])
+	*d = (*d)[1:]
+	return n, nil
+}
+
+func TestReplayProtectedDecoder(t *testing.T) {
+	key := MakeSecretStreamXCPKey()
+	var sent datagrams
+	e := MakeReplayProtectedEncoder(key, &sent)
+	for _, s := range []string{"zero", "one", "two", "three"} {
+		if _, err := e.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Write(nil); err != ErrInvalidState {
+		t.Errorf("Write after Close: got %v, want ErrInvalidState", err)
+	}
+	if _, err := MakeReplayProtectedEncoder(key, &datagrams{}).Write(make([]byte, SecretStreamDatagramBytes)); err != ErrMessageTooLarge {
+		t.Errorf("large Write: got %v, want ErrMessageTooLarge", err)
+	}
+
+	forged := append([]byte{}, sent[0]...)
+	forged[len(forged)-1] ^= 1
+	relabeled := append([]byte{}, sent[1]...)
+	binary.BigEndian.PutUint64(relabeled, 0)
+	forgedAhead := append([]byte{}, sent[1]...)
+	forgedAhead[len(forgedAhead)-1] ^= 1
+	var candidates [][]byte
+	for i := 0; i < replayCandidatesMax; i++ {
+		c := append([]byte{}, sent[1]...)
+		c[len(c)-1] ^= byte(i + 1)
+		candidates = append(candidates, c)
+	}
+
+	// receive reads the datagrams in order, returning the plain text and the
+	// errors of the reads.
+	receive := func(window int, order ...[]byte) (string, []error) {
+		in := datagrams(order)
+		d, err := MakeReplayProtectedDecoder(key, &in, e.Header(), window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		var errs []error
+		b := make([]byte, 64)
+		for {
+			n, err := d.Read(b)
+			got += string(b[:n])
+			if err == io.EOF || err == ErrTruncatedStream {
+				return got, append(errs, err)
+			}
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	for _, c := range []struct {
+		name   string
+		window int
+		order  [][]byte
+		want   string
+		errs   string
+	}{
+		{"in order", 1, sent, "zeroonetwothree", "[EOF]"},
+		{"reordered", 4, [][]byte{sent[2], sent[1], sent[0], sent[4], sent[3]}, "zeroonetwothree", "[EOF]"},
+		{"replayed", 4, [][]byte{sent[0], sent[1], sent[0], sent[2], sent[2], sent[3], sent[4]}, "zeroonetwothree", fmt.Sprint([]error{ErrReplay, ErrReplay, io.EOF})},
+		{"held twice", 4, [][]byte{sent[1], sent[1], sent[0], sent[2], sent[3], sent[4]}, "zeroonetwothree", fmt.Sprint([]error{ErrReplay, io.EOF})},
+		{"beyond the window", 2, [][]byte{sent[2], sent[0], sent[1], sent[2], sent[3], sent[4]}, "zeroonetwothree", fmt.Sprint([]error{ErrReplay, io.EOF})},
+		{"forged", 4, [][]byte{forged, relabeled, sent[0], sent[1], sent[2], sent[3], sent[4]}, "zeroonetwothree", fmt.Sprint([]error{ErrDecryptSS, ErrDecryptSS, io.EOF})},
+		{"forged held", 4, [][]byte{sent[1], forged[:len(forged)-1], sent[0], sent[2], sent[3], sent[4]}, "zeroonetwothree", fmt.Sprint([]error{ErrDecryptSS, io.EOF})},
+		{"forged ahead", 4, [][]byte{forgedAhead, sent[1], sent[0], sent[2], sent[3], sent[4]}, "zeroonetwothree", fmt.Sprint([]error{ErrDecryptSS, io.EOF})},
+		{"forged ahead after", 4, [][]byte{sent[1], forgedAhead, sent[0], sent[1], sent[2], sent[3], sent[4]}, "zeroonetwothree", fmt.Sprint([]error{ErrReplay, io.EOF})},
+		{"too many candidates", 4, append(candidates, sent[1], sent[0], sent[2], sent[3], sent[4]), "zero", fmt.Sprint([]error{ErrReplay, ErrDecryptSS, ErrDecryptSS, ErrDecryptSS, ErrDecryptSS, ErrTruncatedStream})},
+		{"truncated", 4, sent[:4], "zeroonetwothree", fmt.Sprint([]error{ErrTruncatedStream})},
+		{"gap", 4, [][]byte{sent[0], sent[2], sent[3], sent[4]}, "zero", fmt.Sprint([]error{ErrTruncatedStream})},
+	} {
+		got, errs := receive(c.window, c.order...)
+		if got != c.want || fmt.Sprint(errs) != c.errs {
+			t.Errorf("%s: got %q %v, want %q %v", c.name, got, errs, c.want, c.errs)
+		}
+	}
+}
+
+func TestPWHashVerifyTiming(t *testing.T) {
+	// Argon2id of "password" with the lowest limits, from crypto_pwhash_str,
+	// so the comparison isn't drowned in the hashing.
+	const hash = "$argon2id$v=19$m=8,t=1,p=1$MRaPqd9Qb/xKHcg9AuYRxA$HIEVsMmQAYic3BUtJGSXQKsF0HNAqicvsWBieNVryqA"
+	sep := strings.LastIndexByte(hash, '$') + 1
+	flip := func(i int) PWHashStr {
+		b := []byte(hash)
+		if b[i] == 'A' {
+			b[i] = 'B'
+		} else {
+			b[i] = 'A'
+		}
+		return PWHashStr{string(b)}
+	}
+	good := PWHashStr{hash}
+	first := flip(sep)          // no leading byte of the hash matches
+	last := flip(len(hash) - 2) // all but the last bytes match
+
+	if err := good.PWHashVerify("password"); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []PWHashStr{first, last} {
+		if err := s.PWHashVerify("password"); err != ErrPassword {
+			t.Fatalf("%s: got %v, want ErrPassword", s.string, err)
+		}
+	}
+
+	// Rough check, alternating the runs to share the noise: it catches the
+	// wrapper doing more work when more of the hash matches, not a few cycles.
+	const runs = 51
+	var f, l [runs]time.Duration
+	for i := 0; i < runs; i++ {
+		start := time.Now()
+		first.PWHashVerify("password")
+		f[i] = time.Since(start)
+		start = time.Now()
+		last.PWHashVerify("password")
+		l[i] = time.Since(start)
+	}
+	median := func(d []time.Duration) time.Duration {
+		sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+		return d[runs/2]
+	}
+	if mf, ml := median(f[:]), median(l[:]); mf > ml*3/2 || ml > mf*3/2 {
+		t.Errorf("verify time depends on the matching prefix: %v for none, %v for all but the last bytes", mf, ml)
+	}
+}
+
+func TestEncryptedFS(t *testing.T) {
+	root := t.TempDir()
+	efs := MakeEncryptedFS(root, MakeSecretStreamXCPKey())
+	files := map[string][]byte{
+		"empty":          nil,
+		"small.txt":      []byte("hello"),
+		"dir/chunk":      make([]byte, SecretStreamChunkBytes),
+		"dir/sub/larger": append(bytes.Repeat(m, 2*SecretStreamChunkBytes/len(m)), m[:10]...),
+	}
+	if err := os.MkdirAll(filepath.Join(root, "dir", "sub"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		w, err := efs.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, data := range files {
+		got, err := fs.ReadFile(efs, name)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s: %v", name, err)
+		}
+		if info, err := fs.Stat(efs, name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if info.Size() != int64(len(data)) {
+			t.Errorf("%s: got size %d, want %d", name, info.Size(), len(data))
+		}
+		if raw, _ := os.ReadFile(filepath.Join(root, filepath.FromSlash(name))); len(data) > 0 && bytes.Contains(raw, data) {
+			t.Errorf("%s: stored in clear", name)
+		}
+	}
+
+	entries, err := fs.ReadDir(efs, "dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if fmt.Sprint(names) != "[chunk sub]" {
+		t.Errorf("ReadDir: got %v", names)
+	}
+	if err := fstest.TestFS(efs, "empty", "small.txt", "dir/chunk", "dir/sub/larger"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := efs.Open("../escape"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("invalid path: got %v, want fs.ErrInvalid", err)
+	}
+	raw := filepath.Join(root, "small.txt")
+	b, _ := os.ReadFile(raw)
+	b[len(b)-1] ^= 1
+	os.WriteFile(raw, b, 0600)
+	if _, err := fs.ReadFile(efs, "small.txt"); err != ErrDecryptSS {
+		t.Errorf("tampered: got %v, want ErrDecryptSS", err)
+	}
+	if _, err := fs.ReadFile(MakeEncryptedFS(root, MakeSecretStreamXCPKey()), "empty"); err != ErrDecryptSS {
+		t.Errorf("wrong key: got %v, want ErrDecryptSS", err)
+	}
+}
+
+func TestDeriveNonce(t *testing.T) {
+	key := GenericHashKey{make([]byte, cryptoGenericHashKeyBytes)}
+	for i := range key.Bytes {
+		key.Bytes[i] = byte(i)
+	}
+	// Computed with Python's hashlib.blake2b.
+	if got := DeriveNonce(key, 0, 24).Hex(); got != "cac8167dc33652bceae8da7161b257a8a2b9e0136b11b9bc" {
+		t.Errorf("counter 0: got %s", got)
+	}
+	if got := DeriveNonce(key, 1, 12).Hex(); got != "fe3266d0e41211ba3a772008" {
+		t.Errorf("counter 1: got %s", got)
+	}
+
+	if !DeriveNonce(key, 42, 24).Equal(DeriveNonce(key, 42, 24)) {
+		t.Error("not deterministic")
+	}
+	seen := map[string]bool{}
+	for c := uint64(0); c < 10000; c++ {
+		n := DeriveNonce(key, c, AEADCPNonce{}.Size())
+		if seen[string(n)] {
+			t.Fatalf("counter %d: nonce already seen", c)
+		}
+		seen[string(n)] = true
+	}
+	var other GenericHashKey
+	Randomize(&other)
+	if DeriveNonce(key, 42, 24).Equal(DeriveNonce(other, 42, 24)) {
+		t.Error("same nonce with another key")
+	}
+
+	for _, l := range []int{0, 65} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("nonce length %d didn't panic", l)
+				}
+			}()
+			DeriveNonce(key, 0, l)
+		}()
+	}
+}
+
+func TestRecordStream(t *testing.T) {
+	key := MakeAEADXCPKey()
+	var buf bytes.Buffer
+	s := NewRecordStream(&buf, key, 7)
+	var records [][]byte
+	for i, msg := range []string{"first", "", "third"} {
+		start := buf.Len()
+		if err := s.WriteRecord([]byte(msg), []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, append([]byte{}, buf.Bytes()[start:]...))
+	}
+	if err := s.WriteRecord(make([]byte, RecordMaxBytes+1), nil); err != ErrMessageTooLarge {
+		t.Errorf("large record: got %v, want ErrMessageTooLarge", err)
+	}
+
+	r := NewRecordReader(bytes.NewReader(buf.Bytes()), key, 7)
+	for i, want := range []string{"first", "", "third"} {
+		got, err := r.ReadRecord([]byte{byte(i)})
+		if err != nil || string(got) != want {
+			t.Errorf("record %d: got %q, %v", i, got, err)
+		}
+	}
+	if _, err := r.ReadRecord(nil); err != io.EOF {
+		t.Errorf("end: got %v, want io.EOF", err)
+	}
+
+	// Each record decrypts on its own given its sequence number.
+	if got, err := NewRecordReader(bytes.NewReader(records[2]), key, 9).ReadRecord([]byte{2}); err != nil || string(got) != "third" {
+		t.Errorf("single record: got %q, %v", got, err)
+	}
+
+	read := func(seq uint64, ad []byte, records ...[]byte) error {
+		_, err := NewRecordReader(bytes.NewReader(bytes.Join(records, nil)), key, seq).ReadRecord(ad)
+		return err
+	}
+	relabeled := append([]byte{}, records[1]...)
+	binary.BigEndian.PutUint64(relabeled, 7)
+	tampered := append([]byte{}, records[0]...)
+	tampered[len(tampered)-1] ^= 1
+	for name, c := range map[string]struct {
+		err  error
+		want error
+	}{
+		"reordered": {read(7, []byte{1}, records[1], records[0]), ErrReplay},
+		"replayed":  {read(8, []byte{0}, records[0]), ErrReplay},
+		"relabeled": {read(7, []byte{1}, relabeled), ErrDecryptAEAD},
+		"tampered":  {read(7, []byte{0}, tampered), ErrDecryptAEAD},
+		"wrong ad":  {read(7, []byte{1}, records[0]), ErrDecryptAEAD},
+		"truncated": {read(7, []byte{0}, records[0][:len(records[0])-1]), ErrTruncatedStream},
+		"header":    {read(7, []byte{0}, records[0][:5]), ErrTruncatedStream},
+	} {
+		if c.err != c.want {
+			t.Errorf("%s: got %v, want %v", name, c.err, c.want)
+		}
+	}
+
+	r = NewRecordReader(bytes.NewReader(bytes.Join([][]byte{records[1], records[0]}, nil)), key, 7)
+	r.ReadRecord(nil)
+	if _, err := r.ReadRecord([]byte{0}); err != ErrReplay {
+		t.Errorf("after an error: got %v, want ErrReplay", err)
+	}
+}
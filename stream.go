@@ -0,0 +1,158 @@
+package sodium
+
+// #cgo pkg-config: libsodium
+// #include <stdlib.h>
+// #include <sodium.h>
+import "C"
+
+import "io"
+
+var (
+	cryptoStreamXChaCha20KeyBytes   = int(C.crypto_stream_xchacha20_keybytes())
+	cryptoStreamXChaCha20NonceBytes = int(C.crypto_stream_xchacha20_noncebytes())
+)
+
+const cryptoStreamXChaCha20BlockBytes = 64
+
+// StreamXCKey is the key of the raw XChaCha20 stream cipher.
+type StreamXCKey struct {
+	Bytes
+}
+
+func (k StreamXCKey) Size() int {
+	return cryptoStreamXChaCha20KeyBytes
+}
+
+func (k StreamXCKey) String() string {
+	return redacted("StreamXCKey", k.Bytes)
+}
+
+// MakeStreamXCKey generates a random StreamXCKey.
+func MakeStreamXCKey() StreamXCKey {
+	b := make([]byte, cryptoStreamXChaCha20KeyBytes)
+	C.crypto_stream_xchacha20_keygen((*C.uchar)(&b[0]))
+	return StreamXCKey{b}
+}
+
+type StreamXCNonce struct {
+	Bytes
+}
+
+func (n StreamXCNonce) Size() int {
+	return cryptoStreamXChaCha20NonceBytes
+}
+
+func (n *StreamXCNonce) Next() {
+	C.sodium_increment((*C.uchar)(&n.Bytes[0]), (C.size_t)(cryptoStreamXChaCha20NonceBytes))
+}
+
+// StreamXCXOR XORs b with the XChaCha20 keystream of n and k. The same call
+// decrypts the output.
+//
+// This is NOT authenticated encryption: the output can be modified without
+// being detected, and a nonce must never be used twice with the same key.
+// Use SecretBoxXCP, AEADXCP or secret streams unless building a mode of your
+// own with a separate MAC.
+func (b Bytes) StreamXCXOR(n StreamXCNonce, k StreamXCKey) (c Bytes) {
+	c = make([]byte, b.Length())
+	newStreamXCCipher(n, k).xor(c, b)
+	return
+}
+
+// streamXCCipher is an XChaCha20 keystream at a byte position, which may be
+// in the middle of a block.
+type streamXCCipher struct {
+	nonce StreamXCNonce
+	key   StreamXCKey
+	pos   uint64
+	block [cryptoStreamXChaCha20BlockBytes]byte
+}
+
+func newStreamXCCipher(n StreamXCNonce, k StreamXCKey) *streamXCCipher {
+	checkTypedSize(&n, "nonce")
+	checkTypedSize(&k, "key")
+	checkStrict(k.Bytes, "key")
+
+	return &streamXCCipher{nonce: n, key: k}
+}
+
+// xor XORs src into dst with the keystream from the current position, and
+// moves it forward by len(src). dst must be at least as long as src, and may
+// be src itself.
+func (s *streamXCCipher) xor(dst, src []byte) {
+	if off := int(s.pos % cryptoStreamXChaCha20BlockBytes); off != 0 && len(src) > 0 {
+		// Finish the current block: its keystream starts before the data.
+		l := copy(s.block[off:], src)
+		s.xorIC(s.block[:off+l], s.block[:off+l], s.pos/cryptoStreamXChaCha20BlockBytes)
+		copy(dst, s.block[off:off+l])
+		MemZero(s.block[:])
+		s.pos += uint64(l)
+		dst, src = dst[l:], src[l:]
+	}
+	if len(src) > 0 {
+		s.xorIC(dst, src, s.pos/cryptoStreamXChaCha20BlockBytes)
+		s.pos += uint64(len(src))
+	}
+}
+
+func (s *streamXCCipher) xorIC(dst, src []byte, ic uint64) {
+	if int(C.crypto_stream_xchacha20_xor_ic(
+		(*C.uchar)(&dst[0]),
+		(*C.uchar)(&src[0]),
+		(C.ulonglong)(len(src)),
+		(*C.uchar)(&s.nonce.Bytes[0]),
+		(C.uint64_t)(ic),
+		(*C.uchar)(&s.key.Bytes[0]))) != 0 {
+		panic("see libsodium")
+	}
+}
+
+type streamCipherReader struct {
+	r      io.Reader
+	cipher *streamXCCipher
+}
+
+type streamCipherWriter struct {
+	w      io.Writer
+	cipher *streamXCCipher
+	buf    []byte
+}
+
+// NewStreamCipherReader returns a reader XORing the data read from r with the
+// XChaCha20 keystream of nonce and key, the same as StreamXCXOR of the whole
+// data whatever the sizes of the reads.
+//
+// This is NOT authenticated: the data can be modified without being detected.
+// It is only meant as a building block for modes with their own MAC; see
+// StreamXCXOR.
+func NewStreamCipherReader(r io.Reader, nonce StreamXCNonce, key StreamXCKey) io.Reader {
+	return &streamCipherReader{r: r, cipher: newStreamXCCipher(nonce, key)}
+}
+
+func (r *streamCipherReader) Read(b []byte) (n int, err error) {
+	n, err = r.r.Read(b)
+	r.cipher.xor(b[:n], b[:n])
+	return
+}
+
+// NewStreamCipherWriter returns a writer XORing the data with the XChaCha20
+// keystream of nonce and key before writing it to w, the same as StreamXCXOR
+// of the whole data whatever the sizes of the writes. The data given to Write
+// is left unchanged.
+//
+// This is NOT authenticated: the data can be modified without being detected.
+// It is only meant as a building block for modes with their own MAC; see
+// StreamXCXOR.
+func NewStreamCipherWriter(w io.Writer, nonce StreamXCNonce, key StreamXCKey) io.Writer {
+	return &streamCipherWriter{w: w, cipher: newStreamXCCipher(nonce, key)}
+}
+
+func (w *streamCipherWriter) Write(b []byte) (n int, err error) {
+	w.buf = into(w.buf, len(b))
+	pos := w.cipher.pos
+	w.cipher.xor(w.buf, b)
+	n, err = w.w.Write(w.buf)
+	// Only the bytes written use up the keystream.
+	w.cipher.pos = pos + uint64(n)
+	return
+}
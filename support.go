@@ -1,11 +1,23 @@
 package sodium
 
-import "fmt"
+import (
+	"fmt"
+	"sync/atomic"
+)
 
 //
 // Internal support functions
 //
 
+// checkSize panics like checkTypedSize if b is not of size bytes. Unlike it,
+// it doesn't make the key or nonce escape to the heap, for the functions
+// called on many small messages.
+func checkSize(b Bytes, size int, descrip string) {
+	if len(b) != size {
+		panic(fmt.Sprintf("Incorrect %s buffer size, expected (%d), got (%d).\n", descrip, size, len(b)))
+	}
+}
+
 // CheckTypedSize verifies the expected size of a Typed byte array.
 func checkTypedSize(typed Typed, descrip string) {
 	switch typed.(type) {
@@ -31,3 +43,57 @@ func checkSizeInRange(size int, min int, max int, descrip string) {
 		panic(fmt.Sprintf("Incorrect %s buffer size, expected (%d - %d), got (%d).", descrip, min, max, size))
 	}
 }
+
+// into returns dst resliced to n bytes, or a new buffer if dst is too small.
+func into(dst []byte, n int) []byte {
+	if cap(dst) >= n {
+		return dst[:n]
+	}
+	return make([]byte, n)
+}
+
+var strictMode int32
+
+// SetStrictMode turns the strict mode on or off for the whole package. It is
+// off by default. In strict mode:
+//
+//   - The secret keys given to SecretBox, AEAD (ChaCha20-Poly1305, AEGIS),
+//     Auth, secret stream and stream cipher functions must not be all zeros.
+//   - The nonces given to SecretBox, Box and AEAD encryption functions must
+//     not be all zeros. Nonces are not checked when decrypting, as they are
+//     not chosen by the caller then.
+//   - CryptoBoxBeforeNM and NewBoxSession return ErrInvalidKey for every
+//     public key reported by BoxPublicKey.IsWeak.
+//
+// An all-zero key or nonce panics like a key or nonce of the wrong size.
+//
+// Some checks are always done: weak Box and key exchange public keys are
+// rejected by libsodium, cipher texts shorter than their overhead return the
+// usual error of the function, and MACs, tags and keys are always compared in
+// constant time.
+func SetStrictMode(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&strictMode, v)
+}
+
+// StrictMode reports whether the strict mode is on.
+func StrictMode() bool {
+	return atomic.LoadInt32(&strictMode) != 0
+}
+
+// checkStrict panics in strict mode if b is all zeros.
+func checkStrict(b Bytes, descrip string) {
+	if !StrictMode() {
+		return
+	}
+	var acc byte
+	for _, c := range b {
+		acc |= c
+	}
+	if acc == 0 {
+		panic(fmt.Sprintf("All-zero %s in strict mode.", descrip))
+	}
+}
@@ -0,0 +1,65 @@
+/*
+ * Generates the vectors of TestSecretStreamInterop with libsodium directly,
+ * without going through this package:
+ *
+ *	cc -o secretstream_interop secretstream_interop.c $(pkg-config --cflags --libs libsodium)
+ *	./secretstream_interop
+ *
+ * init_push draws a random header, so the state is set up by init_pull from
+ * the fixed header instead: both derive the same state from the key and the
+ * header, so the chunks are the ones init_push would give with that header.
+ */
+#include <stdio.h>
+#include <string.h>
+#include <sodium.h>
+
+static void print_hex(const char *name, const unsigned char *b, size_t len)
+{
+	size_t i;
+
+	printf("%s: ", name);
+	for (i = 0; i < len; i++) {
+		printf("%02x", b[i]);
+	}
+	printf("\n");
+}
+
+int main(void)
+{
+	static const char *msgs[] = { "Hello", ", secret", "stream!" };
+	static const char *ads[] = { "", "header", "" };
+	const unsigned char tags[] = {
+		crypto_secretstream_xchacha20poly1305_TAG_MESSAGE,
+		crypto_secretstream_xchacha20poly1305_TAG_REKEY,
+		crypto_secretstream_xchacha20poly1305_TAG_FINAL,
+	};
+	unsigned char key[crypto_secretstream_xchacha20poly1305_KEYBYTES];
+	unsigned char header[crypto_secretstream_xchacha20poly1305_HEADERBYTES] = {
+		0x3a, 0xd6, 0x0a, 0xe1, 0x4a, 0x87, 0x2b, 0x4e,
+		0xad, 0x06, 0xef, 0x27, 0x3b, 0xa4, 0x08, 0xaa,
+		0x11, 0xf8, 0x66, 0x3b, 0x4e, 0xa3, 0x73, 0xaf,
+	};
+	unsigned char c[64];
+	unsigned long long clen;
+	crypto_secretstream_xchacha20poly1305_state st;
+	size_t i;
+
+	if (sodium_init() < 0) {
+		return 1;
+	}
+	printf("libsodium %s\n", sodium_version_string());
+	for (i = 0; i < sizeof key; i++) {
+		key[i] = (unsigned char) i;
+	}
+	print_hex("header", header, sizeof header);
+	if (crypto_secretstream_xchacha20poly1305_init_pull(&st, header, key) != 0) {
+		return 1;
+	}
+	for (i = 0; i < 3; i++) {
+		crypto_secretstream_xchacha20poly1305_push(&st, c, &clen,
+			(const unsigned char *) msgs[i], strlen(msgs[i]),
+			(const unsigned char *) ads[i], strlen(ads[i]), tags[i]);
+		print_hex("chunk", c, (size_t) clen);
+	}
+	return 0;
+}
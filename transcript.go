@@ -0,0 +1,42 @@
+package sodium
+
+var transcriptDomain = []byte("sodium transcript")
+
+// Transcript hashes the messages of a protocol, e.g. a handshake, so both
+// peers can bind their keys or signatures to everything exchanged so far.
+//
+// The transcript is the BLAKE2b-256 of the domain, the protocol name, then the
+// label and data of each message, every one of them prefixed by its length as
+// by ADBuilder. Reordering, relabeling, splitting or joining messages changes
+// the hash.
+//
+// A Transcript is not safe for concurrent use.
+type Transcript struct {
+	h *GenericHash
+}
+
+// NewTranscript starts the transcript of protocol, a name distinguishing it
+// from the transcripts of other protocols and versions.
+func NewTranscript(protocol string) *Transcript {
+	t := &Transcript{h: NewGenericHash(cryptoGenericHashBytes).(*GenericHash)}
+	t.write(transcriptDomain)
+	t.write([]byte(protocol))
+	return t
+}
+
+// AddMessage appends a message to the transcript. The label tells what the
+// message is, e.g. "client hello".
+func (t *Transcript) AddMessage(label string, data []byte) {
+	t.write([]byte(label))
+	t.write(data)
+}
+
+func (t *Transcript) write(b []byte) {
+	t.h.Write(NewADBuilder().Add(b).Bytes())
+}
+
+// Hash returns the hash of the messages added so far. More messages can be
+// added afterwards.
+func (t *Transcript) Hash() Bytes {
+	return t.h.Clone().Sum(nil)
+}
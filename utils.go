@@ -1,5 +1,6 @@
 package sodium
 
+import "crypto/subtle"
 import "fmt"
 import "unsafe"
 
@@ -24,3 +25,329 @@ func MemCmp(buff1, buff2 Bytes, length int) int {
 	b2, _ := plen(buff2)
 	return int(C.sodium_memcmp(b1, b2, C.size_t(length)))
 }
+
+// Equal reports whether b and o hold the same bytes, comparing them in
+// constant time with crypto_verify_16, _32 or _64 for buffers of these
+// sizes, e.g. MACs, keys and signatures, and with sodium_memcmp otherwise.
+// Only the lengths, which are compared first, may leak.
+//
+// As every key, nonce, header and MAC embeds Bytes, they can be compared
+// with e.g. key1.Equal(key2.Bytes). Signatures and MACs have an Equal of
+// their own for their size.
+func (b Bytes) Equal(o Bytes) bool {
+	if len(b) != len(o) {
+		return false
+	}
+	switch len(b) {
+	case 16:
+		return Verify16(b, o)
+	case 32:
+		return Verify32(b, o)
+	case 64:
+		return Verify64(b, o)
+	}
+	return MemCmp(b, o, len(b)) == 0
+}
+
+// ConstantTimeSelect returns a copy of a if cond is 1, or a copy of b if cond
+// is 0, without branching on cond.
+//
+// It panics if a and b are of different lengths or if cond is neither 0 nor 1.
+func ConstantTimeSelect(cond int, a, b Bytes) Bytes {
+	if len(a) != len(b) {
+		panic(fmt.Sprintf("Attempt to select between buffers of different "+
+			"lengths (%d, %d)", len(a), len(b)))
+	}
+	if cond&^1 != 0 {
+		panic(fmt.Sprintf("Incorrect select condition, expected (0 - 1), got (%d).", cond))
+	}
+	mask := byte(-cond)
+	out := make([]byte, len(a))
+	for i := range out {
+		out[i] = b[i] ^ (mask & (a[i] ^ b[i]))
+	}
+	return out
+}
+
+// ConstantTimeLookup returns a copy of table[index], reading every entry of
+// the table and selecting the one at index as ConstantTimeSelect does, so
+// neither the branches nor the memory accesses depend on index, e.g. for
+// secret-indexed S-boxes.
+//
+// It panics if the table is empty, if its entries are of different lengths,
+// or if index is out of range. Only the last check depends on index.
+func ConstantTimeLookup(table [][]byte, index int) []byte {
+	if len(table) == 0 {
+		panic("Attempt to look up an empty table")
+	}
+	for _, e := range table {
+		if len(e) != len(table[0]) {
+			panic(fmt.Sprintf("Attempt to look up a table with entries of "+
+				"different lengths (%d, %d)", len(table[0]), len(e)))
+		}
+	}
+	if index < 0 || index >= len(table) {
+		panic(fmt.Sprintf("Incorrect table index, expected (0 - %d), got (%d).", len(table)-1, index))
+	}
+	out := make([]byte, len(table[0]))
+	for i, e := range table {
+		mask := byte(-subtle.ConstantTimeEq(int32(i), int32(index)))
+		for j := range out {
+			out[j] ^= mask & (e[j] ^ out[j])
+		}
+	}
+	return out
+}
+
+// Verify16 compares two 16 bytes buffers in constant time.
+//
+// It returns false if they differ or if either is not 16 bytes.
+func Verify16(a, b []byte) bool {
+	if len(a) != 16 || len(b) != 16 {
+		return false
+	}
+	return int(C.crypto_verify_16((*C.uchar)(&a[0]), (*C.uchar)(&b[0]))) == 0
+}
+
+// Verify32 compares two 32 bytes buffers in constant time.
+//
+// It returns false if they differ or if either is not 32 bytes.
+func Verify32(a, b []byte) bool {
+	if len(a) != 32 || len(b) != 32 {
+		return false
+	}
+	return int(C.crypto_verify_32((*C.uchar)(&a[0]), (*C.uchar)(&b[0]))) == 0
+}
+
+// Verify64 compares two 64 bytes buffers in constant time.
+//
+// It returns false if they differ or if either is not 64 bytes.
+func Verify64(a, b []byte) bool {
+	if len(a) != 64 || len(b) != 64 {
+		return false
+	}
+	return int(C.crypto_verify_64((*C.uchar)(&a[0]), (*C.uchar)(&b[0]))) == 0
+}
+
+// Base64Variant selects the alphabet and padding of base64 encoding.
+type Base64Variant int
+
+const (
+	Base64Variant_Original          Base64Variant = C.sodium_base64_VARIANT_ORIGINAL
+	Base64Variant_OriginalNoPadding Base64Variant = C.sodium_base64_VARIANT_ORIGINAL_NO_PADDING
+	Base64Variant_URLSafe           Base64Variant = C.sodium_base64_VARIANT_URLSAFE
+	Base64Variant_URLSafeNoPadding  Base64Variant = C.sodium_base64_VARIANT_URLSAFE_NO_PADDING
+)
+
+// HexEncodedLen returns the size of the buffer sodium_bin2hex needs for binLen
+// bytes: 2*binLen characters and the NUL terminator. The string returned by Hex
+// is one byte shorter.
+func HexEncodedLen(binLen int) int {
+	return binLen*2 + 1
+}
+
+// Base64EncodedLen returns the size of the buffer sodium_bin2base64 needs for
+// binLen bytes in the variant v, padding and NUL terminator included, as
+// sodium_base64_ENCODED_LEN. The string returned by Base64 is one byte
+// shorter, the same length as the EncodedLen of the matching encoding of
+// encoding/base64.
+func Base64EncodedLen(binLen int, v Base64Variant) int {
+	checkBase64Variant(v)
+	return int(C.sodium_base64_encoded_len((C.size_t)(binLen), (C.int)(v)))
+}
+
+func checkBase64Variant(v Base64Variant) {
+	switch v {
+	case Base64Variant_Original, Base64Variant_OriginalNoPadding,
+		Base64Variant_URLSafe, Base64Variant_URLSafeNoPadding:
+	default:
+		// libsodium aborts on unknown variants.
+		panic(fmt.Sprintf("Incorrect base64 variant, got (%d).", v))
+	}
+}
+
+// Hex encodes the bytes into a hexadecimal string in constant time.
+//
+// The output is the same as encoding/hex, but without table lookups on the
+// bytes, so it is safe for secrets.
+func (b Bytes) Hex() string {
+	hex := make([]C.char, HexEncodedLen(b.Length()))
+	bp, bl := plen(b)
+	C.sodium_bin2hex(
+		&hex[0],
+		(C.size_t)(len(hex)),
+		(*C.uchar)(bp),
+		(C.size_t)(bl))
+	return C.GoStringN(&hex[0], C.int(bl*2))
+}
+
+// Base64 encodes the bytes into a base64 string of the variant in constant time.
+//
+// The output is the same as encoding/base64 with the matching encoding, but
+// without table lookups on the bytes, so it is safe for secrets.
+func (b Bytes) Base64(v Base64Variant) string {
+	bp, bl := plen(b)
+	b64 := make([]C.char, Base64EncodedLen(bl, v))
+	C.sodium_bin2base64(
+		&b64[0],
+		(C.size_t)(len(b64)),
+		(*C.uchar)(bp),
+		(C.size_t)(bl),
+		(C.int)(v))
+	return C.GoStringN(&b64[0], C.int(len(b64)-1))
+}
+
+// ParseHex decodes a hexadecimal string in constant time.
+//
+// It returns ErrInvalidEncoding if s is not a valid hexadecimal string.
+func ParseHex(s string) (b Bytes, err error) {
+	if len(s) == 0 {
+		return Bytes{}, nil
+	}
+	hex := []byte(s)
+	b = make([]byte, len(hex)/2)
+	bp, bl := plen(b)
+	var outlen C.size_t
+	if int(C.sodium_hex2bin(
+		(*C.uchar)(bp),
+		(C.size_t)(bl),
+		(*C.char)(unsafe.Pointer(&hex[0])),
+		(C.size_t)(len(hex)),
+		(*C.char)(nil),
+		&outlen,
+		(**C.char)(nil))) != 0 || int(outlen)*2 != len(hex) {
+		return nil, ErrInvalidEncoding
+	}
+	return b[:outlen], nil
+}
+
+// HexToArray16 decodes a hexadecimal string of exactly 16 bytes in constant
+// time, e.g. for APIs using fixed-size arrays.
+//
+// It returns ErrInvalidEncoding if s is not a valid hexadecimal string of 32
+// characters.
+func HexToArray16(s string) (a [16]byte, err error) {
+	err = hexToArray(a[:], s)
+	return
+}
+
+// HexToArray32 decodes a hexadecimal string of exactly 32 bytes in constant
+// time, e.g. for the keys of golang.org/x/crypto/nacl.
+//
+// It returns ErrInvalidEncoding if s is not a valid hexadecimal string of 64
+// characters.
+func HexToArray32(s string) (a [32]byte, err error) {
+	err = hexToArray(a[:], s)
+	return
+}
+
+// HexToArray64 decodes a hexadecimal string of exactly 64 bytes in constant
+// time, e.g. for Ed25519 secret keys stored in arrays.
+//
+// It returns ErrInvalidEncoding if s is not a valid hexadecimal string of 128
+// characters.
+func HexToArray64(s string) (a [64]byte, err error) {
+	err = hexToArray(a[:], s)
+	return
+}
+
+// hexToArray decodes s into the whole of dst, which is wiped on error.
+func hexToArray(dst []byte, s string) error {
+	if len(s) != len(dst)*2 {
+		return ErrInvalidEncoding
+	}
+	hex := []byte(s)
+	var outlen C.size_t
+	if int(C.sodium_hex2bin(
+		(*C.uchar)(&dst[0]),
+		(C.size_t)(len(dst)),
+		(*C.char)(unsafe.Pointer(&hex[0])),
+		(C.size_t)(len(hex)),
+		(*C.char)(nil),
+		&outlen,
+		(**C.char)(nil))) != 0 || int(outlen) != len(dst) {
+		MemZero(dst)
+		return ErrInvalidEncoding
+	}
+	return nil
+}
+
+// ParseBase64 decodes a base64 string of the variant in constant time.
+//
+// It returns ErrInvalidEncoding if s is not a valid base64 string of the variant,
+// and panics if the variant is unknown.
+func ParseBase64(s string, v Base64Variant) (b Bytes, err error) {
+	checkBase64Variant(v)
+	if len(s) == 0 {
+		return Bytes{}, nil
+	}
+	b64 := []byte(s)
+	b = make([]byte, len(b64)/4*3+3)
+	var outlen C.size_t
+	if int(C.sodium_base642bin(
+		(*C.uchar)(&b[0]),
+		(C.size_t)(len(b)),
+		(*C.char)(unsafe.Pointer(&b64[0])),
+		(C.size_t)(len(b64)),
+		(*C.char)(nil),
+		&outlen,
+		(**C.char)(nil),
+		(C.int)(v))) != 0 {
+		return nil, ErrInvalidEncoding
+	}
+	return b[:outlen], nil
+}
+
+// Pad returns a copy of b padded to a multiple of blockSize with the
+// ISO/IEC 7816-4 padding, i.e. 0x80 followed by zeros. At least one byte is
+// added, so Unpad can always remove it.
+func (b Bytes) Pad(blockSize int) Bytes {
+	if blockSize <= 0 {
+		panic(fmt.Sprintf("Incorrect padding block size, got (%d).", blockSize))
+	}
+	p := make([]byte, (b.Length()/blockSize+1)*blockSize)
+	copy(p, b)
+	var pl C.size_t
+	if int(C.sodium_pad(
+		&pl,
+		(*C.uchar)(&p[0]),
+		(C.size_t)(b.Length()),
+		(C.size_t)(blockSize),
+		(C.size_t)(len(p)))) != 0 {
+		panic("see libsodium")
+	}
+	return p[:pl]
+}
+
+// Unpad returns b without the padding added by Pad with the same blockSize,
+// in constant time. It returns ErrInvalidPadding if b isn't padded.
+func (b Bytes) Unpad(blockSize int) (Bytes, error) {
+	if blockSize <= 0 {
+		panic(fmt.Sprintf("Incorrect padding block size, got (%d).", blockSize))
+	}
+	bp, bl := plen(b)
+	var l C.size_t
+	if int(C.sodium_unpad(
+		&l,
+		(*C.uchar)(bp),
+		(C.size_t)(bl),
+		(C.size_t)(blockSize))) != 0 {
+		return nil, ErrInvalidPadding
+	}
+	return b[:l], nil
+}
+
+// Redacted returns the length and a short BLAKE2b fingerprint of b, e.g.
+// "Bytes(32 bytes, blake2b:1a2b3c4d)", which can be logged without revealing b.
+//
+// Secret keys and seeds print this way with fmt, whatever the verb, so they
+// don't end up in logs by mistake. Call Hex to get the actual bytes.
+func (b Bytes) Redacted() string {
+	return redacted("Bytes", b)
+}
+
+func redacted(name string, b Bytes) string {
+	h := NewGenericHash(cryptoGenericHashBytesMin)
+	h.Write(b)
+	return fmt.Sprintf("%s(%d bytes, blake2b:%x)", name, len(b), h.Sum(nil)[:4])
+}
@@ -0,0 +1,54 @@
+package sodium
+
+// #cgo pkg-config: libsodium
+// #include <stdlib.h>
+// #include <sodium.h>
+// #if !defined(SODIUM_LIBRARY_VERSION_MAJOR) || SODIUM_LIBRARY_VERSION_MAJOR < 10 || \
+//     (SODIUM_LIBRARY_VERSION_MAJOR == 10 && SODIUM_LIBRARY_VERSION_MINOR < 3)
+// #error "github.com/cryptag/sodium needs libsodium 1.0.18 or later, see https://doc.libsodium.org/installation"
+// #endif
+import "C"
+
+import "fmt"
+
+const (
+	libraryVersionMajorMin = 10
+	libraryVersionMinorMin = 3
+
+	// libsodium 1.0.19 bumped the library version to 26.1.
+	libraryVersionMajorHKDF = 26
+)
+
+// CheckLibrary verifies that the libsodium linked at run time is 1.0.18 or
+// later, as the headers are only checked at build time. It returns
+// ErrUnsupportedLibrary otherwise.
+func CheckLibrary() error {
+	major := int(C.sodium_library_version_major())
+	minor := int(C.sodium_library_version_minor())
+	if major < libraryVersionMajorMin || major == libraryVersionMajorMin && minor < libraryVersionMinorMin {
+		return fmt.Errorf("%w: %s", ErrUnsupportedLibrary, Version())
+	}
+	return nil
+}
+
+// Version returns the version of the libsodium linked at run time, e.g.
+// "1.0.18".
+func Version() string {
+	return C.GoString(C.sodium_version_string())
+}
+
+// SupportsAEGIS reports whether the AEADAEGIS256* and AEADAEGIS128L*
+// functions are available, i.e. whether the package was built with the
+// sodium_aegis tag, which needs libsodium 1.0.19 or later.
+func SupportsAEGIS() bool {
+	_, ok := LookupConstruction("aead_aegis256")
+	return ok
+}
+
+// SupportsHKDF reports whether the libsodium linked at run time, 1.0.19 or
+// later, has crypto_kdf_hkdf_sha256 and crypto_kdf_hkdf_sha512. The package
+// doesn't wrap them, e.g. code calling them through cgo can fall back to
+// golang.org/x/crypto/hkdf when they are missing.
+func SupportsHKDF() bool {
+	return int(C.sodium_library_version_major()) >= libraryVersionMajorHKDF
+}